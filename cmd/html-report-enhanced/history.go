@@ -0,0 +1,941 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/analytics"
+	"github.com/lirany1/gauge-html-report-ai/pkg/config"
+	"github.com/lirany1/gauge-html-report-ai/pkg/quarantine"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryCmd builds the "history" command group for the test history database
+func newHistoryCmd() *cobra.Command {
+	var historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "Query and maintain the test history database",
+		Long:  "Inspect, prune and move the history database used for trends, flaky-test detection and regressions.",
+	}
+
+	var pruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Apply the retention policy to the history database",
+		Long: `Remove executions older than --days, or beyond the newest --max-runs per project, environment and tag filter,
+together with their scenario and step records. Removed runs are rolled up into daily aggregates
+so long-term trends survive. Defaults come from GAUGE_HISTORY_RETENTION_DAYS and GAUGE_HISTORY_MAX_RUNS.`,
+		RunE: runHistoryPrune,
+	}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List recent executions",
+		Args:  cobra.NoArgs,
+		RunE:  runHistoryList,
+	}
+
+	var showCmd = &cobra.Command{
+		Use:   "show <execution-id>",
+		Short: "Show an execution and its scenarios",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runHistoryShow,
+	}
+
+	var scenarioCmd = &cobra.Command{
+		Use:   "scenario <name>",
+		Short: "Show the run history of scenarios matching a name",
+		Long:  "Show every recorded run of the scenarios whose heading contains <name>, and since when each has been failing or passing.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runHistoryScenario,
+	}
+
+	var flakyCmd = &cobra.Command{
+		Use:   "flaky",
+		Short: "List flaky scenarios and scenarios broken since a date",
+		Args:  cobra.NoArgs,
+		RunE:  runHistoryFlaky,
+	}
+
+	var quarantineCmd = &cobra.Command{
+		Use:   "quarantine",
+		Short: "Suggest scenarios to quarantine or release, as a patch to the quarantine file",
+		Long: `Rate every scenario recorded in the last --days against the quarantine list. Scenarios with a flaky
+score of at least GAUGE_QUARANTINE_SUGGEST_SCORE over GAUGE_QUARANTINE_SUGGEST_MIN_RUNS runs are suggested
+for quarantine; quarantined scenarios that expired or passed GAUGE_QUARANTINE_RELEASE_AFTER runs in a row
+are suggested for release. "-o patch" prints a unified diff of the quarantine file, "-o json" the entries
+to add and release together with the diff, and --write updates the file in place.`,
+		Args: cobra.NoArgs,
+		RunE: runHistoryQuarantine,
+	}
+
+	var streamsCmd = &cobra.Command{
+		Use:   "streams",
+		Short: "Suggest how to split specs across parallel streams",
+		Long: `Estimate every spec from its median duration over the last --days and pack the specs into --streams
+parallel streams so the longest stream, the expected wall-clock time, is as short as possible. With
+--specs-dir, specs no longer on disk are dropped and new ones are estimated at the median spec. "-o specs"
+prints the spec files of each stream on one line, "-o tags" a tag expression per stream (with --by-tag,
+which keeps specs sharing their first tag together), and "-o json" the whole plan.`,
+		Args: cobra.NoArgs,
+		RunE: runHistoryStreams,
+	}
+
+	var exportCmd = &cobra.Command{
+		Use:   "export <file>",
+		Short: "Export the history database to a portable archive",
+		Long:  "Write every table as JSON lines into a zip archive, with a manifest recording the schema version.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runHistoryExport,
+	}
+
+	var importCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Merge an exported archive into the history database",
+		Long:  "Import an archive written by \"history export\". Executions already present are skipped, so importing twice is harmless.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runHistoryImport,
+	}
+
+	historyCmd.PersistentFlags().StringP("reports-dir", "r", "reports", "Reports directory holding .gauge-history")
+	historyCmd.PersistentFlags().String("dsn", "", "History database DSN (default: GAUGE_HISTORY_DSN)")
+	historyCmd.PersistentFlags().StringP("output", "o", "table", "Output format (table, json)")
+
+	for _, cmd := range []*cobra.Command{listCmd, scenarioCmd, flakyCmd, quarantineCmd, streamsCmd} {
+		cmd.Flags().String("project", "", "Only runs of this project")
+		cmd.Flags().String("env", "", "Only runs in this Gauge environment")
+		cmd.Flags().String("tag-filter", "", "Only runs with this tag filter")
+	}
+	listCmd.Flags().IntP("limit", "n", 20, "Number of executions to list")
+	scenarioCmd.Flags().IntP("limit", "n", 20, "Runs to list per scenario")
+	scenarioCmd.Flags().Int("days", 90, "Look back this many days")
+	flakyCmd.Flags().Int("days", 30, "Look back this many days")
+	quarantineCmd.Flags().Int("days", 30, "Look back this many days")
+	quarantineCmd.Flags().String("file", "", "Quarantine file (default: GAUGE_QUARANTINE_FILE, or quarantine.yaml in GAUGE_PROJECT_ROOT)")
+	quarantineCmd.Flags().String("owner", "", "Owner of the entries added")
+	quarantineCmd.Flags().Int("expire-days", 0, "Days until added entries expire (default: GAUGE_QUARANTINE_EXPIRE_DAYS)")
+	quarantineCmd.Flags().Bool("write", false, "Apply the patch to the quarantine file")
+	streamsCmd.Flags().IntP("streams", "n", 4, "Number of parallel streams")
+	streamsCmd.Flags().Int("days", 30, "Look back this many days")
+	streamsCmd.Flags().Bool("by-tag", false, "Keep specs sharing their first tag in one stream")
+	streamsCmd.Flags().String("specs-dir", "", "Only plan the specs under this directory, relative to GAUGE_PROJECT_ROOT")
+
+	pruneCmd.Flags().Int("days", 0, "Keep executions from the last N days (default: configured retention)")
+	pruneCmd.Flags().Int("max-runs", 0, "Keep the newest N runs per project, environment and tag filter (default: configured retention)")
+	pruneCmd.Flags().Bool("dry-run", false, "Show what would be pruned without changing the database")
+
+	historyCmd.AddCommand(listCmd, showCmd, scenarioCmd, flakyCmd, quarantineCmd, streamsCmd, pruneCmd, exportCmd, importCmd)
+	return historyCmd
+}
+
+// openHistoryStore opens the history database selected by the history flags
+func openHistoryStore(cmd *cobra.Command) (storage.Store, *config.Config, error) {
+	reportsDir, err := cmd.Flags().GetString("reports-dir")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting reports-dir flag: %w", err)
+	}
+	dsn, err := cmd.Flags().GetString("dsn")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting dsn flag: %w", err)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if dsn == "" {
+		dsn = cfg.HistoryDSN
+	}
+
+	store, err := storage.Open(reportsDir, dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	return store, cfg, nil
+}
+
+func runHistoryPrune(cmd *cobra.Command, args []string) error {
+	days, err := cmd.Flags().GetInt("days")
+	if err != nil {
+		return fmt.Errorf("error getting days flag: %w", err)
+	}
+	maxRuns, err := cmd.Flags().GetInt("max-runs")
+	if err != nil {
+		return fmt.Errorf("error getting max-runs flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("error getting dry-run flag: %w", err)
+	}
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, cfg, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	policy := storage.RetentionPolicy{MaxAgeDays: cfg.HistoryRetentionDays, MaxRuns: cfg.HistoryMaxRuns}
+	if cmd.Flags().Changed("days") {
+		policy.MaxAgeDays = days
+	}
+	if cmd.Flags().Changed("max-runs") {
+		policy.MaxRuns = maxRuns
+	}
+	if !policy.Enabled() {
+		return fmt.Errorf("no retention policy: pass --days or --max-runs, or set GAUGE_HISTORY_RETENTION_DAYS / GAUGE_HISTORY_MAX_RUNS")
+	}
+
+	result, err := store.Prune(policy, dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+
+	if asJSON {
+		return writeJSON(cmd, result)
+	}
+
+	out := cmd.OutOrStdout()
+	verb := "Pruned"
+	if result.DryRun {
+		verb = "Would prune"
+	}
+	_, _ = fmt.Fprintf(out, "%s %d executions (%d scenario records, %d step records)\n",
+		verb, result.Executions, result.Scenarios, result.StepMetrics)
+	if len(result.Days) > 0 {
+		_, _ = fmt.Fprintf(out, "Rolled up into daily aggregates: %s to %s (%d days)\n",
+			result.Days[0], result.Days[len(result.Days)-1], len(result.Days))
+	}
+	return nil
+}
+
+func runHistoryList(cmd *cobra.Command, args []string) error {
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return fmt.Errorf("error getting limit flag: %w", err)
+	}
+	partition, err := partitionFlags(cmd)
+	if err != nil {
+		return err
+	}
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, _, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	executions, err := store.GetRecentExecutions(partition, limit)
+	if err != nil {
+		return fmt.Errorf("failed to list executions: %w", err)
+	}
+	if asJSON {
+		return writeJSON(cmd, executions)
+	}
+
+	w := newTable(cmd)
+	_, _ = fmt.Fprintln(w, "ID\tTIME\tPROJECT\tENV\tBUILD\tBRANCH\tCOMMIT\tPASSED\tSUCCESS\tDURATION")
+	for _, exec := range executions {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\t%.1f%%\t%s\n",
+			exec.ID, formatTime(exec.Timestamp), orDash(exec.Project), orDash(exec.Environment),
+			orDash(exec.BuildNumber), orDash(exec.Branch), orDash(shortCommit(exec.GitCommit)),
+			exec.PassedScenarios, exec.TotalScenarios, exec.SuccessRate,
+			analytics.FormatDuration(time.Duration(exec.Duration)*time.Millisecond))
+	}
+	return w.Flush()
+}
+
+func runHistoryShow(cmd *cobra.Command, args []string) error {
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, _, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	exec, err := store.GetExecution(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load execution: %w", err)
+	}
+	if exec == nil {
+		return fmt.Errorf("execution %s not found", args[0])
+	}
+	scenarios, err := store.GetExecutionScenarios(exec.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load scenarios: %w", err)
+	}
+
+	if asJSON {
+		return writeJSON(cmd, struct {
+			Execution *storage.ExecutionRecord `json:"execution"`
+			Scenarios []storage.ScenarioRecord `json:"scenarios"`
+		}{exec, scenarios})
+	}
+
+	out := cmd.OutOrStdout()
+	_, _ = fmt.Fprintf(out, "Execution %s\n", exec.ID)
+	_, _ = fmt.Fprintf(out, "  Time:      %s\n", formatTime(exec.Timestamp))
+	_, _ = fmt.Fprintf(out, "  Project:   %s (%s)\n", orDash(exec.Project), orDash(exec.Environment))
+	if exec.BuildNumber != "" || exec.BuildURL != "" {
+		_, _ = fmt.Fprintf(out, "  Build:     %s\n", strings.TrimSpace("#"+exec.BuildNumber+" "+exec.BuildURL))
+	}
+	if exec.Branch != "" || exec.GitCommit != "" {
+		_, _ = fmt.Fprintf(out, "  Commit:    %s @ %s\n", orDash(exec.Branch), orDash(shortCommit(exec.GitCommit)))
+	}
+	_, _ = fmt.Fprintf(out, "  Scenarios: %d passed, %d failed, %d skipped (%.1f%%)\n",
+		exec.PassedScenarios, exec.FailedScenarios, exec.SkippedScenarios, exec.SuccessRate)
+	_, _ = fmt.Fprintf(out, "  Duration:  %s\n\n", analytics.FormatDuration(time.Duration(exec.Duration)*time.Millisecond))
+
+	w := newTable(cmd)
+	_, _ = fmt.Fprintln(w, "STATUS\tSPEC\tSCENARIO\tDURATION\tERROR")
+	for _, scenario := range scenarios {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			scenario.Status, scenario.SpecName, scenario.ScenarioName,
+			analytics.FormatDuration(time.Duration(scenario.Duration)*time.Millisecond),
+			truncate(firstLine(scenario.ErrorMessage), 80))
+	}
+	return w.Flush()
+}
+
+func runHistoryExport(cmd *cobra.Command, args []string) error {
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, _, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	manifest, err := store.Export(file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(args[0])
+		return fmt.Errorf("failed to export history: %w", err)
+	}
+
+	if asJSON {
+		return writeJSON(cmd, manifest)
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Exported %d executions (schema version %d) to %s\n",
+		manifest.Tables["executions"], manifest.SchemaVersion, args[0])
+	return nil
+}
+
+func runHistoryImport(cmd *cobra.Command, args []string) error {
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	store, _, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	result, err := store.Import(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to import history: %w", err)
+	}
+
+	if asJSON {
+		return writeJSON(cmd, result)
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Imported %d executions (%d scenario records, %d step records); skipped %d already present\n",
+		result.Imported["executions"], result.Imported["scenario_history"], result.Imported["performance_metrics"], result.SkippedExecutions)
+	return nil
+}
+
+// scenarioSummary is the history of one scenario as printed by "history scenario"
+type scenarioSummary struct {
+	ScenarioID   string                `json:"scenarioId,omitempty"`
+	ScenarioName string                `json:"scenarioName"`
+	SpecName     string                `json:"specName"`
+	Status       string                `json:"status"`       // status of the latest run
+	Since        time.Time             `json:"since"`        // first run of the current streak
+	SinceBuild   string                `json:"sinceBuild"`   // build number of that run
+	SinceCommit  string                `json:"sinceCommit"`  // git commit of that run
+	StreakLength int                   `json:"streakLength"` // runs in the current streak
+	Runs         []storage.ScenarioRun `json:"runs"`         // newest first
+}
+
+func runHistoryScenario(cmd *cobra.Command, args []string) error {
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return fmt.Errorf("error getting limit flag: %w", err)
+	}
+	days, err := cmd.Flags().GetInt("days")
+	if err != nil {
+		return fmt.Errorf("error getting days flag: %w", err)
+	}
+	partition, err := partitionFlags(cmd)
+	if err != nil {
+		return err
+	}
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, _, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	runs, err := store.GetScenarioRuns(args[0], partition, days)
+	if err != nil {
+		return fmt.Errorf("failed to load scenario history: %w", err)
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no runs of a scenario matching %q in the last %d days", args[0], days)
+	}
+
+	summaries := summarizeScenarioRuns(runs, limit)
+	if asJSON {
+		return writeJSON(cmd, summaries)
+	}
+
+	out := cmd.OutOrStdout()
+	for i, summary := range summaries {
+		if i > 0 {
+			_, _ = fmt.Fprintln(out)
+		}
+		_, _ = fmt.Fprintf(out, "%s › %s\n", summary.SpecName, summary.ScenarioName)
+		_, _ = fmt.Fprintf(out, "  %s since %s", streakLabel(summary.Status), formatTime(summary.Since))
+		if summary.SinceBuild != "" {
+			_, _ = fmt.Fprintf(out, " (build #%s)", summary.SinceBuild)
+		}
+		if summary.SinceCommit != "" {
+			_, _ = fmt.Fprintf(out, " at %s", shortCommit(summary.SinceCommit))
+		}
+		_, _ = fmt.Fprintf(out, ", %d run(s) in a row\n", summary.StreakLength)
+
+		w := newTable(cmd)
+		_, _ = fmt.Fprintln(w, "  TIME\tSTATUS\tBUILD\tCOMMIT\tDURATION\tERROR")
+		for _, run := range summary.Runs {
+			_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+				formatTime(run.Timestamp), run.Status, orDash(run.BuildNumber), orDash(shortCommit(run.GitCommit)),
+				analytics.FormatDuration(time.Duration(run.Duration)*time.Millisecond),
+				truncate(firstLine(run.ErrorMessage), 60))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeScenarioRuns groups runs (oldest first) by scenario and finds the
+// current pass or fail streak of each, keeping the newest limit runs
+func summarizeScenarioRuns(runs []storage.ScenarioRun, limit int) []*scenarioSummary {
+	grouped := storage.GroupScenarioRuns(runs)
+	summaries := make([]*scenarioSummary, 0, len(grouped))
+	for _, scenarioRuns := range grouped {
+		latest := scenarioRuns[len(scenarioRuns)-1]
+		summary := &scenarioSummary{
+			ScenarioID:   latest.ScenarioID,
+			ScenarioName: latest.ScenarioName,
+			SpecName:     latest.SpecName,
+			Status:       latest.Status,
+		}
+
+		for i := len(scenarioRuns) - 1; i >= 0 && scenarioRuns[i].Status == latest.Status; i-- {
+			summary.Since = scenarioRuns[i].Timestamp
+			summary.SinceBuild = scenarioRuns[i].BuildNumber
+			summary.SinceCommit = scenarioRuns[i].GitCommit
+			summary.StreakLength++
+		}
+
+		for i := len(scenarioRuns) - 1; i >= 0 && len(summary.Runs) < limit; i-- {
+			summary.Runs = append(summary.Runs, scenarioRuns[i])
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func runHistoryFlaky(cmd *cobra.Command, args []string) error {
+	days, err := cmd.Flags().GetInt("days")
+	if err != nil {
+		return fmt.Errorf("error getting days flag: %w", err)
+	}
+	partition, err := partitionFlags(cmd)
+	if err != nil {
+		return err
+	}
+	asJSON, err := wantJSON(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, cfg, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	flakyTests, brokenTests, err := analytics.NewEngine(cfg, store).UnstableScenarios(partition, days)
+	if err != nil {
+		return fmt.Errorf("failed to detect flaky scenarios: %w", err)
+	}
+	if asJSON {
+		return writeJSON(cmd, map[string]interface{}{
+			"flaky":  flakyTests,
+			"broken": brokenTests,
+		})
+	}
+
+	w := newTable(cmd)
+	_, _ = fmt.Fprintln(w, "SCORE\tFAILURE RATE\tRUNS\tSPEC\tSCENARIO\tEVIDENCE")
+	for _, flaky := range flakyTests {
+		_, _ = fmt.Fprintf(w, "%.2f\t%.0f%%\t%d\t%s\t%s\t%s\n",
+			flaky.FlakyScore, flaky.FailureRate, flaky.Occurrences,
+			flaky.SpecName, flaky.ScenarioName, strings.Join(flaky.Evidence, "; "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(brokenTests) == 0 {
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(cmd.OutOrStdout())
+	w = newTable(cmd)
+	_, _ = fmt.Fprintln(w, "BROKEN SINCE\tFAILED RUNS\tSPEC\tSCENARIO\tLAST RUN")
+	for _, broken := range brokenTests {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			formatTime(broken.BrokenSince), broken.ConsecutiveFails,
+			broken.SpecName, broken.ScenarioName, formatTime(broken.LastSeen))
+	}
+	return w.Flush()
+}
+
+func runHistoryQuarantine(cmd *cobra.Command, args []string) error {
+	days, err := cmd.Flags().GetInt("days")
+	if err != nil {
+		return fmt.Errorf("error getting days flag: %w", err)
+	}
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("error getting file flag: %w", err)
+	}
+	owner, err := cmd.Flags().GetString("owner")
+	if err != nil {
+		return fmt.Errorf("error getting owner flag: %w", err)
+	}
+	expireDays, err := cmd.Flags().GetInt("expire-days")
+	if err != nil {
+		return fmt.Errorf("error getting expire-days flag: %w", err)
+	}
+	write, err := cmd.Flags().GetBool("write")
+	if err != nil {
+		return fmt.Errorf("error getting write flag: %w", err)
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("error getting output flag: %w", err)
+	}
+	if output != "table" && output != "json" && output != "patch" {
+		return fmt.Errorf("unknown output format %q (use table, json or patch)", output)
+	}
+	partition, err := partitionFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, cfg, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	if file == "" {
+		file = cfg.QuarantineFile
+	}
+	if !cmd.Flags().Changed("expire-days") {
+		expireDays = cfg.QuarantineExpireDays
+	}
+	path := quarantine.Path(file, os.Getenv("GAUGE_PROJECT_ROOT"))
+	list, err := quarantine.Load(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	suggestions, err := analytics.NewEngine(cfg, store).QuarantineSuggestions(list, partition, days, now)
+	if err != nil {
+		return fmt.Errorf("failed to suggest quarantine changes: %w", err)
+	}
+	patch, err := list.Patch(path, suggestions, owner, expireDays, now)
+	if err != nil {
+		return err
+	}
+
+	if write && !patch.Empty() {
+		if err := os.WriteFile(path, patch.Content, 0644); err != nil {
+			return fmt.Errorf("failed to write quarantine file: %w", err)
+		}
+	}
+
+	switch output {
+	case "json":
+		return writeJSON(cmd, map[string]interface{}{
+			"suggestions": suggestions,
+			"patch":       patch,
+		})
+	case "patch":
+		_, err := fmt.Fprint(cmd.OutOrStdout(), patch.Diff)
+		return err
+	}
+
+	if len(suggestions) == 0 {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "No quarantine changes suggested for %s\n", path)
+		return nil
+	}
+	w := newTable(cmd)
+	_, _ = fmt.Fprintln(w, "ACTION\tSCORE\tRUNS\tSPEC\tSCENARIO\tREASON")
+	for _, suggestion := range suggestions {
+		_, _ = fmt.Fprintf(w, "%s\t%.2f\t%d\t%s\t%s\t%s\n",
+			suggestion.Action, suggestion.FlakyScore, suggestion.Runs,
+			suggestion.SpecName, suggestion.ScenarioName, suggestion.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if write {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "\nUpdated %s: %d added, %d released\n", path, len(patch.Add), len(patch.Release))
+	}
+	return nil
+}
+
+func runHistoryStreams(cmd *cobra.Command, args []string) error {
+	streams, err := cmd.Flags().GetInt("streams")
+	if err != nil {
+		return fmt.Errorf("error getting streams flag: %w", err)
+	}
+	if streams < 1 {
+		return fmt.Errorf("--streams must be at least 1")
+	}
+	days, err := cmd.Flags().GetInt("days")
+	if err != nil {
+		return fmt.Errorf("error getting days flag: %w", err)
+	}
+	byTag, err := cmd.Flags().GetBool("by-tag")
+	if err != nil {
+		return fmt.Errorf("error getting by-tag flag: %w", err)
+	}
+	specsDir, err := cmd.Flags().GetString("specs-dir")
+	if err != nil {
+		return fmt.Errorf("error getting specs-dir flag: %w", err)
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("error getting output flag: %w", err)
+	}
+	if output != "table" && output != "json" && output != "specs" && output != "tags" {
+		return fmt.Errorf("unknown output format %q (use table, json, specs or tags)", output)
+	}
+	partition, err := partitionFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, cfg, err := openHistoryStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	specs, err := analytics.NewEngine(cfg, store).SpecEstimates(partition, days)
+	if err != nil {
+		return fmt.Errorf("failed to estimate spec durations: %w", err)
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("no spec durations recorded in the last %d days", days)
+	}
+	if specsDir != "" {
+		onDisk, err := scanSpecs(os.Getenv("GAUGE_PROJECT_ROOT"), specsDir)
+		if err != nil {
+			return err
+		}
+		specs = analytics.ReconcileSpecs(specs, onDisk)
+	}
+	allocation := analytics.AllocateStreams(specs, streams, byTag)
+
+	out := cmd.OutOrStdout()
+	switch output {
+	case "json":
+		return writeJSON(cmd, allocation)
+	case "specs":
+		for _, plan := range allocation.Streams {
+			files := make([]string, len(plan.Specs))
+			for i, spec := range plan.Specs {
+				files[i] = spec.SpecFile
+			}
+			_, _ = fmt.Fprintln(out, strings.Join(files, " "))
+		}
+		return nil
+	case "tags":
+		for _, plan := range allocation.Streams {
+			expression, err := plan.TagExpression()
+			if err != nil {
+				return fmt.Errorf("%w; use -o specs or tag those specs", err)
+			}
+			_, _ = fmt.Fprintln(out, expression)
+		}
+		return nil
+	}
+
+	w := newTable(cmd)
+	_, _ = fmt.Fprintln(w, "STREAM\tESTIMATE\tSAMPLES\tSPEC\tTAGS")
+	for _, plan := range allocation.Streams {
+		_, _ = fmt.Fprintf(w, "%d\t%s\t\t%d specs\t%s\n",
+			plan.Stream, formatMillis(plan.Total), len(plan.Specs), strings.Join(plan.Tags, " | "))
+		for _, spec := range plan.Specs {
+			samples := "new"
+			if spec.Samples > 0 {
+				samples = fmt.Sprintf("%d", spec.Samples)
+			}
+			_, _ = fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n",
+				formatMillis(spec.Estimate), samples, orDash(spec.SpecFile), strings.Join(spec.Tags, ", "))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "\nExpected wall-clock: %s (lower bound %s, serial %s)\n",
+		formatMillis(allocation.WallClock), formatMillis(allocation.LowerBound), formatMillis(allocation.Serial))
+	for _, warning := range allocation.Warnings {
+		_, _ = fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+	return nil
+}
+
+// scanSpecs lists the Gauge specs under dir, with the heading and tags read
+// from each file. Paths are relative to the project root, as in the history.
+func scanSpecs(projectRoot, dir string) ([]*analytics.SpecEstimate, error) {
+	if projectRoot == "" {
+		projectRoot = "."
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(projectRoot, dir)
+	}
+
+	var specs []*analytics.SpecEstimate
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".spec" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(projectRoot, path)
+		if err != nil {
+			rel = path
+		}
+		heading, tags := parseSpecHeader(string(data))
+		specs = append(specs, &analytics.SpecEstimate{
+			SpecName: heading,
+			SpecFile: filepath.ToSlash(rel),
+			Tags:     tags,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan specs: %w", err)
+	}
+	return specs, nil
+}
+
+// parseSpecHeader reads the heading of a Gauge spec and the tags given before
+// its first scenario
+func parseSpecHeader(content string) (string, []string) {
+	var heading string
+	var tags []string
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		underline := ""
+		if i+1 < len(lines) {
+			underline = strings.TrimSpace(lines[i+1])
+		}
+
+		switch {
+		case strings.HasPrefix(line, "##"), heading != "" && isUnderline(underline, '-') && line != "":
+			return heading, tags // first scenario
+		case heading == "" && strings.HasPrefix(line, "#"):
+			heading = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		case heading == "" && line != "" && isUnderline(underline, '='):
+			heading = line
+		case strings.HasPrefix(strings.ToLower(line), "tags:"):
+			for _, tag := range strings.Split(line[len("tags:"):], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return heading, tags
+}
+
+// isUnderline reports whether line is a markdown heading underline of c
+func isUnderline(line string, c byte) bool {
+	return len(line) >= 2 && strings.Trim(line, string(c)) == ""
+}
+
+// formatMillis formats a duration in milliseconds
+func formatMillis(ms int64) string {
+	return analytics.FormatDuration(time.Duration(ms) * time.Millisecond)
+}
+
+// streakLabel describes a run of identical statuses
+func streakLabel(status string) string {
+	switch status {
+	case "failed":
+		return "Failing"
+	case "passed":
+		return "Passing"
+	default:
+		return "Skipped"
+	}
+}
+
+// partitionFlags reads the --project, --env and --tag-filter filters
+func partitionFlags(cmd *cobra.Command) (storage.Partition, error) {
+	project, err := cmd.Flags().GetString("project")
+	if err != nil {
+		return storage.Partition{}, fmt.Errorf("error getting project flag: %w", err)
+	}
+	env, err := cmd.Flags().GetString("env")
+	if err != nil {
+		return storage.Partition{}, fmt.Errorf("error getting env flag: %w", err)
+	}
+	tagFilter, err := cmd.Flags().GetString("tag-filter")
+	if err != nil {
+		return storage.Partition{}, fmt.Errorf("error getting tag-filter flag: %w", err)
+	}
+	return storage.Partition{Project: project, Environment: env, TagFilter: tagFilter}, nil
+}
+
+// wantJSON reports whether --output asks for JSON
+func wantJSON(cmd *cobra.Command) (bool, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return false, fmt.Errorf("error getting output flag: %w", err)
+	}
+	switch output {
+	case "json":
+		return true, nil
+	case "table":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown output format %q (use table or json)", output)
+	}
+}
+
+func writeJSON(cmd *cobra.Command, v interface{}) error {
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newTable(cmd *cobra.Command) *tabwriter.Writer {
+	return tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func truncate(s string, max int) string {
+	if len([]rune(s)) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
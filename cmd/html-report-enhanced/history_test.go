@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// isolateHistoryEnv clears the settings that would point the history
+// commands away from the test database
+func isolateHistoryEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"GAUGE_HISTORY_DSN",
+		"GAUGE_HISTORY_RETENTION_DAYS",
+		"GAUGE_HISTORY_MAX_RUNS",
+		"GAUGE_QUARANTINE_FILE",
+		"GAUGE_QUARANTINE_SUGGEST_SCORE",
+		"GAUGE_QUARANTINE_SUGGEST_MIN_RUNS",
+		"GAUGE_QUARANTINE_EXPIRE_DAYS",
+		"GAUGE_PROJECT_ROOT",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+// seedHistory records six hourly runs of the shop project in a SQLite
+// database under a new reports directory: "Pay by card" alternates between
+// failing and passing, "Refund" fails in the last two runs and "Browse"
+// always passes
+func seedHistory(t *testing.T) string {
+	t.Helper()
+	isolateHistoryEnv(t)
+
+	reportsDir := t.TempDir()
+	db, err := storage.NewDatabase(reportsDir)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	start := time.Now().Add(-6 * time.Hour).Truncate(time.Second)
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("exec-%d", i)
+		failing := map[string]bool{
+			"Pay by card": i%2 == 0,
+			"Refund":      i >= 4,
+		}
+
+		exec := &storage.ExecutionRecord{
+			ID:             id,
+			Timestamp:      start.Add(time.Duration(i) * time.Hour),
+			Duration:       3000,
+			TotalScenarios: 3,
+			Project:        "shop",
+			Environment:    "ci",
+			BuildNumber:    fmt.Sprintf("%d", 100+i),
+			GitCommit:      fmt.Sprintf("abcdef%d123456", i),
+		}
+		for _, name := range []string{"Browse", "Pay by card", "Refund"} {
+			scenario := &storage.ScenarioRecord{
+				ExecutionID:  id,
+				ScenarioName: name,
+				SpecName:     "Checkout",
+				SpecFile:     "specs/checkout.spec",
+				Status:       "passed",
+				Duration:     1000,
+			}
+			if failing[name] {
+				scenario.Status = "failed"
+				scenario.ErrorMessage = "timed out\nafter 30s"
+				exec.FailedScenarios++
+			} else {
+				exec.PassedScenarios++
+			}
+			if err := db.SaveScenario(scenario); err != nil {
+				t.Fatalf("Failed to save scenario: %v", err)
+			}
+		}
+		exec.SuccessRate = float64(exec.PassedScenarios) / float64(exec.TotalScenarios) * 100
+		if err := db.SaveExecution(exec); err != nil {
+			t.Fatalf("Failed to save execution: %v", err)
+		}
+
+		specs := []storage.SpecRecord{
+			{SpecName: "Checkout", SpecFile: "specs/checkout.spec", Status: "failed", Duration: 3000},
+			{SpecName: "Search", SpecFile: "specs/search.spec", Status: "passed", Duration: 2000},
+			{SpecName: "Login", SpecFile: "specs/login.spec", Status: "passed", Duration: 1000},
+		}
+		if err := db.SaveSpecs(id, specs); err != nil {
+			t.Fatalf("Failed to save specs: %v", err)
+		}
+	}
+	return reportsDir
+}
+
+// runHistory runs "history" with args and returns what it wrote
+func runHistory(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newHistoryCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestHistoryList(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	out, err := runHistory(t, "list", "-r", reportsDir, "-n", "2")
+	if err != nil {
+		t.Fatalf("history list failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 executions, got:\n%s", out)
+	}
+	if !strings.HasPrefix(lines[0], "ID") || !strings.HasPrefix(lines[1], "exec-5") || !strings.HasPrefix(lines[2], "exec-4") {
+		t.Errorf("Expected exec-5 and exec-4 newest first, got:\n%s", out)
+	}
+	if !strings.Contains(lines[1], "abcdef5") || strings.Contains(lines[1], "abcdef5123456") {
+		t.Errorf("Expected the short commit, got %q", lines[1])
+	}
+
+	out, err = runHistory(t, "list", "-r", reportsDir, "-o", "json", "--env", "ci")
+	if err != nil {
+		t.Fatalf("history list -o json failed: %v", err)
+	}
+	var executions []storage.ExecutionRecord
+	if err := json.Unmarshal([]byte(out), &executions); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if len(executions) != 6 || executions[0].ID != "exec-5" || executions[0].Project != "shop" {
+		t.Errorf("Expected 6 executions of shop newest first, got %+v", executions)
+	}
+
+	out, err = runHistory(t, "list", "-r", reportsDir, "-o", "json", "--env", "staging")
+	if err != nil {
+		t.Fatalf("history list --env staging failed: %v", err)
+	}
+	if strings.TrimSpace(out) != "null" {
+		t.Errorf("Expected no executions in staging, got:\n%s", out)
+	}
+
+	db, err := storage.NewDatabase(reportsDir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	smoke := &storage.ExecutionRecord{
+		ID: "smoke-0", Timestamp: time.Now().Truncate(time.Second), Project: "shop", Environment: "ci", TagFilter: "smoke",
+	}
+	if err := db.SaveExecution(smoke); err != nil {
+		t.Fatalf("Failed to save execution: %v", err)
+	}
+	_ = db.Close()
+	out, err = runHistory(t, "list", "-r", reportsDir, "-o", "json", "--tag-filter", "smoke")
+	if err != nil {
+		t.Fatalf("history list --tag-filter smoke failed: %v", err)
+	}
+	executions = nil
+	if err := json.Unmarshal([]byte(out), &executions); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if len(executions) != 1 || executions[0].ID != "smoke-0" {
+		t.Errorf("Expected only the smoke run, got %+v", executions)
+	}
+
+	if _, err := runHistory(t, "list", "-r", reportsDir, "-o", "yaml"); err == nil || !strings.Contains(err.Error(), `unknown output format "yaml"`) {
+		t.Errorf("Expected an unknown output format error, got %v", err)
+	}
+	if _, err := runHistory(t, "list", "extra", "-r", reportsDir); err == nil {
+		t.Error("Expected list to reject arguments")
+	}
+}
+
+func TestHistoryShow(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	out, err := runHistory(t, "show", "exec-4", "-r", reportsDir)
+	if err != nil {
+		t.Fatalf("history show failed: %v", err)
+	}
+	for _, want := range []string{"Execution exec-4", "shop (ci)", "#104", "1 passed, 2 failed", "Pay by card", "timed out"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "after 30s") {
+		t.Errorf("Expected only the first line of the error, got:\n%s", out)
+	}
+
+	out, err = runHistory(t, "show", "exec-4", "-r", reportsDir, "-o", "json")
+	if err != nil {
+		t.Fatalf("history show -o json failed: %v", err)
+	}
+	var shown struct {
+		Execution *storage.ExecutionRecord `json:"execution"`
+		Scenarios []storage.ScenarioRecord `json:"scenarios"`
+	}
+	if err := json.Unmarshal([]byte(out), &shown); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if shown.Execution == nil || shown.Execution.ID != "exec-4" || len(shown.Scenarios) != 3 {
+		t.Errorf("Expected exec-4 with 3 scenarios, got %+v", shown)
+	}
+
+	if _, err := runHistory(t, "show", "exec-9", "-r", reportsDir); err == nil || err.Error() != "execution exec-9 not found" {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if _, err := runHistory(t, "show", "-r", reportsDir); err == nil {
+		t.Error("Expected show to require an execution ID")
+	}
+}
+
+func TestHistoryScenario(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	out, err := runHistory(t, "scenario", "Refund", "-r", reportsDir, "-n", "3")
+	if err != nil {
+		t.Fatalf("history scenario failed: %v", err)
+	}
+	if !strings.Contains(out, "Checkout › Refund") || !strings.Contains(out, "Failing since") ||
+		!strings.Contains(out, "(build #104)") || !strings.Contains(out, "2 run(s) in a row") {
+		t.Errorf("Expected Refund failing since build 104, got:\n%s", out)
+	}
+
+	out, err = runHistory(t, "scenario", "Pay", "-r", reportsDir, "-o", "json", "-n", "2")
+	if err != nil {
+		t.Fatalf("history scenario -o json failed: %v", err)
+	}
+	var summaries []scenarioSummary
+	if err := json.Unmarshal([]byte(out), &summaries); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if len(summaries) != 1 || summaries[0].ScenarioName != "Pay by card" {
+		t.Fatalf("Expected Pay by card, got %+v", summaries)
+	}
+	if summaries[0].Status != "passed" || summaries[0].StreakLength != 1 || len(summaries[0].Runs) != 2 {
+		t.Errorf("Expected a one-run passing streak and 2 runs, got %+v", summaries[0])
+	}
+
+	if _, err := runHistory(t, "scenario", "Missing", "-r", reportsDir); err == nil || !strings.Contains(err.Error(), `no runs of a scenario matching "Missing"`) {
+		t.Errorf("Expected a no runs error, got %v", err)
+	}
+}
+
+func TestHistoryFlaky(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	out, err := runHistory(t, "flaky", "-r", reportsDir, "-o", "json", "--project", "shop")
+	if err != nil {
+		t.Fatalf("history flaky -o json failed: %v", err)
+	}
+	var unstable map[string][]struct {
+		ScenarioName string `json:"scenarioName"`
+	}
+	if err := json.Unmarshal([]byte(out), &unstable); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if len(unstable["flaky"]) != 1 || unstable["flaky"][0].ScenarioName != "Pay by card" {
+		t.Errorf("Expected Pay by card to be flaky, got %+v", unstable["flaky"])
+	}
+	if len(unstable["broken"]) != 1 || unstable["broken"][0].ScenarioName != "Refund" {
+		t.Errorf("Expected Refund to be broken, got %+v", unstable["broken"])
+	}
+
+	out, err = runHistory(t, "flaky", "-r", reportsDir)
+	if err != nil {
+		t.Fatalf("history flaky failed: %v", err)
+	}
+	if !strings.Contains(out, "SCORE") || !strings.Contains(out, "BROKEN SINCE") {
+		t.Errorf("Expected flaky and broken tables, got:\n%s", out)
+	}
+}
+
+func TestHistoryQuarantine(t *testing.T) {
+	reportsDir := seedHistory(t)
+	file := filepath.Join(t.TempDir(), "quarantine.yaml")
+
+	if _, err := runHistory(t, "quarantine", "-r", reportsDir, "--file", file, "-o", "specs"); err == nil ||
+		err.Error() != `unknown output format "specs" (use table, json or patch)` {
+		t.Errorf("Expected an unknown output format error, got %v", err)
+	}
+
+	out, err := runHistory(t, "quarantine", "-r", reportsDir, "--file", file, "-o", "patch", "--owner", "qa")
+	if err != nil {
+		t.Fatalf("history quarantine -o patch failed: %v", err)
+	}
+	if !strings.Contains(out, "+") || !strings.Contains(out, "Pay by card") || !strings.Contains(out, "qa") {
+		t.Errorf("Expected a diff adding Pay by card, got:\n%s", out)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected the quarantine file to be left alone without --write, got %v", err)
+	}
+
+	out, err = runHistory(t, "quarantine", "-r", reportsDir, "--file", file, "--write")
+	if err != nil {
+		t.Fatalf("history quarantine --write failed: %v", err)
+	}
+	if !strings.Contains(out, "quarantine") || !strings.Contains(out, "Updated "+file+": 1 added, 0 released") {
+		t.Errorf("Expected the suggestion table and a summary, got:\n%s", out)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Expected the quarantine file to be written: %v", err)
+	}
+	if !strings.Contains(string(data), "Pay by card") {
+		t.Errorf("Expected Pay by card in the quarantine file, got:\n%s", data)
+	}
+
+	out, err = runHistory(t, "quarantine", "-r", reportsDir, "--file", file)
+	if err != nil {
+		t.Fatalf("history quarantine failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "No quarantine changes suggested") {
+		t.Errorf("Expected no further suggestions, got:\n%s", out)
+	}
+}
+
+func TestHistoryStreams(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	if _, err := runHistory(t, "streams", "-r", reportsDir, "-n", "0"); err == nil || err.Error() != "--streams must be at least 1" {
+		t.Errorf("Expected a streams error, got %v", err)
+	}
+	if _, err := runHistory(t, "streams", "-r", reportsDir, "-o", "patch"); err == nil ||
+		err.Error() != `unknown output format "patch" (use table, json, specs or tags)` {
+		t.Errorf("Expected an unknown output format error, got %v", err)
+	}
+
+	out, err := runHistory(t, "streams", "-r", reportsDir, "-n", "2", "-o", "specs")
+	if err != nil {
+		t.Fatalf("history streams -o specs failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || lines[0] != "specs/checkout.spec" {
+		t.Errorf("Expected checkout alone on the first stream, got:\n%s", out)
+	}
+
+	out, err = runHistory(t, "streams", "-r", reportsDir, "-n", "2")
+	if err != nil {
+		t.Fatalf("history streams failed: %v", err)
+	}
+	if !strings.Contains(out, "STREAM") || !strings.Contains(out, "Expected wall-clock: 3.0s (lower bound 3.0s, serial 6.0s)") {
+		t.Errorf("Expected the stream table and a 3s wall-clock over 6s of specs, got:\n%s", out)
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	reportsDir := seedHistory(t)
+
+	if _, err := runHistory(t, "prune", "-r", reportsDir); err == nil || !strings.HasPrefix(err.Error(), "no retention policy") {
+		t.Errorf("Expected a no retention policy error, got %v", err)
+	}
+
+	out, err := runHistory(t, "prune", "-r", reportsDir, "--max-runs", "4", "--dry-run")
+	if err != nil {
+		t.Fatalf("history prune --dry-run failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "Would prune 2 executions (6 scenario records") {
+		t.Errorf("Expected a dry run of 2 executions, got:\n%s", out)
+	}
+
+	out, err = runHistory(t, "prune", "-r", reportsDir, "--max-runs", "4", "-o", "json")
+	if err != nil {
+		t.Fatalf("history prune failed: %v", err)
+	}
+	var result storage.PruneResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if result.DryRun || result.Executions != 2 {
+		t.Errorf("Expected 2 executions pruned, got %+v", result)
+	}
+
+	out, err = runHistory(t, "list", "-r", reportsDir, "-o", "json")
+	if err != nil {
+		t.Fatalf("history list failed: %v", err)
+	}
+	var executions []storage.ExecutionRecord
+	if err := json.Unmarshal([]byte(out), &executions); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if len(executions) != 4 {
+		t.Errorf("Expected 4 executions left, got %d", len(executions))
+	}
+}
+
+func TestHistoryExportImport(t *testing.T) {
+	reportsDir := seedHistory(t)
+	archive := filepath.Join(t.TempDir(), "history.zip")
+
+	out, err := runHistory(t, "export", archive, "-r", reportsDir)
+	if err != nil {
+		t.Fatalf("history export failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "Exported 6 executions") {
+		t.Errorf("Expected 6 executions exported, got:\n%s", out)
+	}
+
+	target := t.TempDir()
+	out, err = runHistory(t, "import", archive, "-r", target)
+	if err != nil {
+		t.Fatalf("history import failed: %v", err)
+	}
+	if out != "Imported 6 executions (18 scenario records, 0 step records); skipped 0 already present\n" {
+		t.Errorf("Expected 6 executions imported, got:\n%s", out)
+	}
+
+	out, err = runHistory(t, "import", archive, "-r", target, "-o", "json")
+	if err != nil {
+		t.Fatalf("history import -o json failed: %v", err)
+	}
+	var result storage.ImportResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, out)
+	}
+	if result.SkippedExecutions != 6 {
+		t.Errorf("Expected all 6 executions skipped on the second import, got %+v", result)
+	}
+
+	if _, err := runHistory(t, "import", filepath.Join(target, "missing.zip"), "-r", target); err == nil ||
+		!strings.HasPrefix(err.Error(), "failed to open archive") {
+		t.Errorf("Expected an open error, got %v", err)
+	}
+}
+
+func TestParseSpecHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		heading string
+		tags    []string
+	}{
+		{
+			name:    "hash heading",
+			content: "# Checkout\n\nTags: payments, smoke\n\n## Pay by card\n\nTags: slow\n* Pay\n",
+			heading: "Checkout",
+			tags:    []string{"payments", "smoke"},
+		},
+		{
+			name:    "underlined heading",
+			content: "Checkout\r\n========\r\n\r\ntags: payments ,, smoke\r\n\r\nPay by card\r\n-----------\r\n\r\nTags: slow\r\n",
+			heading: "Checkout",
+			tags:    []string{"payments", "smoke"},
+		},
+		{
+			name:    "no tags",
+			content: "# Login\n\n## Log in\n* Open\n",
+			heading: "Login",
+		},
+		{
+			name:    "no heading",
+			content: "Tags: draft\n",
+			tags:    []string{"draft"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			heading, tags := parseSpecHeader(tt.content)
+			if heading != tt.heading {
+				t.Errorf("Expected heading %q, got %q", tt.heading, heading)
+			}
+			if fmt.Sprint(tags) != fmt.Sprint(tt.tags) {
+				t.Errorf("Expected tags %v, got %v", tt.tags, tags)
+			}
+		})
+	}
+}
+
+func TestScanSpecs(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"specs/checkout.spec":       "# Checkout\nTags: payments\n## Pay by card\n",
+		"specs/account/login.spec":  "Login\n=====\n## Log in\n",
+		"specs/account/README.md":   "# Not a spec\n",
+		"concepts/payment.cpt":      "# Pay\n",
+		"other/unrelated.spec":      "# Unrelated\n",
+		"specs/account/logout.spec": "# Logout\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write spec: %v", err)
+		}
+	}
+
+	specs, err := scanSpecs(root, "specs")
+	if err != nil {
+		t.Fatalf("scanSpecs failed: %v", err)
+	}
+	var got []string
+	for _, spec := range specs {
+		got = append(got, fmt.Sprintf("%s=%s%v", spec.SpecFile, spec.SpecName, spec.Tags))
+	}
+	want := "[specs/account/login.spec=Login[] specs/account/logout.spec=Logout[] specs/checkout.spec=Checkout[payments]]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+
+	// An absolute directory is still reported relative to the project root
+	specs, err = scanSpecs(root, filepath.Join(root, "specs", "account"))
+	if err != nil {
+		t.Fatalf("scanSpecs failed: %v", err)
+	}
+	if len(specs) != 2 || specs[0].SpecFile != "specs/account/login.spec" {
+		t.Errorf("Expected the two account specs relative to the root, got %+v", specs)
+	}
+
+	if _, err := scanSpecs(root, "missing"); err == nil || !strings.HasPrefix(err.Error(), "failed to scan specs") {
+		t.Errorf("Expected a scan error, got %v", err)
+	}
+}
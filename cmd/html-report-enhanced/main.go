@@ -113,7 +113,7 @@ Visit https://github.com/lirany1/gauge-html-report-ai for more information.`,
 
 	// Build command tree
 	themeCmd.AddCommand(createThemeCmd, listThemesCmd)
-	rootCmd.AddCommand(generateCmd, serverCmd, themeCmd, pluginCmd)
+	rootCmd.AddCommand(generateCmd, serverCmd, themeCmd, pluginCmd, newHistoryCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		logger.Error(err)
@@ -1,19 +1,29 @@
 package ai
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"regexp"
+	"path"
 	"strings"
+	"sync"
 
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
 	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/stacktrace"
 )
 
 // Analyzer provides intelligent analysis of test results
 type Analyzer struct {
-	llmClient *LLMClient
-	useRealAI bool
+	llmClient          *LLMClient
+	useRealAI          bool
+	classifier         *classify.Classifier
+	clusterThreshold   float64
+	embeddingThreshold float64
+	embeddings         EmbeddingCache
+	outagePolicy       OutagePolicy
 }
 
 // NewAnalyzer creates a new AI analyzer
@@ -23,40 +33,79 @@ func NewAnalyzer() *Analyzer {
 	llmClient := NewLLMClient(llmConfig)
 
 	return &Analyzer{
-		llmClient: llmClient,
-		useRealAI: llmClient != nil,
+		llmClient:          llmClient,
+		useRealAI:          llmClient != nil,
+		classifier:         classify.Default(),
+		clusterThreshold:   defaultClusterThreshold,
+		embeddingThreshold: defaultEmbeddingThreshold,
+		outagePolicy:       DefaultOutagePolicy(),
 	}
 }
 
-// ErrorType represents different categories of test failures
+// SetClassifier replaces the built-in error classification rules
+func (a *Analyzer) SetClassifier(classifier *classify.Classifier) {
+	a.classifier = classifier
+}
+
+// SetClusterThreshold sets the similarity, from 0 to 1, from which failure
+// groups are merged; above 1 only identical signatures are grouped
+func (a *Analyzer) SetClusterThreshold(threshold float64) {
+	a.clusterThreshold = threshold
+}
+
+// SetEmbeddingThreshold sets the cosine similarity of message embeddings,
+// from 0 to 1, from which failure groups are merged when the local provider
+// supplies embeddings
+func (a *Analyzer) SetEmbeddingThreshold(threshold float64) {
+	a.embeddingThreshold = threshold
+}
+
+// SetEmbeddingCache keeps failure embeddings across runs, so each failure
+// signature is sent to the embeddings endpoint once
+func (a *Analyzer) SetEmbeddingCache(cache EmbeddingCache) {
+	a.embeddings = cache
+}
+
+// ErrorType represents different categories of test failures; projects can
+// add their own through the error rules file
 type ErrorType string
 
 const (
-	ErrorTypeAssertion   ErrorType = "Assertion Failure"
-	ErrorTypeTimeout     ErrorType = "Timeout"
-	ErrorTypeNetwork     ErrorType = "Network Error"
-	ErrorTypeNullPointer ErrorType = "Null Pointer"
-	ErrorTypeFileSystem  ErrorType = "File System"
-	ErrorTypeDatabase    ErrorType = "Database"
-	ErrorTypeEnvironment ErrorType = "Environment"
-	ErrorTypeUnknown     ErrorType = "Unknown Error"
+	ErrorTypeAssertion   ErrorType = classify.Assertion
+	ErrorTypeTimeout     ErrorType = classify.Timeout
+	ErrorTypeNetwork     ErrorType = classify.Network
+	ErrorTypeNullPointer ErrorType = classify.NullPointer
+	ErrorTypeNotFound    ErrorType = classify.NotFound
+	ErrorTypePermission  ErrorType = classify.Permission
+	ErrorTypeFileSystem  ErrorType = classify.FileSystem
+	ErrorTypeDatabase    ErrorType = classify.Database
+	ErrorTypeTypeError   ErrorType = classify.TypeError
+	ErrorTypeEnvironment ErrorType = classify.Environment
+	ErrorTypeUnknown     ErrorType = classify.Unknown
 )
 
 // FailureGroup represents a group of similar failures
 type FailureGroup struct {
 	Signature         string
 	ErrorType         ErrorType
+	Pattern           string // normalized error message
 	RootCause         string
 	Count             int
 	AffectedScenarios []string
 	AffectedSpecs     []string
 	Severity          string // "critical", "high", "medium", "low"
 	SuggestedFix      string
+	AISuggested       bool // SuggestedFix came from the LLM, not a built-in pattern
+	// Near-duplicate groups merged into this one, and the lowest similarity
+	// among them (1 when nothing was merged)
+	MergedSignatures []string
+	Confidence       float64
 	// Context for LLM analysis
 	ErrorMessage string
 	StackTrace   string
 	StepText     string
 	SpecName     string
+	UserFrame    *models.StackFrame // first stack frame in project code, if recognized
 }
 
 // ExecutiveSummary contains high-level insights
@@ -66,103 +115,28 @@ type ExecutiveSummary struct {
 	CriticalIssues []string
 	TrendIndicator string // "Improving", "Stable", "Declining"
 	Recommendation string
+	Outage         *Outage // nil unless the run failed because its environment was down
 }
 
 // ClassifyError determines the type of error based on message and stack trace
 func (a *Analyzer) ClassifyError(errorMsg, stackTrace string) ErrorType {
-	combined := strings.ToLower(errorMsg + " " + stackTrace)
-
-	// Assertion patterns
-	assertionPatterns := []string{
-		"assertion", "assert", "expected", "actual", "should be",
-		"must be", "equals", "not equal",
-	}
-	for _, pattern := range assertionPatterns {
-		if strings.Contains(combined, pattern) {
-			return ErrorTypeAssertion
-		}
-	}
-
-	// Timeout patterns
-	if strings.Contains(combined, "timeout") ||
-		strings.Contains(combined, "timed out") ||
-		strings.Contains(combined, "deadline exceeded") {
-		return ErrorTypeTimeout
-	}
-
-	// Network patterns
-	networkPatterns := []string{
-		"connection refused", "network", "socket", "http",
-		"connection reset", "connection closed", "dns",
-	}
-	for _, pattern := range networkPatterns {
-		if strings.Contains(combined, pattern) {
-			return ErrorTypeNetwork
-		}
-	}
-
-	// Null pointer patterns
-	if strings.Contains(combined, "null") ||
-		strings.Contains(combined, "nil") ||
-		strings.Contains(combined, "none") {
-		return ErrorTypeNullPointer
-	}
-
-	// File system patterns
-	filePatterns := []string{
-		"file not found", "no such file", "permission denied",
-		"directory", "path",
-	}
-	for _, pattern := range filePatterns {
-		if strings.Contains(combined, pattern) {
-			return ErrorTypeFileSystem
-		}
-	}
-
-	// Database patterns
-	dbPatterns := []string{
-		"database", "sql", "query", "transaction",
-		"duplicate key", "constraint",
-	}
-	for _, pattern := range dbPatterns {
-		if strings.Contains(combined, pattern) {
-			return ErrorTypeDatabase
-		}
-	}
-
-	// Environment patterns
-	envPatterns := []string{
-		"environment", "config", "configuration",
-		"property", "variable not set",
-	}
-	for _, pattern := range envPatterns {
-		if strings.Contains(combined, pattern) {
-			return ErrorTypeEnvironment
-		}
-	}
-
-	return ErrorTypeUnknown
+	return ErrorType(a.classifier.Classify(errorMsg, stackTrace))
 }
 
 // GenerateErrorSignature creates a unique signature for similar errors
 func (a *Analyzer) GenerateErrorSignature(errorMsg, errorType string) string {
-	// Remove dynamic parts (numbers, timestamps, IDs)
-	cleaned := errorMsg
-
-	// Remove numbers
-	re := regexp.MustCompile(`\d+`)
-	cleaned = re.ReplaceAllString(cleaned, "N")
-
-	// Remove file paths
-	re = regexp.MustCompile(`/[^\s]+`)
-	cleaned = re.ReplaceAllString(cleaned, "/PATH")
-
-	// Remove UUIDs
-	re = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
-	cleaned = re.ReplaceAllString(cleaned, "UUID")
+	return a.FailureSignature(errorMsg, errorType, nil)
+}
 
-	// Combine with error type
-	signature := fmt.Sprintf("%s:%s", errorType, cleaned)
+// FailureSignature creates a signature for similar failures from the
+// normalized error message and, when known, the first stack frame in project
+// code. The frame's line is left out so that edits elsewhere in the file keep
+// the signature.
+func (a *Analyzer) FailureSignature(errorMsg, errorType string, frame *models.StackFrame) string {
+	signature := fmt.Sprintf("%s:%s", errorType, NormalizeMessage(errorMsg))
+	if frame != nil {
+		signature += fmt.Sprintf("@%s:%s", frame.Function, path.Base(strings.ReplaceAll(frame.File, `\`, "/")))
+	}
 
 	// Generate hash
 	hash := md5.Sum([]byte(signature))
@@ -175,17 +149,23 @@ func (a *Analyzer) GroupFailures(suite *models.EnhancedSuiteResult) []*FailureGr
 
 	for _, spec := range suite.SpecResults {
 		for _, scenario := range spec.Scenarios {
-			if !scenario.Failed {
+			// Quarantined failures are reported on their own
+			if !scenario.Failed || scenario.Quarantine != nil {
 				continue
 			}
 
 			// Get first failed step
 			var errorMsg, stackTrace, stepText string
+			var frame *models.StackFrame
 			for _, step := range scenario.Steps {
 				if step.Failed {
 					errorMsg = step.ErrorMessage
 					stackTrace = step.StackTrace
 					stepText = step.StepText
+					frame = step.UserFrame
+					if frame == nil && stackTrace != "" {
+						frame = stacktrace.FirstUserFrame(stacktrace.Parse(stackTrace))
+					}
 					break
 				}
 			}
@@ -198,7 +178,7 @@ func (a *Analyzer) GroupFailures(suite *models.EnhancedSuiteResult) []*FailureGr
 			errorType := a.ClassifyError(errorMsg, stackTrace)
 
 			// Generate signature
-			signature := a.GenerateErrorSignature(errorMsg, string(errorType))
+			signature := a.FailureSignature(errorMsg, string(errorType), frame)
 
 			// Add to group or create new one
 			if group, exists := groups[signature]; exists {
@@ -211,32 +191,105 @@ func (a *Analyzer) GroupFailures(suite *models.EnhancedSuiteResult) []*FailureGr
 				groups[signature] = &FailureGroup{
 					Signature:         signature,
 					ErrorType:         errorType,
+					Pattern:           NormalizeMessage(errorMsg),
+					Confidence:        1,
 					RootCause:         a.extractRootCause(errorMsg),
 					Count:             1,
 					AffectedScenarios: []string{scenario.ScenarioHeading},
 					AffectedSpecs:     []string{spec.SpecHeading},
 					Severity:          a.calculateSeverity(errorType, 1),
-					SuggestedFix:      a.generateFixSuggestion(errorType, errorMsg, stackTrace, stepText, spec.SpecHeading),
+					SuggestedFix:      a.getPatternBasedSuggestion(errorType),
 					// Store context for potential LLM analysis
 					ErrorMessage: errorMsg,
 					StackTrace:   stackTrace,
 					StepText:     stepText,
 					SpecName:     spec.SpecHeading,
+					UserFrame:    frame,
 				}
 			}
 		}
 	}
 
-	// Convert map to slice and update severity based on count
+	// Merge near-duplicates, then update severity based on count
 	result := make([]*FailureGroup, 0, len(groups))
 	for _, group := range groups {
-		group.Severity = a.calculateSeverity(group.ErrorType, group.Count)
 		result = append(result, group)
 	}
+	ctx, cancel := a.llmClient.budget()
+	defer cancel()
+	result = a.clusterGroups(ctx, result)
+	for _, group := range result {
+		group.Severity = a.calculateSeverity(group.ErrorType, group.Count)
+	}
+
+	// Failures an environment outage explains are reported under its
+	// verdict; asking the LLM to fix each of them would only add noise
+	outage := a.DetectOutage(suite, result)
+	pending := make([]*FailureGroup, 0, len(result))
+	for _, group := range result {
+		if !outage.Explains(group) {
+			pending = append(pending, group)
+		}
+	}
+	a.suggestFixes(ctx, pending)
 
 	return result
 }
 
+// suggestFixes replaces the pattern-based suggestions of the groups with
+// LLM ones, requesting several at a time within the LLM limits. Groups not
+// answered before ctx is done keep their pattern-based suggestion.
+func (a *Analyzer) suggestFixes(ctx context.Context, groups []*FailureGroup) {
+	if !a.useRealAI || a.llmClient == nil || len(groups) == 0 {
+		return
+	}
+	limits := a.llmClient.limits
+
+	jobs := make(chan *FailureGroup)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	fallbacks := 0
+	for i := 0; i < limits.Concurrency && i < len(groups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				suggestion, err := a.llmClient.GenerateFixSuggestionContext(ctx, group.ErrorMessage, group.StackTrace, group.StepText, group.SpecName)
+				if err != nil || suggestion == "" {
+					logger.Debugf("Using pattern-based fix suggestion for %s: %v", group.Signature, err)
+					mu.Lock()
+					fallbacks++
+					mu.Unlock()
+					continue
+				}
+				group.SuggestedFix = suggestion
+				group.AISuggested = true
+			}
+		}()
+	}
+
+	queued := 0
+queue:
+	for _, group := range groups {
+		select {
+		case jobs <- group:
+			queued++
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	fallbacks += len(groups) - queued
+	switch {
+	case fallbacks > 0 && ctx.Err() != nil:
+		logger.Warnf("LLM deadline of %s reached; %d of %d failure group(s) use pattern-based fix suggestions", limits.Deadline, fallbacks, len(groups))
+	case fallbacks > 0:
+		logger.Warnf("%d of %d failure group(s) use pattern-based fix suggestions", fallbacks, len(groups))
+	}
+}
+
 // extractRootCause extracts the main error message
 func (a *Analyzer) extractRootCause(errorMsg string) string {
 	// Take first line or first 150 characters
@@ -272,23 +325,11 @@ func (a *Analyzer) calculateSeverity(errorType ErrorType, count int) string {
 	case ErrorTypeNullPointer:
 		return "high"
 	default:
-		return "medium"
-	}
-}
-
-// generateFixSuggestion provides actionable fix recommendations
-func (a *Analyzer) generateFixSuggestion(errorType ErrorType, errorMsg, stackTrace, stepText, specName string) string {
-	// Try LLM first if available
-	if a.useRealAI && a.llmClient != nil {
-		llmSuggestion, err := a.llmClient.GenerateFixSuggestion(errorMsg, stackTrace, stepText, specName)
-		if err == nil && llmSuggestion != "" {
-			return llmSuggestion // Return AI-generated suggestion
+		if category := a.classifier.Category(string(errorType)); category != nil && category.Severity != "" {
+			return category.Severity
 		}
-		// Log error but continue to fallback (could add logging here)
+		return "medium"
 	}
-
-	// Fallback to pattern-based suggestion
-	return a.getPatternBasedSuggestion(errorType)
 }
 
 // getPatternBasedSuggestion returns rule-based fix suggestions
@@ -308,7 +349,16 @@ func (a *Analyzer) getPatternBasedSuggestion(errorType ErrorType) string {
 		return "Check database connection, verify schema integrity, and ensure test data is properly set up."
 	case ErrorTypeEnvironment:
 		return "Review environment configuration, check required properties are set, and verify environment setup scripts."
+	case ErrorTypeNotFound:
+		return "Check that the page, element or resource exists and that its locator or URL is still current."
+	case ErrorTypePermission:
+		return "Verify the credentials and roles used by the test and check access rules for the resource."
+	case ErrorTypeTypeError:
+		return "Check the data types exchanged between steps and the application, and any recent API contract changes."
 	default:
+		if category := a.classifier.Category(string(errorType)); category != nil && category.Suggestion != "" {
+			return category.Suggestion
+		}
 		return "Review error logs and stack trace for more details. Consider adding more specific error handling."
 	}
 }
@@ -333,14 +383,28 @@ func (a *Analyzer) GenerateExecutiveSummary(suite *models.EnhancedSuiteResult, f
 		summary.HealthStatus = "Poor"
 	}
 
-	// Add key insights
+	// Add key insights; quarantined scenarios are neither failures nor part of the total
 	if suite.FailedScenariosCount == 0 {
 		summary.KeyInsights = append(summary.KeyInsights,
 			"✅ All tests passed successfully - no failures detected")
 	} else {
 		summary.KeyInsights = append(summary.KeyInsights,
 			fmt.Sprintf("⚠️ %d scenario(s) failed out of %d total",
-				suite.FailedScenariosCount, suite.TotalScenariosCount))
+				suite.FailedScenariosCount, suite.TotalScenariosCount-suite.QuarantinedScenariosCount))
+	}
+	if suite.QuarantinedFailuresCount > 0 {
+		summary.KeyInsights = append(summary.KeyInsights,
+			fmt.Sprintf("🔒 %d quarantined scenario(s) failed - not counted in the health status",
+				suite.QuarantinedFailuresCount))
+	}
+
+	// A failed environment explains the failures behind it
+	summary.Outage = a.DetectOutage(suite, failureGroups)
+	if summary.Outage != nil {
+		summary.KeyInsights = append(summary.KeyInsights,
+			fmt.Sprintf("🌐 Environment outage: %d failure(s) traced to %s", summary.Outage.Scenarios, summary.Outage.Trigger))
+		summary.CriticalIssues = append(summary.CriticalIssues,
+			"Environment outage: "+summary.Outage.Summary)
 	}
 
 	// Analyze failure distribution
@@ -365,6 +429,9 @@ func (a *Analyzer) GenerateExecutiveSummary(suite *models.EnhancedSuiteResult, f
 
 	// Identify critical issues
 	for _, group := range failureGroups {
+		if summary.Outage.Explains(group) {
+			continue
+		}
 		if group.Severity == "critical" || group.Severity == "high" {
 			summary.CriticalIssues = append(summary.CriticalIssues,
 				fmt.Sprintf("%s: %s (affects %d scenario(s))",
@@ -397,6 +464,10 @@ func (a *Analyzer) GenerateExecutiveSummary(suite *models.EnhancedSuiteResult, f
 
 // generateRecommendation creates actionable recommendations
 func (a *Analyzer) generateRecommendation(summary *ExecutiveSummary) string {
+	if summary.Outage != nil {
+		return "Restore the test environment and re-run before investigating individual failures; they most likely share this one cause."
+	}
+
 	if summary.HealthStatus == "Excellent" {
 		return "Continue maintaining high quality standards. Monitor for any new flaky tests."
 	}
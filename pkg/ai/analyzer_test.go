@@ -1,9 +1,17 @@
 package ai
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
 	"github.com/lirany1/gauge-html-report-ai/pkg/models"
 )
 
@@ -260,16 +268,534 @@ func TestAnalyzer_LLMIntegration(t *testing.T) {
 		t.Error("Expected useRealAI to be false without LLM configuration")
 	}
 
-	// generateFixSuggestion should fall back to pattern-based
-	suggestion := analyzer.generateFixSuggestion(
-		ErrorTypeAssertion,
-		"Expected 5 but got 1",
-		"at test.py:10",
-		"Verify count",
-		"Test Spec",
-	)
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{{
+			SpecHeading: "Test Spec",
+			Scenarios: []*models.ScenarioResult{{
+				ScenarioHeading: "Scenario 1",
+				Failed:          true,
+				Steps: []*models.StepResult{{
+					Failed:       true,
+					ErrorMessage: "Expected 5 but got 1",
+					StackTrace:   "at test.py:10",
+					StepText:     "Verify count",
+				}},
+			}},
+		}},
+	}
+	want := analyzer.getPatternBasedSuggestion(ErrorTypeAssertion)
+
+	// Without an LLM, groups get the pattern-based suggestion
+	groups := analyzer.GroupFailures(suite)
+	if len(groups) != 1 || groups[0].SuggestedFix != want || groups[0].AISuggested {
+		t.Fatalf("Expected one group with the pattern-based suggestion, got %+v", groups)
+	}
+
+	// An LLM that fails leaves the pattern-based suggestion in place
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "model not loaded", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	analyzer.llmClient = NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, APIURL: server.URL})
+	analyzer.useRealAI = true
+
+	groups = analyzer.GroupFailures(suite)
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected one LLM request, got %d", n)
+	}
+	if len(groups) != 1 || groups[0].SuggestedFix != want || groups[0].AISuggested {
+		t.Errorf("Expected the pattern-based suggestion after the LLM failed, got %+v", groups)
+	}
+}
+
+func TestAnalyzer_CustomCategory(t *testing.T) {
+	weight := 5.0
+	classifier, err := classify.New(&classify.File{
+		Categories: []*classify.Category{
+			{Name: "Payment Gateway", Severity: "critical", Suggestion: "Check the payment sandbox status page."},
+		},
+		Rules: []*classify.Rule{{Category: "Payment Gateway", Pattern: `stripe`, Weight: &weight}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build classifier: %v", err)
+	}
+	analyzer := NewAnalyzer()
+	analyzer.SetClassifier(classifier)
+
+	errorType := analyzer.ClassifyError("Stripe request timed out", "")
+	if errorType != "Payment Gateway" {
+		t.Fatalf("Expected Payment Gateway, got %v", errorType)
+	}
+	if severity := analyzer.calculateSeverity(errorType, 1); severity != "critical" {
+		t.Errorf("Expected the category's critical severity, got %s", severity)
+	}
+	if suggestion := analyzer.getPatternBasedSuggestion(errorType); !strings.Contains(suggestion, "payment sandbox") {
+		t.Errorf("Expected the category's suggestion, got %s", suggestion)
+	}
+}
+
+func TestAnalyzer_GroupFailures_UserFrame(t *testing.T) {
+	analyzer := NewAnalyzer()
+
+	failure := func(name, trace string) *models.ScenarioResult {
+		return &models.ScenarioResult{
+			ScenarioHeading: name,
+			Failed:          true,
+			Steps: []*models.StepResult{{
+				Failed:       true,
+				ErrorMessage: "Expected 5 but got 1",
+				StackTrace:   trace,
+			}},
+		}
+	}
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{{
+			SpecHeading: "Cart",
+			Scenarios: []*models.ScenarioResult{
+				// Same assertion in the same step implementation, at lines moved by an edit
+				failure("Scenario 1", "\tat org.junit.Assert.fail(Assert.java:89)\n\tat com.shop.CartSteps.verifyTotal(CartSteps.java:42)"),
+				failure("Scenario 2", "\tat org.junit.Assert.fail(Assert.java:89)\n\tat com.shop.CartSteps.verifyTotal(CartSteps.java:45)"),
+				// Same message from different code
+				failure("Scenario 3", "\tat org.junit.Assert.fail(Assert.java:89)\n\tat com.shop.OrderSteps.verifyCount(OrderSteps.java:10)"),
+			},
+		}},
+	}
+
+	groups := analyzer.GroupFailures(suite)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 failure groups, got %d", len(groups))
+	}
+	for _, group := range groups {
+		if group.UserFrame == nil {
+			t.Fatalf("Expected group %q to have a user frame", group.AffectedScenarios)
+		}
+		want := map[string]int{"com.shop.CartSteps.verifyTotal": 2, "com.shop.OrderSteps.verifyCount": 1}[group.UserFrame.Function]
+		if group.Count != want {
+			t.Errorf("Expected %d failures at %s, got %d", want, group.UserFrame.Function, group.Count)
+		}
+	}
+}
 
-	if suggestion == "" {
-		t.Error("Expected pattern-based suggestion even without LLM")
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Element '#submit-btn' not clickable at point (10, 20)", "Element <STR> not clickable at point (<N>, <N>)"},
+		{`Expected "Total: $12.99" but was "Total: $0.00"`, "Expected <STR> but was <STR>"},
+		{"Timed out after 30000ms waiting for /api/orders/42", "Timed out after <DURATION> waiting for <PATH>"},
+		{"Order 3f2b8c1e-9d4a-4b7e-8a1f-2c3d4e5f6a7b created at 2024-05-01T10:22:31Z", "Order <UUID> created at <DATE>"},
+		{"connect ECONNREFUSED 10.0.0.12:5432", "connect ECONNREFUSED <IP>"},
+		{"GET https://shop.example.com/cart?id=7 returned 500", "GET <URL> returned <N>"},
+		{"Segfault at 0x7ffd5c2e, commit 9f86d081884c", "Segfault at <HEX>, commit <HEX>"},
+		{"  Too   many\nretries  ", "Too many retries"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeMessage(tt.message); got != tt.expected {
+			t.Errorf("NormalizeMessage(%q): expected %q, got %q", tt.message, tt.expected, got)
+		}
+	}
+
+	// Failures that differ only in their variable parts share a signature
+	analyzer := NewAnalyzer()
+	a := analyzer.FailureSignature("Timed out after 30s waiting for #cart", string(ErrorTypeTimeout), nil)
+	b := analyzer.FailureSignature("Timed out after 45s waiting for #cart", string(ErrorTypeTimeout), nil)
+	if a != b {
+		t.Errorf("Expected one signature for messages differing in a duration, got %s and %s", a, b)
+	}
+}
+
+func TestAnalyzer_GroupFailures_Clustering(t *testing.T) {
+	failure := func(name, message string) *models.ScenarioResult {
+		return &models.ScenarioResult{
+			ScenarioHeading: name,
+			Failed:          true,
+			Steps:           []*models.StepResult{{Failed: true, ErrorMessage: message}},
+		}
+	}
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{
+			{
+				SpecHeading: "Checkout",
+				Scenarios: []*models.ScenarioResult{
+					failure("Pay by card", "Element '#submit-btn' not found in the payment form"),
+					failure("Pay by voucher", "Element '#submit-btn' not found in the payment form"),
+				},
+			},
+			{
+				SpecHeading: "Cart",
+				Scenarios: []*models.ScenarioResult{
+					// Same cause, worded a little differently: merged
+					failure("Add item", "Element '#add-btn' not found in the cart form"),
+					// Different cause and type: kept apart
+					failure("Remove item", "Expected 1 item but got 2"),
+				},
+			},
+		},
+	}
+
+	analyzer := NewAnalyzer()
+	groups := analyzer.GroupFailures(suite)
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups before clustering at a strict threshold, got %d", len(groups))
+	}
+
+	analyzer.SetClusterThreshold(0.6)
+	groups = analyzer.GroupFailures(suite)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 failure groups, got %d", len(groups))
+	}
+	var merged *FailureGroup
+	for _, group := range groups {
+		if group.ErrorType == ErrorTypeNotFound {
+			merged = group
+		}
+	}
+	if merged == nil {
+		t.Fatal("Expected a not-found group")
+	}
+	if merged.Count != 3 || len(merged.AffectedScenarios) != 3 || len(merged.AffectedSpecs) != 2 {
+		t.Errorf("Expected 3 failures in 2 specs, got %d in %v", merged.Count, merged.AffectedSpecs)
+	}
+	if len(merged.MergedSignatures) != 1 {
+		t.Errorf("Expected 1 merged signature, got %v", merged.MergedSignatures)
+	}
+	if merged.Confidence >= 1 || merged.Confidence < 0.6 {
+		t.Errorf("Expected a confidence between the threshold and 1, got %.2f", merged.Confidence)
+	}
+	if merged.Pattern != "Element <STR> not found in the payment form" {
+		t.Errorf("Expected the larger group's pattern, got %q", merged.Pattern)
+	}
+}
+
+// memoryEmbeddings is an in-memory EmbeddingCache
+type memoryEmbeddings map[string][]float64
+
+func (m memoryEmbeddings) GetFailureEmbeddings(model string, signatures []string) (map[string][]float64, error) {
+	vectors := make(map[string][]float64)
+	for _, signature := range signatures {
+		if vector, ok := m[model+"/"+signature]; ok {
+			vectors[signature] = vector
+		}
+	}
+	return vectors, nil
+}
+
+func (m memoryEmbeddings) SaveFailureEmbeddings(model string, vectors map[string][]float64) error {
+	for signature, vector := range vectors {
+		m[model+"/"+signature] = vector
+	}
+	return nil
+}
+
+func TestAnalyzer_GroupFailures_Embeddings(t *testing.T) {
+	failure := func(name, message string) *models.ScenarioResult {
+		return &models.ScenarioResult{
+			ScenarioHeading: name,
+			Failed:          true,
+			Steps:           []*models.StepResult{{Failed: true, ErrorMessage: message}},
+		}
+	}
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{{
+			SpecHeading: "Login",
+			Scenarios: []*models.ScenarioResult{
+				// Few words in common, same meaning
+				failure("Sign in", "Login page didn't load"),
+				failure("Sign in again", "Login page didn't load"),
+				failure("Remember me", "Element #login not found"),
+				failure("Checkout", "Cart total was wrong"),
+			},
+		}},
+	}
+
+	requests := 0
+	server := newEmbeddingServer(t, []string{"login", "cart"}, false, &requests)
+	analyzer := NewAnalyzer()
+	analyzer.llmClient = NewLLMClient(&LLMConfig{
+		Enabled:        true,
+		Provider:       ProviderLocal,
+		EmbeddingURL:   server.URL,
+		EmbeddingModel: "nomic-embed-text",
+	})
+	cache := memoryEmbeddings{}
+	analyzer.SetEmbeddingCache(cache)
+
+	groups := analyzer.GroupFailures(suite)
+	if len(groups) != 2 {
+		t.Fatalf("Expected the login failures to merge by meaning, got %d groups", len(groups))
+	}
+	if groups[0].Count != 3 || groups[0].RootCause != "Login page didn't load" || len(groups[0].MergedSignatures) != 1 {
+		t.Errorf("Expected 3 login failures in one group, got %+v", groups[0])
+	}
+	if requests != 1 || len(cache) != 3 {
+		t.Errorf("Expected one request embedding 3 signatures, got %d requests and %d cached", requests, len(cache))
+	}
+
+	// Cached vectors are reused on the next run
+	analyzer.GroupFailures(suite)
+	if requests != 1 {
+		t.Errorf("Expected cached vectors to be reused, got %d requests", requests)
+	}
+
+	// Without the server, clustering falls back to word overlap
+	server.Close()
+	fallback := NewAnalyzer()
+	fallback.llmClient = analyzer.llmClient
+	if groups := fallback.GroupFailures(suite); len(groups) != 3 {
+		t.Errorf("Expected word-overlap clustering without embeddings, got %d groups", len(groups))
+	}
+}
+
+func TestAnalyzer_DetectOutage(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	// newSuite runs 10 scenarios, two in each of specs A to E. Scenarios 0
+	// to down-1 fail with network or timeout errors and scenario 9 with an
+	// assertion. Spec n runs from start + n*spacing for spacing.
+	newSuite := func(down int, spacing time.Duration) *models.EnhancedSuiteResult {
+		suite := &models.EnhancedSuiteResult{}
+		messages := []string{"connect ECONNREFUSED 10.0.0.5:5432", "Read timed out after 30s", "Connection refused to host api.internal"}
+		for n := 0; n < 5; n++ {
+			spec := &models.SpecResult{SpecHeading: fmt.Sprintf("Spec %c", 'A'+n)}
+			failed := false
+			for i := 0; i < 2; i++ {
+				index := n*2 + i
+				scenario := &models.ScenarioResult{ScenarioHeading: fmt.Sprintf("Scenario %d", index)}
+				switch {
+				case index < down:
+					scenario.Failed = true
+					scenario.Steps = []*models.StepResult{{Failed: true, ErrorMessage: messages[index%len(messages)]}}
+				case index == 9:
+					scenario.Failed = true
+					scenario.Steps = []*models.StepResult{{Failed: true, ErrorMessage: "Expected 5 but got 1"}}
+				}
+				if scenario.Failed {
+					failed = true
+					suite.FailedScenariosCount++
+				} else {
+					suite.PassedScenariosCount++
+				}
+				spec.Scenarios = append(spec.Scenarios, scenario)
+			}
+			status := "passed"
+			if failed {
+				status = "failed"
+			}
+			suite.SpecResults = append(suite.SpecResults, spec)
+			suite.ExecutionSpans = append(suite.ExecutionSpans, &models.ExecutionSpan{
+				Stream: 1, SpecName: spec.SpecHeading, Status: status,
+				Start: start.Add(time.Duration(n) * spacing), End: start.Add(time.Duration(n+1) * spacing),
+			})
+		}
+		suite.TotalScenariosCount = suite.PassedScenariosCount + suite.FailedScenariosCount
+		return suite
+	}
+
+	analyzer := NewAnalyzer()
+
+	suite := newSuite(6, time.Minute)
+	groups := analyzer.GroupFailures(suite)
+	summary := analyzer.GenerateExecutiveSummary(suite, groups)
+	outage := summary.Outage
+	if outage == nil || outage.Trigger != OutageNetwork || outage.Scenarios != 6 {
+		t.Fatalf("Expected a network outage explaining 6 failures, got %+v", outage)
+	}
+	if len(outage.Groups) != len(groups)-1 {
+		t.Errorf("Expected every group but the assertion to be explained, got %d of %d", len(outage.Groups), len(groups))
+	}
+	if !strings.Contains(strings.Join(outage.Evidence, "\n"), "6 of 10 executed scenarios (60%)") ||
+		!strings.Contains(strings.Join(outage.Evidence, "\n"), "within 2m0s") {
+		t.Errorf("Expected the failure share and spread as evidence, got %v", outage.Evidence)
+	}
+	for _, issue := range summary.CriticalIssues {
+		if strings.HasPrefix(issue, string(ErrorTypeNetwork)) || strings.HasPrefix(issue, string(ErrorTypeTimeout)) {
+			t.Errorf("Expected the outage's groups to be left out of the critical issues, got %q", issue)
+		}
+	}
+	if !strings.HasPrefix(summary.CriticalIssues[0], "Environment outage") || !strings.Contains(summary.Recommendation, "Restore the test environment") {
+		t.Errorf("Expected one outage issue and recommendation, got %v / %s", summary.CriticalIssues, summary.Recommendation)
+	}
+
+	// Too few failures, or failures spread over a long run, are no outage
+	for name, suite := range map[string]*models.EnhancedSuiteResult{
+		"minority": newSuite(4, time.Minute),
+		"spread":   newSuite(6, 20*time.Minute),
+	} {
+		if outage := analyzer.DetectOutage(suite, analyzer.GroupFailures(suite)); outage != nil {
+			t.Errorf("%s: expected no outage, got %+v", name, outage)
+		}
+	}
+
+	// A failed before-suite hook explains every failure
+	suite = newSuite(2, time.Minute)
+	suite.BeforeSuiteFailure = &models.HookFailure{ErrorMessage: "Could not start browser: DevToolsActivePort file doesn't exist"}
+	groups = analyzer.GroupFailures(suite)
+	outage = analyzer.DetectOutage(suite, groups)
+	if outage == nil || outage.Trigger != OutageBeforeSuite || len(outage.Groups) != len(groups) || outage.Scenarios != 3 {
+		t.Fatalf("Expected a before-suite outage explaining all 3 failures, got %+v", outage)
+	}
+	if !strings.Contains(outage.Evidence[0], "Could not start browser") {
+		t.Errorf("Expected the hook error as evidence, got %v", outage.Evidence)
+	}
+}
+
+func TestAnalyzer_GroupFailures_OutageSkipsSuggestions(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"response": "Ask the LLM"})
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer()
+	analyzer.llmClient = NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, APIURL: server.URL})
+	analyzer.useRealAI = true
+
+	// Six scenarios fail against a database that is down, one with an assertion
+	var scenarios []*models.ScenarioResult
+	messages := []string{"connect ECONNREFUSED 10.0.0.5:5432", "Read timed out after 30s", "Connection refused to host api.internal"}
+	for i := 0; i < 7; i++ {
+		message := messages[i%len(messages)]
+		if i == 6 {
+			message = "Expected 5 but got 1"
+		}
+		scenarios = append(scenarios, &models.ScenarioResult{
+			ScenarioHeading: fmt.Sprintf("Scenario %d", i),
+			Failed:          true,
+			Steps:           []*models.StepResult{{Failed: true, ErrorMessage: message}},
+		})
+	}
+	suite := &models.EnhancedSuiteResult{
+		SpecResults:          []*models.SpecResult{{SpecHeading: "Shop", Scenarios: scenarios}},
+		FailedScenariosCount: 7,
+		PassedScenariosCount: 3,
+	}
+
+	groups := analyzer.GroupFailures(suite)
+	outage := analyzer.DetectOutage(suite, groups)
+	if outage == nil || len(outage.Groups) != len(groups)-1 {
+		t.Fatalf("Expected an outage explaining all but the assertion, got %+v", outage)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected one LLM request for the assertion only, got %d", n)
+	}
+	for _, group := range groups {
+		if explained := outage.Explains(group); group.AISuggested == explained {
+			t.Errorf("Expected an LLM suggestion only outside the outage for %q, got %q", group.RootCause, group.SuggestedFix)
+		}
+	}
+
+	// A failed before-suite hook explains everything: no LLM request at all
+	atomic.StoreInt32(&requests, 0)
+	suite.BeforeSuiteFailure = &models.HookFailure{ErrorMessage: "Could not start browser"}
+	analyzer.GroupFailures(suite)
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("Expected no LLM requests when the before-suite hook failed, got %d", n)
+	}
+}
+
+func TestAnalyzer_GroupFailures_ConcurrentSuggestions(t *testing.T) {
+	messages := []string{
+		"Login page didn't load",
+		"Cart total was wrong",
+		"Payment gateway refused the card",
+		"Element #search not found",
+		"Database connection refused",
+		"Invoice PDF missing",
+	}
+	var scenarios []*models.ScenarioResult
+	for i, message := range messages {
+		scenarios = append(scenarios, &models.ScenarioResult{
+			ScenarioHeading: fmt.Sprintf("Scenario %d", i),
+			Failed:          true,
+			Steps:           []*models.StepResult{{Failed: true, ErrorMessage: message}},
+		})
+	}
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{{SpecHeading: "Shop", Scenarios: scenarios}},
+	}
+
+	var inFlight, maxInFlight int32
+	delay := 50 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"response": "Ask the LLM"})
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer()
+	analyzer.llmClient = NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, APIURL: server.URL})
+	analyzer.useRealAI = true
+	analyzer.SetLLMLimits(LLMLimits{Concurrency: 3})
+
+	groups := analyzer.GroupFailures(suite)
+	if len(groups) != len(messages) {
+		t.Fatalf("Expected %d groups, got %d", len(messages), len(groups))
+	}
+	for _, group := range groups {
+		if group.SuggestedFix != "Ask the LLM" || !group.AISuggested {
+			t.Errorf("Expected an LLM suggestion for %q, got %q", group.RootCause, group.SuggestedFix)
+		}
+	}
+	if maxInFlight != 3 {
+		t.Errorf("Expected 3 suggestions requested at once, got %d", maxInFlight)
+	}
+
+	// Past the deadline, the remaining groups keep pattern-based suggestions
+	delay = 500 * time.Millisecond
+	analyzer.SetLLMLimits(LLMLimits{Concurrency: 2, Deadline: 100 * time.Millisecond})
+	start := time.Now()
+	groups = analyzer.GroupFailures(suite)
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected grouping to stop at the deadline, took %s", elapsed)
+	}
+	for _, group := range groups {
+		if want := analyzer.getPatternBasedSuggestion(group.ErrorType); group.SuggestedFix != want || group.AISuggested {
+			t.Errorf("Expected the pattern-based suggestion for %q, got %q", group.RootCause, group.SuggestedFix)
+		}
+	}
+}
+
+func TestAnalyzer_GroupFailures_EmbeddingDeadline(t *testing.T) {
+	// An embeddings endpoint that never answers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body) // the server notices the client leaving only once the body is read
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	analyzer := NewAnalyzer()
+	analyzer.llmClient = NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, EmbeddingURL: server.URL, EmbeddingModel: "nomic-embed-text"})
+	analyzer.SetLLMLimits(LLMLimits{Concurrency: 1, Deadline: 100 * time.Millisecond})
+
+	suite := &models.EnhancedSuiteResult{
+		SpecResults: []*models.SpecResult{{SpecHeading: "Shop", Scenarios: []*models.ScenarioResult{
+			{ScenarioHeading: "Login", Failed: true, Steps: []*models.StepResult{{Failed: true, ErrorMessage: "Login page didn't load"}}},
+			{ScenarioHeading: "Cart", Failed: true, Steps: []*models.StepResult{{Failed: true, ErrorMessage: "Cart total was wrong"}}},
+		}}},
+	}
+
+	start := time.Now()
+	groups := analyzer.GroupFailures(suite)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected embedding to stop at the LLM deadline, took %s", elapsed)
+	}
+	if len(groups) != 2 {
+		t.Errorf("Expected word-overlap clustering after the deadline, got %d groups", len(groups))
 	}
 }
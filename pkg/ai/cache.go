@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// ResponseCache stores LLM responses by a hash of the provider, model and
+// prompt, so recurring failures reuse earlier analysis. storage.Store
+// implements it.
+type ResponseCache interface {
+	// GetLLMResponse returns the stored response and when it was stored, or
+	// "" if there is none
+	GetLLMResponse(key string) (string, time.Time, error)
+	SaveLLMResponse(key, provider, model, response string) error
+}
+
+// SetCache makes the client reuse responses younger than ttl. With refresh
+// set, stored responses are ignored and replaced by fresh ones.
+func (c *LLMClient) SetCache(cache ResponseCache, ttl time.Duration, refresh bool) {
+	if c == nil {
+		return
+	}
+	c.cache = cache
+	c.cacheTTL = ttl
+	c.refresh = refresh
+}
+
+// SetResponseCache caches the LLM responses behind fix suggestions; it does
+// nothing without an LLM
+func (a *Analyzer) SetResponseCache(cache ResponseCache, ttl time.Duration, refresh bool) {
+	a.llmClient.SetCache(cache, ttl, refresh)
+}
+
+// complete answers a prompt from the cache when a fresh response is stored
+// under key, and otherwise asks the provider and stores the answer. key is
+// the prompt, or a form of it that leaves out what changes between runs.
+func (c *LLMClient) complete(ctx context.Context, prompt, key string, maxTokens int) (string, error) {
+	if c.cache == nil {
+		return c.call(ctx, prompt, maxTokens)
+	}
+
+	hash := c.cacheKey(key)
+	if !c.refresh {
+		response, storedAt, err := c.cache.GetLLMResponse(hash)
+		if err != nil {
+			logger.Warnf("Failed to read cached LLM response: %v", err)
+		} else if response != "" && time.Since(storedAt) < c.cacheTTL {
+			logger.Debugf("Reusing cached LLM response from %s", storedAt.Format(time.RFC3339))
+			return response, nil
+		}
+	}
+
+	response, err := c.call(ctx, prompt, maxTokens)
+	if err != nil {
+		return "", err
+	}
+	if err := c.cache.SaveLLMResponse(hash, string(c.config.Provider), c.config.Model, response); err != nil {
+		logger.Warnf("Failed to cache LLM response: %v", err)
+	}
+	return response, nil
+}
+
+// cacheKey hashes the provider, model and prompt key
+func (c *LLMClient) cacheKey(key string) string {
+	hash := sha256.Sum256([]byte(string(c.config.Provider) + "\x00" + c.config.Model + "\x00" + key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultClusterThreshold is the similarity from which failure groups of one
+// type are merged
+const defaultClusterThreshold = 0.8
+
+// frameWeight is the share of the similarity given to the first user frame
+// when both groups have one
+const frameWeight = 0.3
+
+// messageNormalizers replace the variable parts of error messages with
+// placeholders, in order: earlier patterns would otherwise be cut up by the
+// later, more general ones (a date by the number pattern, say)
+var messageNormalizers = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<UUID>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?)?\b`), "<DATE>"},
+	{regexp.MustCompile(`\b\d{1,2}/\d{1,2}/\d{2,4}\b`), "<DATE>"},
+	{regexp.MustCompile(`\b\d{1,2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?\b`), "<TIME>"},
+	{regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.\-]*://[^\s'"<>]+`), "<URL>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<IP>"},
+	{regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){3,7}[0-9a-f]{1,4}\b`), "<IP>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<HEX>"},
+	{regexp.MustCompile(`(?i)\b\d+(?:\.\d+)?\s?(?:ms|milliseconds?|s|secs?|seconds?|m|mins?|minutes?|h|hours?)\b`), "<DURATION>"},
+	{regexp.MustCompile(`"[^"\n]*"|` + "`[^`\n]*`"), "<STR>"},
+	{regexp.MustCompile(`(?:^|[\s(\[=:,])'[^'\n]*'`), " <STR>"},
+	{regexp.MustCompile(`(?:[A-Za-z]:\\|\\\\)[^\s:'"]+|/[^\s:'"]+`), "<PATH>"},
+}
+
+var (
+	// longHex matches hashes and addresses without a 0x prefix; only those
+	// with a digit are replaced, so words like "deadbeef" are kept
+	longHex = regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`)
+	number  = regexp.MustCompile(`\d+`)
+	spaces  = regexp.MustCompile(`\s+`)
+	tokenRe = regexp.MustCompile(`<[A-Z]+>|[\pL\pN_]+`)
+)
+
+// NormalizeMessage replaces the parts of an error message that change from
+// run to run (IDs, dates, times, URLs, IPs, hex values, durations, quoted
+// values, paths and numbers) with placeholders, so that failures with the
+// same cause read the same
+func NormalizeMessage(message string) string {
+	normalized := message
+	for _, n := range messageNormalizers {
+		normalized = n.re.ReplaceAllString(normalized, n.placeholder)
+	}
+	normalized = longHex.ReplaceAllStringFunc(normalized, func(s string) string {
+		if strings.ContainsAny(s, "0123456789") {
+			return "<HEX>"
+		}
+		return s
+	})
+	normalized = number.ReplaceAllString(normalized, "<N>")
+	return strings.TrimSpace(spaces.ReplaceAllString(normalized, " "))
+}
+
+// messageTokens returns the distinct lower-case words of a normalized message
+func messageTokens(normalized string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, token := range tokenRe.FindAllString(normalized, -1) {
+		tokens[strings.ToLower(token)] = true
+	}
+	return tokens
+}
+
+// jaccard returns the share of tokens two sets have in common
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// groupSimilarity scores how likely two failure groups share a cause, from
+// 0 to 1: token overlap of their normalized messages, and whether their first
+// user frames are in the same function when both are known
+func groupSimilarity(a, b *FailureGroup, tokensA, tokensB map[string]bool) float64 {
+	if a.ErrorType != b.ErrorType {
+		return 0
+	}
+	return withFrame(a, b, jaccard(tokensA, tokensB))
+}
+
+// withFrame blends a message similarity with whether the groups' first user
+// frames are in the same function, when both are known
+func withFrame(a, b *FailureGroup, similarity float64) float64 {
+	if a.UserFrame == nil || b.UserFrame == nil {
+		return similarity
+	}
+	frame := 0.0
+	if a.UserFrame.Function == b.UserFrame.Function {
+		frame = 1
+	}
+	return (1-frameWeight)*similarity + frameWeight*frame
+}
+
+// clusterGroups merges groups whose similarity to a larger group reaches the
+// threshold into that group. The larger group keeps its signature, root cause
+// and suggestion; its Confidence drops to the lowest similarity merged in.
+// With embeddings from the local provider, requested within ctx, messages are
+// compared by meaning rather than by words, and groups of different error
+// types may merge.
+func (a *Analyzer) clusterGroups(ctx context.Context, groups []*FailureGroup) []*FailureGroup {
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Signature < groups[j].Signature
+	})
+
+	tokens := make([]map[string]bool, len(groups))
+	for i, group := range groups {
+		tokens[i] = messageTokens(group.Pattern)
+	}
+
+	threshold := a.clusterThreshold
+	vectors := a.embedGroups(ctx, groups)
+	if vectors != nil {
+		threshold = a.embeddingThreshold
+	}
+	similarity := func(i, j int) float64 {
+		if vectors != nil {
+			return withFrame(groups[i], groups[j], cosine(vectors[i], vectors[j]))
+		}
+		return groupSimilarity(groups[i], groups[j], tokens[i], tokens[j])
+	}
+
+	clusters := make([]*FailureGroup, 0, len(groups))
+	heads := make([]int, 0, len(groups)) // index in groups of each cluster's first group
+	for i, group := range groups {
+		best, bestSimilarity := -1, 0.0
+		for c, head := range heads {
+			if s := similarity(head, i); s >= threshold && s > bestSimilarity {
+				best, bestSimilarity = c, s
+			}
+		}
+		if best < 0 {
+			clusters = append(clusters, group)
+			heads = append(heads, i)
+			continue
+		}
+
+		cluster := clusters[best]
+		cluster.Count += group.Count
+		cluster.AffectedScenarios = append(cluster.AffectedScenarios, group.AffectedScenarios...)
+		for _, spec := range group.AffectedSpecs {
+			if !contains(cluster.AffectedSpecs, spec) {
+				cluster.AffectedSpecs = append(cluster.AffectedSpecs, spec)
+			}
+		}
+		cluster.MergedSignatures = append(cluster.MergedSignatures, group.Signature)
+		cluster.MergedSignatures = append(cluster.MergedSignatures, group.MergedSignatures...)
+		cluster.Confidence = min(cluster.Confidence, bestSimilarity)
+	}
+	return clusters
+}
@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"math"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// defaultEmbeddingThreshold is the cosine similarity of message embeddings
+// from which failure groups are merged
+const defaultEmbeddingThreshold = 0.85
+
+// EmbeddingCache stores the embedding vectors of failure groups by
+// signature and model, so each failure is embedded once across runs.
+// storage.Store implements it.
+type EmbeddingCache interface {
+	GetFailureEmbeddings(model string, signatures []string) (map[string][]float64, error)
+	SaveFailureEmbeddings(model string, vectors map[string][]float64) error
+}
+
+// embedGroups returns the embedding vector of each group's root cause, from
+// the cache or the local embeddings endpoint. It returns nil, and clustering
+// falls back to word overlap, unless the local provider is configured and
+// every group could be embedded.
+func (a *Analyzer) embedGroups(ctx context.Context, groups []*FailureGroup) [][]float64 {
+	if a.llmClient == nil || a.llmClient.config.Provider != ProviderLocal || len(groups) < 2 {
+		return nil
+	}
+	model := a.llmClient.config.EmbeddingModel
+
+	signatures := make([]string, len(groups))
+	for i, group := range groups {
+		signatures[i] = group.Signature
+	}
+	cached := make(map[string][]float64)
+	if a.embeddings != nil {
+		stored, err := a.embeddings.GetFailureEmbeddings(model, signatures)
+		if err != nil {
+			logger.Warnf("Failed to read cached failure embeddings: %v", err)
+		} else {
+			cached = stored
+		}
+	}
+
+	var missing []int
+	var texts []string
+	for i, group := range groups {
+		if _, ok := cached[group.Signature]; !ok {
+			missing = append(missing, i)
+			texts = append(texts, group.RootCause)
+		}
+	}
+	if len(missing) > 0 {
+		vectors, err := a.llmClient.EmbedContext(ctx, texts)
+		if err != nil {
+			logger.Warnf("Clustering failures without embeddings: %v", err)
+			return nil
+		}
+		fresh := make(map[string][]float64, len(missing))
+		for j, i := range missing {
+			fresh[groups[i].Signature] = vectors[j]
+			cached[groups[i].Signature] = vectors[j]
+		}
+		if a.embeddings != nil {
+			if err := a.embeddings.SaveFailureEmbeddings(model, fresh); err != nil {
+				logger.Warnf("Failed to cache failure embeddings: %v", err)
+			}
+		}
+	}
+
+	vectors := make([][]float64, len(groups))
+	for i, group := range groups {
+		vectors[i] = cached[group.Signature]
+	}
+	return vectors
+}
+
+// cosine returns the cosine similarity of two vectors, 0 if either is empty
+// or their dimensions differ
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// maxBackoff caps the wait between retries of one request
+const maxBackoff = 30 * time.Second
+
+// LLMLimits bounds the provider calls made while analyzing a run
+type LLMLimits struct {
+	Concurrency       int           // fix suggestions requested at once
+	RequestsPerMinute int           // steady request rate; 0 for no limit
+	MaxRetries        int           // retries of a request rejected with 429 or 5xx
+	Deadline          time.Duration // time for all fix suggestions of a run; 0 for no limit
+}
+
+// DefaultLLMLimits requests four fix suggestions at once, at most 60 a
+// minute, retries each up to three times and gives them two minutes in all
+func DefaultLLMLimits() LLMLimits {
+	return LLMLimits{Concurrency: 4, RequestsPerMinute: 60, MaxRetries: 3, Deadline: 2 * time.Minute}
+}
+
+// SetLimits sets the concurrency, rate, retries and deadline of provider
+// calls
+func (c *LLMClient) SetLimits(limits LLMLimits) {
+	if c == nil {
+		return
+	}
+	if limits.Concurrency < 1 {
+		limits.Concurrency = 1
+	}
+	c.limits = limits
+	c.limiter = newTokenBucket(limits.RequestsPerMinute, limits.Concurrency)
+}
+
+// SetLLMLimits bounds the LLM calls behind fix suggestions; it does nothing
+// without an LLM
+func (a *Analyzer) SetLLMLimits(limits LLMLimits) {
+	a.llmClient.SetLimits(limits)
+}
+
+// budget returns the context bounding all LLM calls made while analyzing a
+// run: embeddings for clustering and fix suggestions share one deadline
+func (c *LLMClient) budget() (context.Context, context.CancelFunc) {
+	if c == nil || c.limits.Deadline <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.limits.Deadline)
+}
+
+// APIError is a response from a provider with a status other than 200
+type APIError struct {
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, 0 if absent
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the provider was rate limiting or failing and
+// the request may succeed later
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newAPIError reads a failed response into an APIError
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		apiErr.Body = fmt.Sprintf("(failed to read body: %v)", err)
+	} else {
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date; it returns 0 when the header is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// call sends a prompt to the configured provider within the rate limit,
+// retrying with exponential backoff while the provider answers 429 or 5xx.
+// A Retry-After header longer than the backoff is waited out instead.
+func (c *LLMClient) call(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return "", fmt.Errorf("waiting for rate limit: %w", err)
+		}
+
+		response, err := c.send(ctx, prompt, maxTokens)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt >= c.limits.MaxRetries {
+			return response, err
+		}
+
+		delay := c.backoff(attempt)
+		if apiErr.RetryAfter > delay {
+			delay = apiErr.RetryAfter
+		}
+		logger.Debugf("LLM provider answered %d, retrying in %s", apiErr.StatusCode, delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return "", fmt.Errorf("%w (gave up retrying: %v)", apiErr, err)
+		}
+	}
+}
+
+// backoff returns the wait before retry attempt+1: retryBase doubled per
+// attempt, up to maxBackoff
+func (c *LLMClient) backoff(attempt int) time.Duration {
+	delay := float64(c.retryBase) * math.Pow(2, float64(attempt))
+	if delay > float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// tokenBucket allows a steady rate of requests with bursts of up to its
+// capacity
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens added per second
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket refilled at perMinute tokens a
+// minute, or nil, which never blocks, when perMinute is not positive
+func newTokenBucket(perMinute, burst int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+// wait takes a token, blocking until one is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return ctx.Err()
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d, or returns early with ctx's error
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
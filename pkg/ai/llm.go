@@ -2,11 +2,13 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -29,12 +31,27 @@ type LLMConfig struct {
 	APIURL   string
 	Model    string
 	Timeout  time.Duration
+
+	// Embeddings endpoint and model of the local provider, used to cluster
+	// failures by meaning without sending them to a cloud provider
+	EmbeddingURL   string
+	EmbeddingModel string
 }
 
 // LLMClient handles communication with LLM providers
 type LLMClient struct {
 	config *LLMConfig
 	client *http.Client
+
+	// Responses are reused for cacheTTL unless refresh is set; see SetCache
+	cache    ResponseCache
+	cacheTTL time.Duration
+	refresh  bool
+
+	// Concurrency, rate and retries of provider calls; see SetLimits
+	limits    LLMLimits
+	limiter   *tokenBucket
+	retryBase time.Duration
 }
 
 // NewLLMClient creates a new LLM client
@@ -43,12 +60,15 @@ func NewLLMClient(config *LLMConfig) *LLMClient {
 		return nil
 	}
 
-	return &LLMClient{
+	client := &LLMClient{
 		config: config,
 		client: &http.Client{
 			Timeout: config.Timeout,
 		},
+		retryBase: time.Second,
 	}
+	client.SetLimits(DefaultLLMLimits())
+	return client
 }
 
 // GenerateExecutiveSummary uses LLM to generate executive summary
@@ -58,38 +78,39 @@ func (c *LLMClient) GenerateExecutiveSummary(testData map[string]interface{}) (s
 	}
 
 	prompt := c.buildExecutiveSummaryPrompt(testData)
-
-	switch c.config.Provider {
-	case ProviderOpenAI:
-		return c.callOpenAI(prompt, 300)
-	case ProviderClaude:
-		return c.callClaude(prompt, 300)
-	case ProviderGemini:
-		return c.callGemini(prompt, 300)
-	case ProviderLocal:
-		return c.callLocal(prompt, 300)
-	default:
-		return "", fmt.Errorf("unsupported provider: %s", c.config.Provider)
-	}
+	return c.complete(context.Background(), prompt, prompt, 300)
 }
 
 // GenerateFixSuggestion uses LLM to suggest fixes for failures
 func (c *LLMClient) GenerateFixSuggestion(errorMsg, stackTrace, stepText, specName string) (string, error) {
+	return c.GenerateFixSuggestionContext(context.Background(), errorMsg, stackTrace, stepText, specName)
+}
+
+// GenerateFixSuggestionContext is GenerateFixSuggestion with a context that
+// bounds the wait for the rate limiter, retries and the request itself
+func (c *LLMClient) GenerateFixSuggestionContext(ctx context.Context, errorMsg, stackTrace, stepText, specName string) (string, error) {
 	if c == nil {
 		return "", fmt.Errorf("LLM client not initialized")
 	}
 
 	prompt := c.buildFixSuggestionPrompt(errorMsg, stackTrace, stepText, specName)
 
+	// IDs, timestamps and line numbers differ between runs of one failure;
+	// leaving them out of the cache key lets recurring failures reuse the answer
+	return c.complete(ctx, prompt, NormalizeMessage(prompt), 500)
+}
+
+// send sends a prompt to the configured provider once
+func (c *LLMClient) send(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	switch c.config.Provider {
 	case ProviderOpenAI:
-		return c.callOpenAI(prompt, 500)
+		return c.callOpenAI(ctx, prompt, maxTokens)
 	case ProviderClaude:
-		return c.callClaude(prompt, 500)
+		return c.callClaude(ctx, prompt, maxTokens)
 	case ProviderGemini:
-		return c.callGemini(prompt, 500)
+		return c.callGemini(ctx, prompt, maxTokens)
 	case ProviderLocal:
-		return c.callLocal(prompt, 500)
+		return c.callLocal(ctx, prompt, maxTokens)
 	default:
 		return "", fmt.Errorf("unsupported provider: %s", c.config.Provider)
 	}
@@ -155,7 +176,7 @@ Analysis:`,
 }
 
 // callOpenAI makes API call to OpenAI
-func (c *LLMClient) callOpenAI(prompt string, maxTokens int) (string, error) {
+func (c *LLMClient) callOpenAI(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	requestBody := map[string]interface{}{
 		"model": c.config.Model,
 		"messages": []map[string]string{
@@ -177,7 +198,7 @@ func (c *LLMClient) callOpenAI(prompt string, maxTokens int) (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.APIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -194,11 +215,7 @@ func (c *LLMClient) callOpenAI(prompt string, maxTokens int) (string, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return "", fmt.Errorf("API returned status %d (failed to read body: %w)", resp.StatusCode, readErr)
-		}
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", newAPIError(resp)
 	}
 
 	var response struct {
@@ -221,7 +238,7 @@ func (c *LLMClient) callOpenAI(prompt string, maxTokens int) (string, error) {
 }
 
 // callClaude makes API call to Anthropic Claude
-func (c *LLMClient) callClaude(prompt string, maxTokens int) (string, error) {
+func (c *LLMClient) callClaude(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	requestBody := map[string]interface{}{
 		"model":      c.config.Model,
 		"max_tokens": maxTokens,
@@ -238,7 +255,7 @@ func (c *LLMClient) callClaude(prompt string, maxTokens int) (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.APIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -256,11 +273,7 @@ func (c *LLMClient) callClaude(prompt string, maxTokens int) (string, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return "", fmt.Errorf("API returned status %d (failed to read body: %w)", resp.StatusCode, readErr)
-		}
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", newAPIError(resp)
 	}
 
 	var response struct {
@@ -281,7 +294,7 @@ func (c *LLMClient) callClaude(prompt string, maxTokens int) (string, error) {
 }
 
 // callGemini makes API call to Google Gemini
-func (c *LLMClient) callGemini(prompt string, maxTokens int) (string, error) {
+func (c *LLMClient) callGemini(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	requestBody := map[string]interface{}{
 		"contents": []map[string]interface{}{
 			{
@@ -306,7 +319,7 @@ func (c *LLMClient) callGemini(prompt string, maxTokens int) (string, error) {
 	// Gemini uses API key in URL parameter and model in path
 	apiURL := fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.config.APIURL, c.config.Model, c.config.APIKey)
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -322,11 +335,7 @@ func (c *LLMClient) callGemini(prompt string, maxTokens int) (string, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return "", fmt.Errorf("API returned status %d (failed to read body: %w)", resp.StatusCode, readErr)
-		}
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", newAPIError(resp)
 	}
 
 	// Read and parse response
@@ -357,7 +366,7 @@ func (c *LLMClient) callGemini(prompt string, maxTokens int) (string, error) {
 }
 
 // callLocal makes API call to local LLM server (Ollama, LM Studio, etc.)
-func (c *LLMClient) callLocal(prompt string, maxTokens int) (string, error) {
+func (c *LLMClient) callLocal(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	requestBody := map[string]interface{}{
 		"model":  c.config.Model,
 		"prompt": prompt,
@@ -373,7 +382,7 @@ func (c *LLMClient) callLocal(prompt string, maxTokens int) (string, error) {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.APIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -389,11 +398,7 @@ func (c *LLMClient) callLocal(prompt string, maxTokens int) (string, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		body, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return "", fmt.Errorf("API returned status %d (failed to read body: %w)", resp.StatusCode, readErr)
-		}
-		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return "", newAPIError(resp)
 	}
 
 	var response struct {
@@ -411,6 +416,79 @@ func (c *LLMClient) callLocal(prompt string, maxTokens int) (string, error) {
 	return response.Response, nil
 }
 
+// Embed returns one embedding vector per text from the local server's
+// embeddings endpoint. Both the Ollama response ({"embeddings": [...]}) and
+// the OpenAI-compatible one served by LM Studio and llama.cpp ({"data":
+// [{"embedding": [...]}]}) are understood.
+func (c *LLMClient) Embed(texts []string) ([][]float64, error) {
+	return c.EmbedContext(context.Background(), texts)
+}
+
+// EmbedContext is Embed with a context that bounds the request
+func (c *LLMClient) EmbedContext(ctx context.Context, texts []string) ([][]float64, error) {
+	if c == nil {
+		return nil, fmt.Errorf("LLM client not initialized")
+	}
+	if c.config.Provider != ProviderLocal {
+		return nil, fmt.Errorf("embeddings are only supported by the local provider, not %s", c.config.Provider)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	requestBody := map[string]interface{}{
+		"model": c.config.EmbeddingModel,
+		"input": texts,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.EmbeddingURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore close errors in defer
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var response struct {
+		Embeddings [][]float64 `json:"embeddings"`
+		Data       []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	vectors := response.Embeddings
+	if len(vectors) == 0 {
+		for _, item := range response.Data {
+			vectors = append(vectors, item.Embedding)
+		}
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings from local LLM, got %d", len(texts), len(vectors))
+	}
+
+	return vectors, nil
+}
+
 // LoadLLMConfigFromEnv loads LLM configuration from environment variables
 func LoadLLMConfigFromEnv() *LLMConfig {
 	// Check if LLM is enabled
@@ -448,11 +526,22 @@ func LoadLLMConfigFromEnv() *LLMConfig {
 	case ProviderLocal:
 		config.APIURL = getEnvOrDefault("GAUGE_AI_API_URL", "http://localhost:11434/api/generate")
 		config.Model = getEnvOrDefault("GAUGE_AI_MODEL", "llama2")
+		config.EmbeddingURL = getEnvOrDefault("GAUGE_AI_EMBEDDING_URL", embeddingURL(config.APIURL))
+		config.EmbeddingModel = getEnvOrDefault("GAUGE_AI_EMBEDDING_MODEL", "nomic-embed-text")
 	}
 
 	return config
 }
 
+// embeddingURL derives the embeddings endpoint from an Ollama generate URL;
+// other servers need GAUGE_AI_EMBEDDING_URL
+func embeddingURL(generateURL string) string {
+	if base, ok := strings.CutSuffix(generateURL, "/api/generate"); ok {
+		return base + "/api/embed"
+	}
+	return "http://localhost:11434/api/embed"
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
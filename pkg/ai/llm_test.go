@@ -1,9 +1,15 @@
 package ai
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadLLMConfigFromEnv(t *testing.T) {
@@ -106,6 +112,9 @@ func TestLoadLLMConfigFromEnv(t *testing.T) {
 		if config.APIURL != "http://localhost:11434/api/generate" {
 			t.Errorf("Expected Ollama URL, got %s", config.APIURL)
 		}
+		if config.EmbeddingURL != "http://localhost:11434/api/embed" || config.EmbeddingModel != "nomic-embed-text" {
+			t.Errorf("Expected the Ollama embeddings endpoint, got %s with %s", config.EmbeddingURL, config.EmbeddingModel)
+		}
 	})
 
 	t.Run("Invalid provider is kept as-is", func(t *testing.T) {
@@ -248,3 +257,243 @@ func TestBuildPrompts(t *testing.T) {
 		}
 	})
 }
+
+// newEmbeddingServer starts a stub embeddings endpoint that answers in the
+// Ollama format, or the OpenAI-compatible one if openAI is set. Each text is
+// embedded by the words it contains from dims.
+func newEmbeddingServer(t *testing.T, dims []string, openAI bool, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		var request struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "nomic-embed-text" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		vectors := make([][]float64, len(request.Input))
+		for i, text := range request.Input {
+			vectors[i] = make([]float64, len(dims))
+			for d, word := range dims {
+				if strings.Contains(strings.ToLower(text), word) {
+					vectors[i][d] = 1
+				}
+			}
+		}
+
+		var response interface{} = map[string]interface{}{"embeddings": vectors}
+		if openAI {
+			data := make([]map[string]interface{}, len(vectors))
+			for i, vector := range vectors {
+				data[i] = map[string]interface{}{"embedding": vector}
+			}
+			response = map[string]interface{}{"data": data}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLLMClient_Embed(t *testing.T) {
+	for _, openAI := range []bool{false, true} {
+		requests := 0
+		server := newEmbeddingServer(t, []string{"login", "cart"}, openAI, &requests)
+		client := NewLLMClient(&LLMConfig{
+			Enabled:        true,
+			Provider:       ProviderLocal,
+			EmbeddingURL:   server.URL,
+			EmbeddingModel: "nomic-embed-text",
+		})
+
+		vectors, err := client.Embed([]string{"Login page did not load", "Cart is empty"})
+		if err != nil {
+			t.Fatalf("Failed to embed: %v", err)
+		}
+		if len(vectors) != 2 || vectors[0][0] != 1 || vectors[0][1] != 0 || vectors[1][1] != 1 {
+			t.Errorf("Unexpected vectors (OpenAI format %v): %v", openAI, vectors)
+		}
+	}
+
+	client := NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, EmbeddingURL: "http://127.0.0.1:1", EmbeddingModel: "nomic-embed-text"})
+	if _, err := client.Embed([]string{"x"}); err == nil {
+		t.Error("Expected an error when the server is unreachable")
+	}
+
+	cloud := NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderOpenAI})
+	if _, err := cloud.Embed([]string{"x"}); err == nil || !strings.Contains(err.Error(), "local provider") {
+		t.Errorf("Expected embeddings to be refused for cloud providers, got %v", err)
+	}
+}
+
+// memoryResponses is an in-memory ResponseCache
+type memoryResponses map[string]struct {
+	response string
+	storedAt time.Time
+}
+
+func (m memoryResponses) GetLLMResponse(key string) (string, time.Time, error) {
+	entry := m[key]
+	return entry.response, entry.storedAt, nil
+}
+
+func (m memoryResponses) SaveLLMResponse(key, provider, model, response string) error {
+	m[key] = struct {
+		response string
+		storedAt time.Time
+	}{response, time.Now()}
+	return nil
+}
+
+func TestLLMClient_Cache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_ = json.NewEncoder(w).Encode(map[string]string{"response": "Wait for the payment form"})
+	}))
+	defer server.Close()
+
+	newClient := func(model string, refresh bool, cache memoryResponses) *LLMClient {
+		client := NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, APIURL: server.URL, Model: model})
+		client.SetCache(cache, 24*time.Hour, refresh)
+		return client
+	}
+	suggest := func(client *LLMClient, orderID string) {
+		t.Helper()
+		suggestion, err := client.GenerateFixSuggestion("Order "+orderID+" timed out after 30s", "", "Pay", "Checkout")
+		if err != nil || suggestion != "Wait for the payment form" {
+			t.Fatalf("Expected the suggestion, got %q (%v)", suggestion, err)
+		}
+	}
+
+	cache := memoryResponses{}
+	client := newClient("llama2", false, cache)
+	suggest(client, "1041")
+	// The same failure in a later run, with another order ID
+	suggest(client, "2297")
+	if requests != 1 || len(cache) != 1 {
+		t.Fatalf("Expected the recurring failure to be answered from the cache, got %d requests", requests)
+	}
+
+	// Another model does not reuse the answer
+	suggest(newClient("mistral", false, cache), "1041")
+	if requests != 2 {
+		t.Errorf("Expected a request for another model, got %d", requests)
+	}
+
+	// Forcing a refresh asks again
+	suggest(newClient("llama2", true, cache), "1041")
+	if requests != 3 {
+		t.Errorf("Expected a refresh to bypass the cache, got %d requests", requests)
+	}
+
+	// Responses older than the TTL are asked again
+	for key, entry := range cache {
+		entry.storedAt = time.Now().Add(-48 * time.Hour)
+		cache[key] = entry
+	}
+	suggest(client, "1041")
+	if requests != 4 {
+		t.Errorf("Expected expired responses to be refreshed, got %d requests", requests)
+	}
+}
+
+func TestLLMClient_Retries(t *testing.T) {
+	var statuses []int
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests < len(statuses) {
+			status := statuses[requests]
+			requests++
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		requests++
+		_ = json.NewEncoder(w).Encode(map[string]string{"response": "Restart the payment stub"})
+	}))
+	defer server.Close()
+
+	client := NewLLMClient(&LLMConfig{Enabled: true, Provider: ProviderLocal, APIURL: server.URL})
+	client.retryBase = 10 * time.Millisecond
+
+	// Rate limited, then failing: retried until the answer comes, waiting
+	// as long as Retry-After asks
+	statuses = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	start := time.Now()
+	suggestion, err := client.GenerateFixSuggestion("Payment declined", "", "Pay", "Checkout")
+	if err != nil || suggestion != "Restart the payment stub" {
+		t.Fatalf("Expected the suggestion after retries, got %q (%v)", suggestion, err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to be honored, retried after %s", elapsed)
+	}
+
+	// Gives up after MaxRetries
+	requests = 0
+	statuses = []int{500, 502, 503}
+	client.SetLimits(LLMLimits{Concurrency: 1, MaxRetries: 2})
+	_, err = client.GenerateFixSuggestion("Payment declined", "", "Pay", "Checkout")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 || requests != 3 {
+		t.Errorf("Expected the last 503 after 2 retries, got %v after %d requests", err, requests)
+	}
+
+	// Client errors are not retried
+	requests = 0
+	statuses = []int{http.StatusUnauthorized}
+	if _, err := client.GenerateFixSuggestion("Payment declined", "", "Pay", "Checkout"); err == nil || requests != 1 {
+		t.Errorf("Expected a 401 to fail at once, got %v after %d requests", err, requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"Mon, 02 Mar 2026 09:00:30 GMT", 30 * time.Second},
+		{"Mon, 02 Mar 2026 08:59:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// 600 a minute is one every 100ms, after a burst of 2
+	bucket := newTokenBucket(600, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("Expected 2 requests beyond the burst to wait about 200ms, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.wait(ctx); err == nil {
+		t.Error("Expected waiting on a cancelled context to fail")
+	}
+
+	if newTokenBucket(0, 4) != nil {
+		t.Error("Expected no bucket without a rate limit")
+	}
+}
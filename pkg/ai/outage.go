@@ -0,0 +1,152 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// OutagePolicy decides when failures add up to an environment outage
+// rather than separate test bugs
+type OutagePolicy struct {
+	Ratio        float64       // share of executed scenarios failing with network or timeout errors
+	MinScenarios int           // fewest such failures; small runs are left alone
+	Window       time.Duration // longest time the failures may be spread over; 0 for any
+}
+
+// DefaultOutagePolicy flags runs where at least half of the scenarios, and
+// at least five, failed with network or timeout errors within ten minutes
+func DefaultOutagePolicy() OutagePolicy {
+	return OutagePolicy{Ratio: 0.5, MinScenarios: 5, Window: 10 * time.Minute}
+}
+
+// Outage triggers
+const (
+	OutageBeforeSuite = "before-suite hook"
+	OutageNetwork     = "network failures"
+)
+
+// Outage is the verdict that a shared dependency was down during the run.
+// Groups are the failure groups it explains; they are reported under the
+// verdict instead of one by one.
+type Outage struct {
+	Trigger   string
+	Summary   string
+	Evidence  []string
+	Scenarios int // failed scenarios explained by the outage
+	Groups    []*FailureGroup
+}
+
+// Explains reports whether a failure group is part of the outage
+func (o *Outage) Explains(group *FailureGroup) bool {
+	if o == nil {
+		return false
+	}
+	for _, g := range o.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOutagePolicy sets when network and timeout failures are reported as an
+// environment outage
+func (a *Analyzer) SetOutagePolicy(policy OutagePolicy) {
+	a.outagePolicy = policy
+}
+
+// DetectOutage recognizes a run that failed because its environment was
+// down: a failed before-suite hook, or a large share of the scenarios
+// failing with network or timeout errors within a short time. It returns nil
+// for ordinary failures.
+func (a *Analyzer) DetectOutage(suite *models.EnhancedSuiteResult, groups []*FailureGroup) *Outage {
+	if hook := suite.BeforeSuiteFailure; hook != nil {
+		outage := &Outage{
+			Trigger: OutageBeforeSuite,
+			Summary: "The before-suite hook failed, so the environment was never set up and no scenario result says anything about the code under test.",
+			Evidence: []string{
+				"Before-suite hook failed: " + a.extractRootCause(hook.ErrorMessage),
+			},
+			Groups: groups,
+		}
+		for _, group := range groups {
+			outage.Scenarios += group.Count
+		}
+		if outage.Scenarios > 0 {
+			outage.Evidence = append(outage.Evidence,
+				fmt.Sprintf("%d failed scenario(s) in %d failure group(s) follow from it", outage.Scenarios, len(groups)))
+		}
+		return outage
+	}
+
+	policy := a.outagePolicy
+	executed := suite.PassedScenariosCount + suite.FailedScenariosCount
+	if executed == 0 || policy.Ratio <= 0 {
+		return nil
+	}
+
+	outage := &Outage{Trigger: OutageNetwork}
+	specs := make(map[string]bool)
+	for _, group := range groups {
+		if group.ErrorType == ErrorTypeNetwork || group.ErrorType == ErrorTypeTimeout {
+			outage.Groups = append(outage.Groups, group)
+			outage.Scenarios += group.Count
+			for _, spec := range group.AffectedSpecs {
+				specs[spec] = true
+			}
+		}
+	}
+	ratio := float64(outage.Scenarios) / float64(executed)
+	if outage.Scenarios < policy.MinScenarios || ratio < policy.Ratio {
+		return nil
+	}
+
+	outage.Evidence = append(outage.Evidence,
+		fmt.Sprintf("%d of %d executed scenarios (%.0f%%) failed with network or timeout errors, across %d spec(s)",
+			outage.Scenarios, executed, ratio*100, len(specs)))
+
+	// Failures spread over a long run look like flakiness, not an outage
+	if spread, ok := failureSpread(suite.ExecutionSpans, specs); ok {
+		if policy.Window > 0 && spread > policy.Window {
+			return nil
+		}
+		outage.Evidence = append(outage.Evidence,
+			fmt.Sprintf("The failing specs finished within %s of each other", spread.Round(time.Second)))
+	}
+
+	sort.SliceStable(outage.Groups, func(i, j int) bool {
+		return outage.Groups[i].Count > outage.Groups[j].Count
+	})
+	for i, group := range outage.Groups {
+		if i == 3 {
+			outage.Evidence = append(outage.Evidence, fmt.Sprintf("… and %d more failure group(s)", len(outage.Groups)-i))
+			break
+		}
+		outage.Evidence = append(outage.Evidence, fmt.Sprintf("%s: %s (%d scenario(s))", group.ErrorType, group.RootCause, group.Count))
+	}
+	outage.Summary = fmt.Sprintf("%d scenarios failed with network or timeout errors at once: a shared dependency was most likely unavailable.", outage.Scenarios)
+	return outage
+}
+
+// failureSpread returns the time between the first and the last end of a
+// failed spec among specs, when at least two were recorded
+func failureSpread(spans []*models.ExecutionSpan, specs map[string]bool) (time.Duration, bool) {
+	var first, last time.Time
+	count := 0
+	for _, span := range spans {
+		if span.Status != "failed" || !specs[span.SpecName] {
+			continue
+		}
+		if count == 0 || span.End.Before(first) {
+			first = span.End
+		}
+		if count == 0 || span.End.After(last) {
+			last = span.End
+		}
+		count++
+	}
+	return last.Sub(first), count >= 2
+}
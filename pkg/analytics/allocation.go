@@ -0,0 +1,310 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// maxRebalanceSteps bounds the moves and swaps tried after the greedy packing
+const maxRebalanceSteps = 10000
+
+// SpecEstimate is the expected duration of a spec
+type SpecEstimate struct {
+	SpecName string   `json:"specName"`
+	SpecFile string   `json:"specFile,omitempty"` // relative to the project root
+	Tags     []string `json:"tags,omitempty"`
+	Estimate int64    `json:"estimate"` // milliseconds, median of the history window
+	Samples  int      `json:"samples"`  // runs behind the estimate; 0 if it is a guess
+}
+
+// StreamPlan is the specs given to one parallel stream
+type StreamPlan struct {
+	Stream int             `json:"stream"`
+	Specs  []*SpecEstimate `json:"specs"`
+	Tags   []string        `json:"tags,omitempty"` // with tag grouping, the tags selecting the specs
+	Total  int64           `json:"total"`          // milliseconds
+}
+
+// Allocation is a plan for running specs in parallel streams
+type Allocation struct {
+	Streams    []*StreamPlan `json:"streams"`
+	WallClock  int64         `json:"wallClock"`  // expected, milliseconds: the longest stream
+	LowerBound int64         `json:"lowerBound"` // no allocation finishes sooner, milliseconds
+	Serial     int64         `json:"serial"`     // all specs in one stream, milliseconds
+	Warnings   []string      `json:"warnings,omitempty"`
+}
+
+// SpecEstimates estimates every spec that ran in a partition in the last N
+// days from its median duration, longest first
+func (e *Engine) SpecEstimates(partition storage.Partition, days int) ([]*SpecEstimate, error) {
+	estimates := make([]*SpecEstimate, 0)
+	if e.db == nil {
+		return estimates, nil
+	}
+
+	specs, err := e.db.GetSpecDurations(partition, days)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		estimates = append(estimates, &SpecEstimate{
+			SpecName: spec.SpecName,
+			SpecFile: spec.SpecFile,
+			Tags:     spec.Tags,
+			Estimate: int64(median(spec.Durations)),
+			Samples:  len(spec.Durations),
+		})
+	}
+	sortEstimates(estimates)
+	return estimates, nil
+}
+
+// allocationUnit is what gets packed: a spec, or with tag grouping all specs
+// sharing a first tag
+type allocationUnit struct {
+	tag   string
+	specs []*SpecEstimate
+	total int64
+}
+
+// AllocateStreams packs specs into n streams so that the longest stream, the
+// expected wall-clock time, is as short as possible. With byTag, specs are
+// grouped on their first tag so each stream can be selected with a tag
+// expression. The packing is the longest-first greedy (at most a third over
+// the optimum) improved by moves and swaps off the longest stream; compare
+// WallClock with LowerBound to see how much room is left.
+func AllocateStreams(specs []*SpecEstimate, n int, byTag bool) *Allocation {
+	n = max(n, 1)
+	allocation := &Allocation{Streams: make([]*StreamPlan, n)}
+	for i := range allocation.Streams {
+		allocation.Streams[i] = &StreamPlan{Stream: i + 1, Specs: make([]*SpecEstimate, 0)}
+	}
+
+	units := allocationUnits(specs, byTag)
+	weights := make([]int64, len(units))
+	var longest int64
+	for i, unit := range units {
+		weights[i] = unit.total
+		longest = max(longest, unit.total)
+		allocation.Serial += unit.total
+	}
+	allocation.LowerBound = max(longest, (allocation.Serial+int64(n)-1)/int64(n))
+
+	for i, stream := range pack(weights, n) {
+		plan := allocation.Streams[i]
+		for _, u := range stream {
+			plan.Specs = append(plan.Specs, units[u].specs...)
+			plan.Total += units[u].total
+			if units[u].tag != "" {
+				plan.Tags = append(plan.Tags, units[u].tag)
+			}
+		}
+		sortEstimates(plan.Specs)
+		sort.Strings(plan.Tags)
+		allocation.WallClock = max(allocation.WallClock, plan.Total)
+	}
+
+	if byTag {
+		allocation.Warnings = tagGroupingWarnings(allocation.Streams)
+	}
+	return allocation
+}
+
+// allocationUnits turns specs into packing units, longest first
+func allocationUnits(specs []*SpecEstimate, byTag bool) []*allocationUnit {
+	var units []*allocationUnit
+	byFirstTag := make(map[string]*allocationUnit)
+	for _, spec := range specs {
+		if !byTag || len(spec.Tags) == 0 {
+			units = append(units, &allocationUnit{specs: []*SpecEstimate{spec}, total: spec.Estimate})
+			continue
+		}
+		unit, ok := byFirstTag[spec.Tags[0]]
+		if !ok {
+			unit = &allocationUnit{tag: spec.Tags[0]}
+			byFirstTag[spec.Tags[0]] = unit
+			units = append(units, unit)
+		}
+		unit.specs = append(unit.specs, spec)
+		unit.total += spec.Estimate
+	}
+
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].total > units[j].total
+	})
+	return units
+}
+
+// pack assigns weights, sorted longest first, to n bins and returns the
+// indices in each bin
+func pack(weights []int64, n int) [][]int {
+	bins := make([][]int, n)
+	loads := make([]int64, n)
+
+	// Longest processing time first: each item onto the least loaded bin
+	for i, w := range weights {
+		least := 0
+		for b := range loads {
+			if loads[b] < loads[least] {
+				least = b
+			}
+		}
+		bins[least] = append(bins[least], i)
+		loads[least] += w
+	}
+
+	// Then move or swap items off the longest bin while that shortens it
+	// without making another bin as long
+	for step := 0; step < maxRebalanceSteps; step++ {
+		longest := 0
+		for b := range loads {
+			if loads[b] > loads[longest] {
+				longest = b
+			}
+		}
+
+		bestPeak := loads[longest]
+		var apply func()
+		for ai, a := range bins[longest] {
+			for b := range bins {
+				if b == longest {
+					continue
+				}
+				// Move a to b
+				if peak := max(loads[longest]-weights[a], loads[b]+weights[a]); peak < bestPeak {
+					bestPeak = peak
+					ai, b, a := ai, b, a
+					apply = func() {
+						bins[longest] = append(bins[longest][:ai:ai], bins[longest][ai+1:]...)
+						bins[b] = append(bins[b], a)
+						loads[longest] -= weights[a]
+						loads[b] += weights[a]
+					}
+				}
+				// Swap a with a shorter item of b
+				for ci, c := range bins[b] {
+					delta := weights[a] - weights[c]
+					if delta <= 0 {
+						continue
+					}
+					if peak := max(loads[longest]-delta, loads[b]+delta); peak < bestPeak {
+						bestPeak = peak
+						ai, b, ci, a, c, delta := ai, b, ci, a, c, delta
+						apply = func() {
+							bins[longest][ai], bins[b][ci] = c, a
+							loads[longest] -= delta
+							loads[b] += delta
+						}
+					}
+				}
+			}
+		}
+		if apply == nil {
+			break
+		}
+		apply()
+	}
+
+	for _, bin := range bins {
+		sort.Ints(bin) // back to longest first
+	}
+	return bins
+}
+
+// tagGroupingWarnings lists what a tag expression per stream gets wrong:
+// specs without tags cannot be selected, and a spec carrying a tag that
+// selects another stream would run twice
+func tagGroupingWarnings(streams []*StreamPlan) []string {
+	streamOfTag := make(map[string]int)
+	for _, plan := range streams {
+		for _, tag := range plan.Tags {
+			streamOfTag[tag] = plan.Stream
+		}
+	}
+
+	var warnings []string
+	for _, plan := range streams {
+		for _, spec := range plan.Specs {
+			if len(spec.Tags) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s has no tags; run it by file on stream %d", specLabel(spec), plan.Stream))
+				continue
+			}
+			for _, tag := range spec.Tags[1:] {
+				if other, ok := streamOfTag[tag]; ok && other != plan.Stream {
+					warnings = append(warnings, fmt.Sprintf("%s is also tagged %q and would run on stream %d too", specLabel(spec), tag, other))
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// TagExpression returns the Gauge tag expression selecting the stream's
+// specs, or an error naming the specs it cannot select
+func (p *StreamPlan) TagExpression() (string, error) {
+	var untagged []string
+	for _, spec := range p.Specs {
+		if len(spec.Tags) == 0 {
+			untagged = append(untagged, specLabel(spec))
+		}
+	}
+	if len(untagged) > 0 {
+		return "", fmt.Errorf("stream %d has specs without tags: %s", p.Stream, strings.Join(untagged, ", "))
+	}
+	return strings.Join(p.Tags, " | "), nil
+}
+
+// specLabel names a spec by file, or by heading when the file is unknown
+func specLabel(spec *SpecEstimate) string {
+	if spec.SpecFile != "" {
+		return spec.SpecFile
+	}
+	return spec.SpecName
+}
+
+// sortEstimates orders specs longest first, then by file
+func sortEstimates(specs []*SpecEstimate) {
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].Estimate != specs[j].Estimate {
+			return specs[i].Estimate > specs[j].Estimate
+		}
+		return specLabel(specs[i]) < specLabel(specs[j])
+	})
+}
+
+// ReconcileSpecs matches estimates with the specs on disk: specs that no
+// longer exist are dropped, and specs without history are estimated at the
+// median of the known specs. Tags and headings come from disk.
+func ReconcileSpecs(estimates, onDisk []*SpecEstimate) []*SpecEstimate {
+	known := make(map[string]*SpecEstimate, len(estimates))
+	durations := make([]int64, 0, len(estimates))
+	for _, estimate := range estimates {
+		known[estimate.SpecFile] = estimate
+		durations = append(durations, estimate.Estimate)
+	}
+	var guess int64
+	if len(durations) > 0 {
+		guess = int64(median(durations))
+	}
+
+	specs := make([]*SpecEstimate, 0, len(onDisk))
+	for _, spec := range onDisk {
+		reconciled := *spec
+		if estimate, ok := known[spec.SpecFile]; ok {
+			reconciled.Estimate = estimate.Estimate
+			reconciled.Samples = estimate.Samples
+			if reconciled.SpecName == "" {
+				reconciled.SpecName = estimate.SpecName
+			}
+		} else {
+			reconciled.Estimate = guess
+			reconciled.Samples = 0
+		}
+		specs = append(specs, &reconciled)
+	}
+	sortEstimates(specs)
+	return specs
+}
@@ -3,27 +3,40 @@ package analytics
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
 	"github.com/lirany1/gauge-html-report-ai/pkg/config"
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
 	"github.com/lirany1/gauge-html-report-ai/pkg/models"
 	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
 )
 
+// flakyThreshold is the flaky score above which a scenario is reported as flaky
+const flakyThreshold = 0.3
+
 // Engine handles analytics processing with database integration
 type Engine struct {
-	config *config.Config
-	db     *storage.Database
+	config     *config.Config
+	db         storage.Store
+	classifier *classify.Classifier
 }
 
 // NewEngine creates a new analytics engine with database support
-func NewEngine(cfg *config.Config, db *storage.Database) *Engine {
+func NewEngine(cfg *config.Config, db storage.Store) *Engine {
 	return &Engine{
-		config: cfg,
-		db:     db,
+		config:     cfg,
+		db:         db,
+		classifier: classify.Default(),
 	}
 }
 
+// SetClassifier replaces the built-in error classification rules
+func (e *Engine) SetClassifier(classifier *classify.Classifier) {
+	e.classifier = classifier
+}
+
 // Analyze performs comprehensive analysis on test results
 func (e *Engine) Analyze(suite *models.EnhancedSuiteResult) *models.Analytics {
 	analytics := &models.Analytics{
@@ -33,7 +46,9 @@ func (e *Engine) Analyze(suite *models.EnhancedSuiteResult) *models.Analytics {
 		SlowestSpecs:        e.findSlowestSpecs(suite, 5),
 		MostFailedSpecs:     e.findMostFailedSpecs(suite, 5),
 		TimelineData:        e.generateTimeline(suite),
+		TimelineEstimated:   len(suite.ExecutionSpans) == 0,
 	}
+	analytics.StreamLanes, analytics.Parallel = streamLanes(suite.ExecutionSpans)
 
 	// Calculate averages
 	totalScenarios := 0
@@ -73,71 +88,28 @@ func (e *Engine) calculateTagDistribution(suite *models.EnhancedSuiteResult) map
 	return distribution
 }
 
-// calculateFailureDistribution categorizes failures
+// calculateFailureDistribution counts failed scenarios by the category of
+// their first failed step
 func (e *Engine) calculateFailureDistribution(suite *models.EnhancedSuiteResult) map[string]int {
 	distribution := make(map[string]int)
 
 	for _, spec := range suite.SpecResults {
 		for _, scenario := range spec.Scenarios {
-			if scenario.Failed {
-				// Look at step errors
-				hasError := false
-				for _, step := range scenario.Steps {
-					if step.Failed && step.ErrorMessage != "" {
-						errorType := categorizeError(step.ErrorMessage)
-						distribution[errorType]++
-						hasError = true
-						break
-					}
-				}
-				if !hasError {
-					distribution["Unknown"]++
-				}
+			if !scenario.Failed {
+				continue
 			}
-		}
-	}
-
-	return distribution
-}
-
-// categorizeError classifies error messages
-func categorizeError(message string) string {
-	// Simple categorization logic
-	messageLower := message
-	if len(messageLower) > 100 {
-		messageLower = messageLower[:100]
-	}
-
-	// Common error patterns
-	patterns := map[string][]string{
-		"Assertion":  {"assert", "expected", "actual"},
-		"Timeout":    {"timeout", "timed out", "deadline"},
-		"Connection": {"connection", "network", "unreachable"},
-		"NotFound":   {"not found", "404", "missing"},
-		"Permission": {"permission", "denied", "unauthorized", "403"},
-		"Null":       {"null", "nil", "undefined"},
-		"TypeError":  {"type error", "cannot convert", "invalid type"},
-	}
-
-	for category, keywords := range patterns {
-		for _, keyword := range keywords {
-			if len(messageLower) >= len(keyword) {
-				// Simple substring check
-				found := false
-				for i := 0; i <= len(messageLower)-len(keyword); i++ {
-					if messageLower[i:i+len(keyword)] == keyword {
-						found = true
-						break
-					}
-				}
-				if found {
-					return category
+			category := classify.Unknown
+			for _, step := range scenario.Steps {
+				if step.Failed {
+					category = e.classifier.Classify(step.ErrorMessage, step.StackTrace)
+					break
 				}
 			}
+			distribution[category]++
 		}
 	}
 
-	return "Other"
+	return distribution
 }
 
 // findSlowestSpecs returns the N slowest specs
@@ -195,77 +167,77 @@ func (e *Engine) findMostFailedSpecs(suite *models.EnhancedSuiteResult, n int) [
 	return failedSpecs
 }
 
-// generateTimeline creates execution timeline
-func (e *Engine) generateTimeline(suite *models.EnhancedSuiteResult) []*models.TimelineEntry {
-	var timeline []*models.TimelineEntry
-	currentTime := suite.Timestamp
-
-	for _, spec := range suite.SpecResults {
-		// Spec start
-		timeline = append(timeline, &models.TimelineEntry{
-			Timestamp: currentTime,
-			Event:     "spec_start",
-			SpecName:  spec.SpecHeading,
-			Duration:  spec.ExecutionTime,
-			Status:    spec.GetStatus(),
-		})
-
-		currentTime = currentTime.Add(spec.ExecutionTime)
-
-		// Spec end
-		event := "success"
-		if spec.Failed {
-			event = "failure"
-		}
-		timeline = append(timeline, &models.TimelineEntry{
-			Timestamp: currentTime,
-			Event:     event,
-			SpecName:  spec.SpecHeading,
-			Duration:  spec.ExecutionTime,
-			Status:    spec.GetStatus(),
-		})
-	}
-
-	return timeline
-}
-
 // GenerateTrends creates historical trend data using database
 func (e *Engine) GenerateTrends(suite *models.EnhancedSuiteResult) *models.TrendData {
 	if e.db == nil {
 		// Return empty trends if no database
 		return &models.TrendData{
+			WindowDays:     e.config.TrendWindowDays,
 			HistoricalRuns: make([]*models.HistoricalRun, 0),
 		}
 	}
 
-	// Get trend data for last 30 days
-	trends, err := e.db.GetTrendData(30)
+	// Runs and daily aggregates of pruned runs over the same window
+	trends, err := e.db.GetTrendData(e.partition(suite), e.config.TrendWindowDays)
 	if err != nil {
 		return &models.TrendData{
+			WindowDays:     e.config.TrendWindowDays,
 			HistoricalRuns: make([]*models.HistoricalRun, 0),
 		}
 	}
 
 	// Convert to HistoricalRun format
-	historicalRuns := make([]*models.HistoricalRun, len(trends))
-	successRateTrend := make([]float64, len(trends))
-	executionTimeTrend := make([]time.Duration, len(trends))
-
-	for i, trend := range trends {
-		historicalRuns[i] = &models.HistoricalRun{
+	historicalRuns := make([]*models.HistoricalRun, 0, len(trends))
+	for _, trend := range trends {
+		historicalRuns = append(historicalRuns, &models.HistoricalRun{
 			Timestamp:     trend.Timestamp,
 			SuccessRate:   trend.SuccessRate,
 			ExecutionTime: time.Duration(trend.Duration) * time.Millisecond,
 			PassedCount:   trend.Passed,
 			FailedCount:   trend.Failed,
-			BuildNumber:   "",
-			GitCommit:     "",
+			SkippedCount:  trend.Skipped,
+			BuildNumber:   trend.BuildNumber,
+			BuildURL:      trend.BuildURL,
+			Branch:        trend.Branch,
+			GitCommit:     trend.GitCommit,
+			Agent:         trend.Agent,
+			Runs:          1,
+		})
+	}
+
+	// Pruned runs survive as one averaged point per day
+	aggregates, err := e.db.GetDailyAggregates(e.partition(suite), e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load daily aggregates: %v", err)
+	}
+	for _, agg := range aggregates {
+		day, err := time.Parse("2006-01-02", agg.Day)
+		if err != nil || agg.Runs == 0 {
+			continue
 		}
-		successRateTrend[i] = trend.SuccessRate
-		executionTimeTrend[i] = time.Duration(trend.Duration) * time.Millisecond
+		historicalRuns = append(historicalRuns, &models.HistoricalRun{
+			Timestamp:     day,
+			SuccessRate:   agg.SuccessRate(),
+			ExecutionTime: time.Duration(agg.TotalDuration/int64(agg.Runs)) * time.Millisecond,
+			PassedCount:   agg.PassedScenarios / agg.Runs,
+			FailedCount:   agg.FailedScenarios / agg.Runs,
+			SkippedCount:  agg.SkippedScenarios / agg.Runs,
+			Runs:          agg.Runs,
+		})
+	}
+	sort.SliceStable(historicalRuns, func(i, j int) bool {
+		return historicalRuns[i].Timestamp.Before(historicalRuns[j].Timestamp)
+	})
+
+	successRateTrend := make([]float64, len(historicalRuns))
+	executionTimeTrend := make([]time.Duration, len(historicalRuns))
+	for i, run := range historicalRuns {
+		successRateTrend[i] = run.SuccessRate
+		executionTimeTrend[i] = run.ExecutionTime
 	}
 
 	trendData := &models.TrendData{
+		WindowDays:         e.config.TrendWindowDays,
 		HistoricalRuns:     historicalRuns,
 		SuccessRateTrend:   successRateTrend,
 		ExecutionTimeTrend: executionTimeTrend,
@@ -297,57 +269,81 @@ func (e *Engine) GenerateTrends(suite *models.EnhancedSuiteResult) *models.Trend
 	return trendData
 }
 
-// DetectFlakyTests identifies inconsistent tests using database history
-func (e *Engine) DetectFlakyTests(suite *models.EnhancedSuiteResult) []*models.FlakyTest {
-	flakyTests := make([]*models.FlakyTest, 0)
+// DetectUnstableTests rates every scenario of the suite against its history,
+// including this run, and returns the flaky ones, most flaky first, and the
+// ones that have been failing consistently. The whole history window is
+// loaded in one query.
+func (e *Engine) DetectUnstableTests(suite *models.EnhancedSuiteResult) (flaky, broken []*models.FlakyTest) {
+	flaky = make([]*models.FlakyTest, 0)
+	broken = make([]*models.FlakyTest, 0)
 
 	if e.db == nil {
-		return flakyTests
+		return flaky, broken
 	}
 
-	flakyThreshold := 0.3 // Score > 0.3 is considered flaky
+	outcomes, err := e.db.GetScenarioOutcomes(e.partition(suite), e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load scenario history: %v", err)
+		return flaky, broken
+	}
+	history := storage.IndexScenarioRuns(outcomes)
 
 	for _, spec := range suite.SpecResults {
 		for _, scenario := range spec.Scenarios {
-			score, err := e.db.CalculateFlakyScore(scenario.ScenarioHeading, 30)
-			if err != nil {
-				continue
+			runs := withCurrentRun(history, suite, spec, scenario)
+			test := unstableTest(spec.SpecHeading, scenario.ScenarioHeading, runs)
+			switch {
+			case test == nil:
+			case test.IsBroken():
+				broken = append(broken, test)
+			default:
+				flaky = append(flaky, test)
 			}
+		}
+	}
 
-			if score > flakyThreshold {
-				// Get history to calculate additional metrics
-				history, err := e.db.GetScenarioHistory(scenario.ScenarioHeading, 30)
-				if err != nil {
-					// If we can't get history, skip additional metrics but still report as flaky
-					history = []storage.ScenarioRecord{}
-				}
+	sortUnstable(flaky, broken)
+	return flaky, broken
+}
 
-				totalRuns := len(history)
-				failedRuns := 0
-				for _, h := range history {
-					if h.Status == "failed" {
-						failedRuns++
-					}
-				}
+// partition scopes history queries to runs comparable with this suite
+func (e *Engine) partition(suite *models.EnhancedSuiteResult) storage.Partition {
+	partition := storage.Partition{
+		Project:     e.projectName(suite),
+		Environment: suite.Environment,
+	}
+	if e.config.HistoryPartitionByTags {
+		partition.TagFilter = tagFilter(suite.Tags)
+	}
+	return partition
+}
 
-				failureRate := 0.0
-				if totalRuns > 0 {
-					failureRate = float64(failedRuns) / float64(totalRuns) * 100
-				}
+// projectName prefers the project reported by Gauge over the configured one
+func (e *Engine) projectName(suite *models.EnhancedSuiteResult) string {
+	if suite.ProjectName != "" {
+		return suite.ProjectName
+	}
+	return e.config.ProjectName
+}
 
-				flakyTests = append(flakyTests, &models.FlakyTest{
-					SpecName:     spec.SpecHeading,
-					ScenarioName: scenario.ScenarioHeading,
-					FlakyScore:   score,
-					FailureRate:  failureRate,
-					LastSeen:     time.Now(),
-					Occurrences:  totalRuns,
-				})
-			}
+// tagFilter normalises the tags a run was filtered by into one comparable string
+func tagFilter(tags []string) string {
+	var parts []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			parts = append(parts, tag)
 		}
 	}
+	return strings.Join(parts, ",")
+}
 
-	return flakyTests
+// scenarioKey identifies a scenario's history in the store
+func scenarioKey(spec *models.SpecResult, scenario *models.ScenarioResult) storage.ScenarioKey {
+	return storage.ScenarioKey{
+		ID:       scenario.ID,
+		Name:     scenario.ScenarioHeading,
+		SpecName: spec.SpecHeading,
+	}
 }
 
 // SaveExecutionData saves current execution to database for historical tracking
@@ -356,12 +352,17 @@ func (e *Engine) SaveExecutionData(suite *models.EnhancedSuiteResult, executionI
 		return fmt.Errorf("database not initialized")
 	}
 
-	// Calculate totals
+	// Calculate totals. Quarantined scenarios are left out, so the total
+	// adds up to passed, failed and skipped and every rate derived from the
+	// stored counts matches the success rate.
 	passed := suite.PassedScenariosCount
 	failed := suite.FailedScenariosCount
 	skipped := suite.SkippedScenariosCount
-	total := suite.TotalScenariosCount
-	successRate := suite.SuccessRate
+	total := suite.TotalScenariosCount - suite.QuarantinedScenariosCount
+	successRate := 0.0
+	if total > 0 {
+		successRate = float64(passed) / float64(total) * 100
+	}
 
 	// Save execution record
 	execution := &storage.ExecutionRecord{
@@ -373,24 +374,63 @@ func (e *Engine) SaveExecutionData(suite *models.EnhancedSuiteResult, executionI
 		SkippedScenarios: skipped,
 		SuccessRate:      successRate,
 		Duration:         int64(suite.ExecutionTime.Milliseconds()),
+		Project:          e.projectName(suite),
 		Environment:      suite.Environment,
+		TagFilter:        tagFilter(suite.Tags),
 		Tags:             suite.Tags,
 		Metadata:         make(map[string]interface{}),
 	}
 
+	if meta := suite.RunMetadata; meta != nil {
+		execution.BuildNumber = meta.BuildNumber
+		execution.BuildURL = meta.BuildURL
+		execution.Branch = meta.Branch
+		execution.GitCommit = meta.GitCommit
+		execution.Agent = meta.Agent
+		execution.Metadata["provider"] = meta.Provider
+		if meta.JobName != "" {
+			execution.Metadata["job"] = meta.JobName
+		}
+	}
+
 	if err := e.db.SaveExecution(execution); err != nil {
 		return fmt.Errorf("failed to save execution: %w", err)
 	}
 
-	// Save individual scenario records
+	// Save individual spec and scenario records
+	streams := make(map[string]int)
+	for _, span := range suite.ExecutionSpans {
+		streams[span.FileName] = span.Stream
+	}
+	var specRecords []storage.SpecRecord
+	var stepMetrics []storage.StepMetric
 	for _, spec := range suite.SpecResults {
+		specRecords = append(specRecords, storage.SpecRecord{
+			SpecName: spec.SpecHeading,
+			SpecFile: spec.RelativePath,
+			Status:   spec.GetStatus(),
+			Duration: spec.ExecutionTime.Milliseconds(),
+			Tags:     spec.Tags,
+			Stream:   streams[spec.FileName],
+		})
 		for _, scenario := range spec.Scenarios {
-			status := "passed"
+			for _, step := range scenario.Steps {
+				if step.Skipped {
+					continue
+				}
+				stepMetrics = append(stepMetrics, storage.StepMetric{
+					StepText:     step.StepText,
+					Duration:     step.ExecutionTime.Milliseconds(),
+					ScenarioName: scenario.ScenarioHeading,
+					SpecName:     spec.SpecHeading,
+				})
+			}
+
+			status := scenarioStatus(scenario)
 			errorMessage := ""
 			stackTrace := ""
 
 			if scenario.Failed {
-				status = "failed"
 				// Get error message from first failed step
 				for _, step := range scenario.Steps {
 					if step.Failed {
@@ -399,8 +439,6 @@ func (e *Engine) SaveExecutionData(suite *models.EnhancedSuiteResult, executionI
 						break
 					}
 				}
-			} else if scenario.Skipped {
-				status = "skipped"
 			}
 
 			scenarioRecord := &storage.ScenarioRecord{
@@ -411,6 +449,12 @@ func (e *Engine) SaveExecutionData(suite *models.EnhancedSuiteResult, executionI
 				Duration:     int64(scenario.ExecutionTime.Milliseconds()),
 				ErrorMessage: errorMessage,
 				StackTrace:   stackTrace,
+				ScenarioID:   scenario.ID,
+				SpecFile:     spec.RelativePath,
+				LineStart:    scenario.LineStart,
+				RowIndex:     scenario.RowIndex,
+				Content:      strings.Join(scenario.StepTexts(), "\n"),
+				Retries:      scenario.Retries,
 			}
 
 			if err := e.db.SaveScenario(scenarioRecord); err != nil {
@@ -420,6 +464,16 @@ func (e *Engine) SaveExecutionData(suite *models.EnhancedSuiteResult, executionI
 		}
 	}
 
+	// Save spec durations for stream allocation
+	if err := e.db.SaveSpecs(executionID, specRecords); err != nil {
+		logger.Warnf("Failed to save spec durations: %v", err)
+	}
+
+	// Save step timings for performance regression detection
+	if err := e.db.SaveStepMetrics(executionID, stepMetrics); err != nil {
+		logger.Warnf("Failed to save step metrics: %v", err)
+	}
+
 	return nil
 }
 
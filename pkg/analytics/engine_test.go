@@ -0,0 +1,746 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/ai"
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
+	"github.com/lirany1/gauge-html-report-ai/pkg/config"
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/quarantine"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+func newTestEngine(t testing.TB) *Engine {
+	t.Helper()
+
+	db, err := storage.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return NewEngine(config.NewConfig(), db)
+}
+
+// newTestSuite builds a one-spec suite; scenarios named in failing fail
+func newTestSuite(timestamp time.Time, scenarios []string, failing map[string]bool) *models.EnhancedSuiteResult {
+	spec := &models.SpecResult{SpecHeading: "Checkout", FileName: "specs/checkout.spec"}
+	suite := &models.EnhancedSuiteResult{Timestamp: timestamp, SpecResults: []*models.SpecResult{spec}}
+
+	for _, name := range scenarios {
+		scenario := &models.ScenarioResult{
+			ScenarioHeading: name,
+			ExecutionTime:   time.Second,
+			Failed:          failing[name],
+		}
+		if scenario.Failed {
+			scenario.Steps = []*models.StepResult{{StepText: "Pay", Failed: true, ErrorMessage: "timed out"}}
+			suite.FailedScenariosCount++
+		} else {
+			suite.PassedScenariosCount++
+		}
+		suite.TotalScenariosCount++
+		spec.Scenarios = append(spec.Scenarios, scenario)
+	}
+	return suite
+}
+
+func TestEngine_TrackFailurePatterns(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// Runs 1, 2 and 4 fail with the signature; run 3 is clean
+	want := []string{"new", "recurring", "", "regression"}
+	for i, expected := range want {
+		timestamp := start.Add(time.Duration(i) * time.Minute)
+		suite := newTestSuite(timestamp, []string{"Pay by card"}, map[string]bool{"Pay by card": expected != ""})
+
+		var groups []*models.FailureGroup
+		if expected != "" {
+			groups = []*models.FailureGroup{{Signature: "sig-timeout", ErrorType: "Timeout"}}
+		}
+		engine.TrackFailurePatterns(suite, groups)
+
+		if expected != "" && groups[0].Recurrence != expected {
+			t.Errorf("Run %d: expected %s, got %s", i+1, expected, groups[0].Recurrence)
+		}
+		if expected == "regression" {
+			if !groups[0].FirstSeen.Equal(start) {
+				t.Errorf("Expected first seen %v, got %v", start, groups[0].FirstSeen)
+			}
+			if groups[0].SeenInRuns != 3 {
+				t.Errorf("Expected signature seen in 3 runs, got %d", groups[0].SeenInRuns)
+			}
+		}
+
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestEngine_TrackFailurePatterns_Partitions(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	run := func(i int, environment string, group *models.FailureGroup) {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), []string{"Pay by card"}, map[string]bool{"Pay by card": true})
+		suite.ProjectName = "shop"
+		suite.Environment = environment
+		engine.TrackFailurePatterns(suite, []*models.FailureGroup{group})
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	// A built-in suggestion is not stored as analysis
+	staging := &models.FailureGroup{Signature: "sig-timeout", ErrorType: "Timeout", SuggestedFix: "Increase timeout values"}
+	run(0, "staging", staging)
+	run(1, "staging", &models.FailureGroup{Signature: "sig-timeout", ErrorType: "Timeout"})
+
+	// The same failure in another environment is new there
+	production := &models.FailureGroup{Signature: "sig-timeout", ErrorType: "Timeout", SuggestedFix: "Raise the gateway timeout", AISuggested: true}
+	run(2, "production", production)
+	if production.Recurrence != "new" || production.SeenInRuns != 1 {
+		t.Errorf("Expected a failure seen only in staging to be new in production, got %s in %d runs", production.Recurrence, production.SeenInRuns)
+	}
+
+	for environment, want := range map[string]string{"staging": "", "production": "Raise the gateway timeout"} {
+		pattern, err := engine.db.GetFailurePattern(storage.Partition{Project: "shop", Environment: environment}, "sig-timeout")
+		if err != nil || pattern == nil {
+			t.Fatalf("Failed to load the %s pattern: %+v (%v)", environment, pattern, err)
+		}
+		if pattern.AIAnalysis != want {
+			t.Errorf("Expected %s analysis %q, got %q", environment, want, pattern.AIAnalysis)
+		}
+	}
+}
+
+func TestEngine_TrackFailurePatterns_Origin(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	group := func(signature, spec string) *models.FailureGroup {
+		return &models.FailureGroup{
+			Signature: signature, ErrorType: "Network Error", Pattern: signature + " refused",
+			Count: 2, AffectedSpecs: []string{spec},
+		}
+	}
+	run := func(i int, build string, groups ...*models.FailureGroup) *models.FailureBurst {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), []string{"Pay by card"}, map[string]bool{"Pay by card": true})
+		suite.RunMetadata = &models.RunMetadata{BuildNumber: build, GitCommit: "commit-" + build}
+		burst := engine.TrackFailurePatterns(suite, groups)
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save build %s: %v", build, err)
+		}
+		return burst
+	}
+
+	// Everything is new on the first run, which says nothing about the build
+	if burst := run(0, "411", group("old-1", "Checkout"), group("old-2", "Cart"), group("old-3", "Cart"), group("old-4", "Login")); burst != nil {
+		t.Errorf("Expected no burst on the first run, got %+v", burst)
+	}
+
+	// Build 412 brings four new failures across two specs at once
+	recurring := group("old-1", "Checkout")
+	fresh := []*models.FailureGroup{group("db", "Checkout"), group("cache", "Cart"), group("queue", "Cart"), group("auth", "Checkout")}
+	burst := run(1, "412", append([]*models.FailureGroup{recurring}, fresh...)...)
+	if burst == nil || burst.NewGroups != 4 || burst.Scenarios != 8 || strings.Join(burst.Specs, ",") != "Cart,Checkout" {
+		t.Errorf("Expected a burst of 4 new groups in 8 scenarios across Cart and Checkout, got %+v", burst)
+	}
+	if fresh[0].FirstBuild != "412" || len(fresh[0].IntroducedWith) != 3 {
+		t.Errorf("Expected db to be introduced in build 412 with 3 others, got %s with %v", fresh[0].FirstBuild, fresh[0].IntroducedWith)
+	}
+	if recurring.FirstBuild != "411" || recurring.FirstCommit != "commit-411" || len(recurring.IntroducedWith) != 3 {
+		t.Errorf("Expected old-1 from build 411 with its 3 siblings, got %s at %s with %v",
+			recurring.FirstBuild, recurring.FirstCommit, recurring.IntroducedWith)
+	}
+
+	// Later runs trace a signature back to the build that introduced it
+	later := group("db", "Checkout")
+	if burst := run(2, "413", later); burst != nil {
+		t.Errorf("Expected no burst without new failures, got %+v", burst)
+	}
+	if later.FirstBuild != "412" || later.FirstCommit != "commit-412" {
+		t.Errorf("Expected db to date from build 412, got %s at %s", later.FirstBuild, later.FirstCommit)
+	}
+	if strings.Join(later.IntroducedWith, ",") != "auth refused,cache refused,queue refused" {
+		t.Errorf("Expected the failures introduced alongside db, got %v", later.IntroducedWith)
+	}
+}
+
+func TestEngine_AnalyzePerformance_FlagsStepRegression(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	newRun := func(i int, payDuration time.Duration) *models.EnhancedSuiteResult {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), []string{"Pay by card"}, nil)
+		suite.SpecResults[0].Scenarios[0].Steps = []*models.StepResult{
+			{StepText: "Open checkout", ExecutionTime: 200 * time.Millisecond},
+			{StepText: "Pay", ExecutionTime: payDuration},
+		}
+		return suite
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := engine.SaveExecutionData(newRun(i, time.Duration(300+10*i)*time.Millisecond), fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	metrics := engine.AnalyzePerformance(newRun(6, 1200*time.Millisecond))
+	if len(metrics.Bottlenecks) != 1 {
+		t.Fatalf("Expected 1 bottleneck, got %d", len(metrics.Bottlenecks))
+	}
+
+	b := metrics.Bottlenecks[0]
+	if b.Type != "slow_step" || b.Severity != "critical" {
+		t.Errorf("Expected critical slow_step, got %s %s", b.Severity, b.Type)
+	}
+	if b.Samples != 6 {
+		t.Errorf("Expected 6 samples, got %d", b.Samples)
+	}
+	if b.BaselineMedian != 325*time.Millisecond {
+		t.Errorf("Expected median 325ms, got %v", b.BaselineMedian)
+	}
+	if b.Impact != 875*time.Millisecond {
+		t.Errorf("Expected impact 875ms, got %v", b.Impact)
+	}
+}
+
+func TestEngine_AnalyzePerformance_FlagsScenarioAnomalies(t *testing.T) {
+	engine := newTestEngine(t)
+	if threshold := engine.config.DurationAnomalyThreshold; threshold != 3.5 {
+		t.Fatalf("Expected the default anomaly threshold of 3.5, got %v", threshold)
+	}
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	scenarios := []string{"Pay by card", "Pay by voucher", "Pay by cash"}
+
+	newRun := func(i int, durations ...time.Duration) *models.EnhancedSuiteResult {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), scenarios, nil)
+		for j, scenario := range suite.SpecResults[0].Scenarios {
+			scenario.ExecutionTime = durations[j]
+		}
+		return suite
+	}
+
+	jitter := []time.Duration{0, 100, -100, 50, -50, 0}
+	for i, ms := range jitter {
+		d := 10*time.Second + ms*time.Millisecond
+		if err := engine.SaveExecutionData(newRun(i, d, d, d), fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	// Card doubled, voucher got much faster, cash moved within its noise
+	metrics := engine.AnalyzePerformance(newRun(len(jitter), 20*time.Second, 4*time.Second, 10100*time.Millisecond))
+	if len(metrics.Bottlenecks) != 2 {
+		t.Fatalf("Expected 2 anomalies, got %d: %+v", len(metrics.Bottlenecks), metrics.Bottlenecks)
+	}
+
+	slow, fast := metrics.Bottlenecks[0], metrics.Bottlenecks[1]
+	if slow.Type != "slow_scenario" || slow.Severity != "critical" || slow.Location != "Checkout › Pay by card" {
+		t.Errorf("Expected a critical slow-down of 'Pay by card' first, got %s %s %s", slow.Severity, slow.Type, slow.Location)
+	}
+	if slow.BaselineMedian != 10*time.Second || slow.BaselineMAD != 50*time.Millisecond || slow.Samples != 6 {
+		t.Errorf("Expected median 10s and MAD 50ms over 6 runs, got %v, %v over %d", slow.BaselineMedian, slow.BaselineMAD, slow.Samples)
+	}
+	if !fast.IsSpeedup() || fast.Severity != "low" || fast.Impact != -6*time.Second || fast.Deviation >= 0 {
+		t.Errorf("Expected a 6s speed-up of 'Pay by voucher', got %+v", fast)
+	}
+}
+
+func TestEngine_ResolveScenarioIdentities_FollowsRename(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	newRun := func(i int, heading string, line int) *models.EnhancedSuiteResult {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), []string{heading, "Refund"}, nil)
+		spec := suite.SpecResults[0]
+		spec.Scenarios[0].LineStart = line
+		spec.Scenarios[0].Steps = []*models.StepResult{{StepText: "Open checkout"}, {StepText: "Enter card"}, {StepText: "Pay"}}
+		spec.Scenarios[1].LineStart = 20
+		spec.Scenarios[1].Steps = []*models.StepResult{{StepText: "Open orders"}, {StepText: "Refund"}}
+		spec.AssignScenarioIDs("")
+		engine.ResolveScenarioIdentities(suite)
+		return suite
+	}
+
+	first := newRun(0, "Pay by card", 5)
+	original := first.SpecResults[0].Scenarios[0].ID
+	if err := engine.SaveExecutionData(first, "exec-0"); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	renamed := newRun(1, "Pay with a credit card", 5)
+	if got := renamed.SpecResults[0].Scenarios[0].ID; got != original {
+		t.Fatalf("Expected renamed scenario to keep ID %s, got %s", original, got)
+	}
+	if err := engine.SaveExecutionData(renamed, "exec-1"); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	// The recorded alias applies even after the scenario moves
+	moved := newRun(2, "Pay with a credit card", 12)
+	if got := moved.SpecResults[0].Scenarios[0].ID; got != original {
+		t.Errorf("Expected alias to resolve to %s, got %s", original, got)
+	}
+
+	history, err := engine.db.GetScenarioHistory(scenarioKey(moved.SpecResults[0], moved.SpecResults[0].Scenarios[0]), storage.Partition{}, 30)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("Expected history from both headings, got %d records", len(history))
+	}
+}
+
+func TestEngine_GenerateTrends_ScopedToEnvironment(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for i, env := range []string{"production", "staging", "production", "staging"} {
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), []string{"Pay by card"}, nil)
+		suite.ProjectName = "shop"
+		suite.Environment = env
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	current := newTestSuite(time.Now(), []string{"Pay by card"}, nil)
+	current.ProjectName = "shop"
+	current.Environment = "staging"
+
+	trends := engine.GenerateTrends(current)
+	if len(trends.HistoricalRuns) != 2 {
+		t.Errorf("Expected only the 2 staging runs, got %d", len(trends.HistoricalRuns))
+	}
+}
+
+func TestEngine_GenerateTrends_Window(t *testing.T) {
+	engine := newTestEngine(t)
+	now := time.Now().Truncate(time.Second)
+	scenarios := []string{"Pay by card"}
+
+	// Card fails every other run over three weeks
+	ages := []time.Duration{20 * 24 * time.Hour, 10 * 24 * time.Hour, 3 * 24 * time.Hour, 24 * time.Hour, time.Hour}
+	for i, age := range ages {
+		suite := newTestSuite(now.Add(-age), scenarios, map[string]bool{"Pay by card": i%2 == 1})
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+	current := newTestSuite(now, scenarios, nil)
+
+	engine.config.TrendWindowDays = 7
+	flaky, _ := engine.DetectUnstableTests(current)
+	if len(flaky) != 1 || flaky[0].Occurrences != 4 {
+		t.Fatalf("Expected 3 runs within 7 days and this one, got %+v", flaky)
+	}
+
+	// Pruned runs come back as daily aggregates, within the same window
+	if _, err := engine.db.Prune(storage.RetentionPolicy{MaxRuns: 3}, false); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	for days, want := range map[int]int{7: 3, 30: 5} {
+		engine.config.TrendWindowDays = days
+		trends := engine.GenerateTrends(current)
+		if len(trends.HistoricalRuns) != want || trends.WindowDays != days {
+			t.Errorf("Expected %d trend points over %d days, got %d over %d", want, days, len(trends.HistoricalRuns), trends.WindowDays)
+		}
+	}
+}
+
+func TestEngine_DetectUnstableTests(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	scenarios := []string{"Pay by card", "Pay by voucher"}
+
+	// Card alternates; voucher passed three times, then broke for good
+	for i := 0; i < 6; i++ {
+		failing := map[string]bool{"Pay by card": i%2 == 1, "Pay by voucher": i >= 3}
+		suite := newTestSuite(start.Add(time.Duration(i)*time.Minute), scenarios, failing)
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	current := newTestSuite(start.Add(10*time.Minute), scenarios, map[string]bool{"Pay by voucher": true})
+	flaky, broken := engine.DetectUnstableTests(current)
+
+	if len(flaky) != 1 || flaky[0].ScenarioName != "Pay by card" {
+		t.Fatalf("Expected only 'Pay by card' to be flaky, got %+v", flaky)
+	}
+	if flaky[0].FlakyScore != 1.0 || flaky[0].ConsecutivePasses != 1 || flaky[0].Occurrences != 7 {
+		t.Errorf("Expected score 1.0, 1 trailing pass and 7 runs, got %+v", flaky[0])
+	}
+
+	if len(broken) != 1 || broken[0].ScenarioName != "Pay by voucher" {
+		t.Fatalf("Expected 'Pay by voucher' to be broken, got %+v", broken)
+	}
+	if broken[0].ConsecutiveFails != 4 || !broken[0].BrokenSince.Equal(start.Add(3*time.Minute)) {
+		t.Errorf("Expected 4 failures since the fourth run, got %d since %v", broken[0].ConsecutiveFails, broken[0].BrokenSince)
+	}
+}
+
+// seedHistory records runs of a suite with the given number of scenarios,
+// every third scenario failing intermittently
+func seedHistory(tb testing.TB, engine *Engine, scenarios, runs int) *models.EnhancedSuiteResult {
+	tb.Helper()
+
+	names := make([]string, scenarios)
+	for i := range names {
+		names[i] = fmt.Sprintf("Scenario %d", i)
+	}
+	start := time.Now().Add(-time.Duration(runs+1) * time.Hour)
+	for run := 0; run < runs; run++ {
+		failing := make(map[string]bool)
+		for i, name := range names {
+			failing[name] = i%3 == 0 && (run+i)%2 == 0
+		}
+		suite := newTestSuite(start.Add(time.Duration(run)*time.Hour), names, failing)
+		suite.SpecResults[0].AssignScenarioIDs("")
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", run)); err != nil {
+			tb.Fatalf("Failed to seed run %d: %v", run, err)
+		}
+	}
+	suite := newTestSuite(time.Now(), names, nil)
+	suite.SpecResults[0].AssignScenarioIDs("")
+	return suite
+}
+
+func BenchmarkEngine_DetectUnstableTests(b *testing.B) {
+	logger.SetLevel("error")
+	defer logger.SetLevel("info")
+
+	engine := newTestEngine(b)
+	suite := seedHistory(b, engine, 600, 20)
+	partition := engine.partition(suite)
+
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if flaky, _ := engine.DetectUnstableTests(suite); len(flaky) != 200 {
+				b.Fatalf("Expected 200 flaky scenarios, got %d", len(flaky))
+			}
+		}
+	})
+
+	// The query-per-scenario approach batching replaced, for comparison
+	b.Run("per-scenario", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, scenario := range suite.SpecResults[0].Scenarios {
+				runs, err := engine.db.GetScenarioRunsByKey(scenarioKey(suite.SpecResults[0], scenario), partition, 30)
+				if err != nil {
+					b.Fatalf("Failed to load runs: %v", err)
+				}
+				storage.AssessFlakiness(runs)
+			}
+		}
+	})
+}
+
+func TestEngine_SuggestQuarantine(t *testing.T) {
+	engine := newTestEngine(t)
+	engine.config.QuarantineReleaseAfter = 3
+	engine.config.QuarantineSuggestMinRuns = 4
+	engine.config.QuarantineSuggestScore = 0.5
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	scenarios := []string{"Pay by card", "Pay by voucher", "Pay by gift card", "Pay by cash"}
+
+	// Card failed once, then kept passing; voucher kept failing; gift card
+	// alternates; cash always passes
+	for i := 0; i < 4; i++ {
+		failing := map[string]bool{"Pay by card": i == 0, "Pay by voucher": true, "Pay by gift card": i%2 == 0}
+		if err := engine.SaveExecutionData(newTestSuite(start.Add(time.Duration(i)*time.Minute), scenarios, failing), fmt.Sprintf("exec-%d", i)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", i, err)
+		}
+	}
+
+	list := &quarantine.List{Entries: []*quarantine.Entry{
+		{Scenario: "Pay by card", Owner: "payments-team"},
+		{Scenario: "Pay by voucher", Owner: "payments-team"},
+		{Scenario: "Pay by cash", Owner: "till-team", Expires: "2020-01-31"},
+	}}
+	current := newTestSuite(start.Add(10*time.Minute), scenarios, map[string]bool{"Pay by voucher": true, "Pay by gift card": true})
+	list.Apply(current, time.Now())
+
+	suggestions := engine.SuggestQuarantine(current, list, time.Now())
+	got := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		got = append(got, suggestion.Action+" "+suggestion.ScenarioName)
+	}
+	want := []string{"add Pay by gift card", "release Pay by card", "release Pay by cash"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("Expected suggestions %v, got %v", want, got)
+	}
+	if !strings.Contains(suggestions[0].Reason, "4 pass/fail flips in 5 runs") {
+		t.Errorf("Expected the flips as evidence, got %q", suggestions[0].Reason)
+	}
+	if !strings.Contains(suggestions[1].Reason, "passed the last 4 runs in a row") {
+		t.Errorf("Expected the passing streak as reason, got %q", suggestions[1].Reason)
+	}
+	if !strings.Contains(suggestions[2].Reason, "expired on 2020-01-31") {
+		t.Errorf("Expected the expiry as reason, got %q", suggestions[2].Reason)
+	}
+
+	// Without this run, history alone gives the same verdicts
+	fromHistory, err := engine.QuarantineSuggestions(list, storage.Partition{}, 30, time.Now())
+	if err != nil {
+		t.Fatalf("QuarantineSuggestions failed: %v", err)
+	}
+	if len(fromHistory) != 3 || fromHistory[0].Action != "add" || fromHistory[0].ScenarioName != "Pay by gift card" {
+		t.Errorf("Expected gift card to be suggested first from history, got %+v", fromHistory)
+	}
+}
+
+func TestEngine_SaveExecutionData_LeavesOutQuarantined(t *testing.T) {
+	engine := newTestEngine(t)
+	timestamp := time.Now().AddDate(0, 0, -40).Truncate(time.Second)
+	suite := newTestSuite(timestamp, []string{"Pay by card", "Pay by voucher", "Pay by cash"},
+		map[string]bool{"Pay by voucher": true, "Pay by cash": true})
+	list := &quarantine.List{Entries: []*quarantine.Entry{{Scenario: "Pay by cash"}}}
+	list.Apply(suite, time.Now())
+	if err := engine.SaveExecutionData(suite, "exec-0"); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	exec, err := engine.db.GetExecution("exec-0")
+	if err != nil || exec == nil {
+		t.Fatalf("Failed to load execution: %+v (%v)", exec, err)
+	}
+	if exec.TotalScenarios != 2 || exec.PassedScenarios+exec.FailedScenarios+exec.SkippedScenarios != exec.TotalScenarios {
+		t.Errorf("Expected 2 counted scenarios adding up, got %+v", exec)
+	}
+	if exec.SuccessRate != 50 {
+		t.Errorf("Expected success rate 50, got %.1f", exec.SuccessRate)
+	}
+
+	// Rates rolled up from the stored counts agree
+	if _, err := engine.db.Prune(storage.RetentionPolicy{MaxAgeDays: 30}, false); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	aggregates, err := engine.db.GetDailyAggregates(storage.Partition{}, 60)
+	if err != nil || len(aggregates) != 1 {
+		t.Fatalf("Expected one daily aggregate, got %+v (%v)", aggregates, err)
+	}
+	if rate := aggregates[0].SuccessRate(); rate != exec.SuccessRate {
+		t.Errorf("Expected the aggregate success rate %.1f, got %.1f", exec.SuccessRate, rate)
+	}
+}
+
+func TestEngine_Analyze_StreamLanes(t *testing.T) {
+	engine := newTestEngine(t)
+	start := time.Now().Truncate(time.Second)
+	span := func(stream int, spec string, from, to int, status string) *models.ExecutionSpan {
+		return &models.ExecutionSpan{
+			Stream: stream, SpecName: spec, Status: status,
+			Start: start.Add(time.Duration(from) * time.Second),
+			End:   start.Add(time.Duration(to) * time.Second),
+		}
+	}
+
+	suite := newTestSuite(start, []string{"Pay by card"}, nil)
+	suite.ExecutionSpans = []*models.ExecutionSpan{
+		span(1, "Checkout", 0, 6, "passed"),
+		span(2, "Login", 1, 5, "failed"),
+		span(1, "Search", 6, 10, "passed"),
+	}
+	analytics := engine.Analyze(suite)
+
+	if analytics.TimelineEstimated || len(analytics.TimelineData) != 6 {
+		t.Fatalf("Expected 6 recorded timeline entries, got %d (estimated %v)", len(analytics.TimelineData), analytics.TimelineEstimated)
+	}
+	if entry := analytics.TimelineData[2]; entry.SpecName != "Login" || entry.Event != "failure" || entry.Stream != 2 {
+		t.Errorf("Expected Login to fail on stream 2 third, got %+v", entry)
+	}
+
+	if len(analytics.StreamLanes) != 2 {
+		t.Fatalf("Expected 2 stream lanes, got %d", len(analytics.StreamLanes))
+	}
+	first, second := analytics.StreamLanes[0], analytics.StreamLanes[1]
+	if first.Stream != 1 || first.Busy != 10*time.Second || first.Idle != 0 || len(first.Segments) != 2 {
+		t.Errorf("Expected stream 1 busy for 10s with 2 specs, got %+v", first)
+	}
+	if second.Idle != 6*time.Second || second.Segments[0].Offset != 10 || second.Segments[0].Width != 40 {
+		t.Errorf("Expected stream 2 idle for 6s with Login at 10%%-50%%, got %+v / %+v", second, second.Segments[0])
+	}
+
+	parallel := analytics.Parallel
+	if parallel.Streams != 2 || parallel.WallClock != 10*time.Second || parallel.IdleTime != 6*time.Second {
+		t.Errorf("Expected 2 streams over 10s with 6s idle, got %+v", parallel)
+	}
+	if got := fmt.Sprintf("%.1f %.1f %.2f", parallel.Utilization, parallel.Imbalance, parallel.Speedup); got != "70.0 42.9 1.40" {
+		t.Errorf("Expected 70%% utilization, 42.9%% imbalance and 1.4x speed-up, got %s", got)
+	}
+
+	// Without recorded spans the timeline is estimated and there are no lanes
+	suite.ExecutionSpans = nil
+	analytics = engine.Analyze(suite)
+	if !analytics.TimelineEstimated || analytics.StreamLanes != nil || analytics.Parallel != nil || len(analytics.TimelineData) != 2 {
+		t.Errorf("Expected an estimated serial timeline, got %+v", analytics)
+	}
+}
+
+func TestEngine_SpecEstimates(t *testing.T) {
+	engine := newTestEngine(t)
+
+	// Checkout takes 10s, 12s and 30s: the median ignores the slow run
+	start := time.Now().Add(-time.Hour)
+	for run, seconds := range []int{10, 30, 12} {
+		suite := newTestSuite(start.Add(time.Duration(run)*time.Minute), []string{"Pay"}, nil)
+		spec := suite.SpecResults[0]
+		spec.RelativePath = "specs/checkout.spec"
+		spec.Tags = []string{"checkout"}
+		spec.ExecutionTime = time.Duration(seconds) * time.Second
+		if err := engine.SaveExecutionData(suite, fmt.Sprintf("exec-%d", run)); err != nil {
+			t.Fatalf("Failed to save run %d: %v", run, err)
+		}
+	}
+
+	estimates, err := engine.SpecEstimates(storage.Partition{}, 30)
+	if err != nil {
+		t.Fatalf("Failed to estimate specs: %v", err)
+	}
+	if len(estimates) != 1 {
+		t.Fatalf("Expected 1 spec, got %d", len(estimates))
+	}
+	got := estimates[0]
+	if got.SpecFile != "specs/checkout.spec" || got.Estimate != 12000 || got.Samples != 3 ||
+		len(got.Tags) != 1 || got.Tags[0] != "checkout" {
+		t.Errorf("Expected specs/checkout.spec at 12000ms over 3 runs tagged checkout, got %s at %dms over %d runs tagged %v",
+			got.SpecFile, got.Estimate, got.Samples, got.Tags)
+	}
+}
+
+func TestAllocateStreams(t *testing.T) {
+	spec := func(file string, seconds int64, tags ...string) *SpecEstimate {
+		return &SpecEstimate{SpecFile: file, Estimate: seconds * 1000, Tags: tags, Samples: 5}
+	}
+
+	// Longest-first puts 3+3 on one stream and 2+2+2 on the other (6s each)
+	// only after rebalancing: greedy alone ends at 3+2+2 = 7s
+	specs := []*SpecEstimate{
+		spec("a.spec", 3), spec("b.spec", 3), spec("c.spec", 2), spec("d.spec", 2), spec("e.spec", 2),
+	}
+	allocation := AllocateStreams(specs, 2, false)
+	if allocation.Serial != 12000 || allocation.LowerBound != 6000 {
+		t.Errorf("Expected serial 12000ms and lower bound 6000ms, got %d and %d", allocation.Serial, allocation.LowerBound)
+	}
+	if allocation.WallClock != 6000 {
+		t.Errorf("Expected a wall-clock of 6000ms, got %d", allocation.WallClock)
+	}
+	seen := 0
+	for _, plan := range allocation.Streams {
+		seen += len(plan.Specs)
+		if plan.Total != 6000 {
+			t.Errorf("Expected stream %d to take 6000ms, got %d", plan.Stream, plan.Total)
+		}
+	}
+	if seen != len(specs) {
+		t.Errorf("Expected every spec allocated once, got %d of %d", seen, len(specs))
+	}
+
+	// More streams than specs leaves streams empty; one long spec bounds the run
+	allocation = AllocateStreams([]*SpecEstimate{spec("long.spec", 10), spec("short.spec", 1)}, 3, false)
+	if allocation.WallClock != 10000 || allocation.LowerBound != 10000 || len(allocation.Streams) != 3 {
+		t.Errorf("Expected 3 streams bounded by the 10000ms spec, got %d streams at %dms (bound %dms)",
+			len(allocation.Streams), allocation.WallClock, allocation.LowerBound)
+	}
+
+	// By tag, specs sharing a first tag stay together and untagged ones are flagged
+	specs = []*SpecEstimate{
+		spec("pay.spec", 4, "checkout"), spec("refund.spec", 4, "checkout"),
+		spec("login.spec", 3, "auth"), spec("logout.spec", 1, "auth", "checkout"),
+		spec("misc.spec", 2),
+	}
+	allocation = AllocateStreams(specs, 2, true)
+	if allocation.WallClock != 8000 {
+		t.Errorf("Expected a wall-clock of 8000ms, got %d", allocation.WallClock)
+	}
+	var expressions []string
+	for _, plan := range allocation.Streams {
+		expression, err := plan.TagExpression()
+		if err != nil {
+			expressions = append(expressions, "error")
+			continue
+		}
+		expressions = append(expressions, expression)
+	}
+	if strings.Join(expressions, ";") != "checkout;error" {
+		t.Errorf("Expected tag expressions checkout and an error for the untagged spec, got %v", expressions)
+	}
+	if len(allocation.Warnings) != 2 ||
+		!strings.Contains(allocation.Warnings[0], "misc.spec has no tags") ||
+		!strings.Contains(allocation.Warnings[1], "logout.spec is also tagged \"checkout\"") {
+		t.Errorf("Expected warnings for misc.spec and logout.spec, got %v", allocation.Warnings)
+	}
+}
+
+func TestReconcileSpecs(t *testing.T) {
+	estimates := []*SpecEstimate{
+		{SpecName: "Pay", SpecFile: "specs/pay.spec", Estimate: 9000, Samples: 4},
+		{SpecName: "Login", SpecFile: "specs/login.spec", Estimate: 3000, Samples: 4},
+		{SpecName: "Gone", SpecFile: "specs/gone.spec", Estimate: 1000, Samples: 4},
+	}
+	onDisk := []*SpecEstimate{
+		{SpecName: "Pay", SpecFile: "specs/pay.spec", Tags: []string{"checkout"}},
+		{SpecName: "Search", SpecFile: "specs/search.spec"},
+	}
+
+	specs := ReconcileSpecs(estimates, onDisk)
+	if len(specs) != 2 {
+		t.Fatalf("Expected the 2 specs on disk, got %d", len(specs))
+	}
+	if specs[0].SpecFile != "specs/pay.spec" || specs[0].Estimate != 9000 || specs[0].Samples != 4 || len(specs[0].Tags) != 1 {
+		t.Errorf("Expected pay.spec with its history and tags, got %+v", specs[0])
+	}
+	if specs[1].SpecFile != "specs/search.spec" || specs[1].Estimate != 3000 || specs[1].Samples != 0 {
+		t.Errorf("Expected search.spec estimated at the 3000ms median, got %+v", specs[1])
+	}
+}
+
+func TestEngine_Analyze_FailureDistribution(t *testing.T) {
+	weight := 5.0
+	classifier, err := classify.New(&classify.File{Rules: []*classify.Rule{
+		{Category: "Payment Gateway", Pattern: `stripe`, Weight: &weight},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to build classifier: %v", err)
+	}
+	engine := NewEngine(config.NewConfig(), nil)
+	engine.SetClassifier(classifier)
+
+	suite := newTestSuite(time.Now(), []string{"Pay", "Refund", "Browse", "Search"},
+		map[string]bool{"Pay": true, "Refund": true, "Browse": true})
+	scenarios := suite.SpecResults[0].Scenarios
+	scenarios[0].Steps[0].ErrorMessage = "Stripe request timed out"
+	scenarios[1].Steps[0].ErrorMessage = "Read timed out"
+	scenarios[2].Steps[0].ErrorMessage = ""
+
+	distribution := engine.Analyze(suite).FailureDistribution
+	want := map[string]int{"Payment Gateway": 1, classify.Timeout: 1, classify.Unknown: 1}
+	if len(distribution) != len(want) {
+		t.Errorf("Expected %v, got %v", want, distribution)
+	}
+	for category, count := range want {
+		if distribution[category] != count {
+			t.Errorf("Expected %d failures in %s, got %d", count, category, distribution[category])
+		}
+	}
+
+	// The failure groups use the same categories
+	analyzer := ai.NewAnalyzer()
+	analyzer.SetClassifier(classifier)
+	for _, group := range analyzer.GroupFailures(suite) {
+		if distribution[string(group.ErrorType)] == 0 {
+			t.Errorf("Failure group category %s is missing from the distribution %v", group.ErrorType, distribution)
+		}
+	}
+}
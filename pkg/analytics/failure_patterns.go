@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// TrackFailurePatterns records every failure group in the history database,
+// marks it as new, recurring or a regression and correlates it with the run
+// that introduced it. It returns the burst of new failures in this run, if
+// any. It must run before SaveExecutionData so the most recent stored
+// execution is the previous run.
+func (e *Engine) TrackFailurePatterns(suite *models.EnhancedSuiteResult, groups []*models.FailureGroup) *models.FailureBurst {
+	if e.db == nil || len(groups) == 0 {
+		return nil
+	}
+
+	partition := e.partition(suite)
+	var previousRun time.Time
+	if recent, err := e.db.GetRecentExecutions(partition, 1); err != nil {
+		logger.Warnf("Failed to load previous execution: %v", err)
+	} else if len(recent) > 0 {
+		previousRun = recent[0].Timestamp
+	}
+
+	var build, commit string
+	if suite.RunMetadata != nil {
+		build, commit = suite.RunMetadata.BuildNumber, suite.RunMetadata.GitCommit
+	}
+
+	var newGroups []*models.FailureGroup
+	for _, group := range groups {
+		existing, err := e.db.GetFailurePattern(partition, group.Signature)
+		if err != nil {
+			logger.Warnf("Failed to load failure pattern %s: %v", group.Signature, err)
+			continue
+		}
+
+		group.Recurrence = classifyRecurrence(existing, previousRun)
+		if existing == nil {
+			group.FirstSeen = suite.Timestamp
+			group.SeenInRuns = 1
+			group.FirstBuild, group.FirstCommit = build, commit
+			newGroups = append(newGroups, group)
+		} else {
+			group.FirstSeen = existing.FirstSeen
+			group.LastSeen = existing.LastSeen
+			group.SeenInRuns = existing.Occurrences + 1
+			group.FirstBuild, group.FirstCommit = existing.FirstBuild, existing.FirstCommit
+			group.IntroducedWith = e.introducedWith(partition, existing)
+		}
+
+		sighting := storage.FailureSighting{
+			Signature:      group.Signature,
+			Pattern:        group.Pattern,
+			Classification: group.ErrorType,
+			SeenAt:         suite.Timestamp,
+			BuildNumber:    build,
+			GitCommit:      commit,
+		}
+		// Built-in suggestions are not analysis worth keeping
+		if group.AISuggested {
+			sighting.AIAnalysis = group.SuggestedFix
+		}
+		if err := e.db.RecordFailurePattern(partition, sighting); err != nil {
+			logger.Warnf("Failed to record failure pattern %s: %v", group.Signature, err)
+		}
+	}
+
+	// Failures new in this run were introduced together
+	for _, group := range newGroups {
+		for _, other := range newGroups {
+			if other != group {
+				group.IntroducedWith = append(group.IntroducedWith, describeGroup(other.Pattern, other.RootCause))
+			}
+		}
+	}
+
+	// On the first run every failure is new; that says nothing about this build
+	if previousRun.IsZero() {
+		return nil
+	}
+	return detectFailureBurst(newGroups, e.config.FailureBurstMinGroups)
+}
+
+// introducedWith describes the other failures first seen in the partition in
+// the same run as a stored signature
+func (e *Engine) introducedWith(partition storage.Partition, pattern *storage.FailurePattern) []string {
+	siblings, err := e.db.GetFailurePatternsFirstSeen(partition, pattern.FirstSeen)
+	if err != nil {
+		logger.Warnf("Failed to load failures introduced with %s: %v", pattern.Signature, err)
+		return nil
+	}
+	var described []string
+	for _, sibling := range siblings {
+		if sibling.Signature != pattern.Signature {
+			described = append(described, describeGroup(sibling.Pattern, sibling.Classification))
+		}
+	}
+	return described
+}
+
+// describeGroup names a failure by its normalized message, or by the
+// fallback for signatures recorded before messages were stored
+func describeGroup(pattern, fallback string) string {
+	if pattern != "" {
+		return pattern
+	}
+	return fallback
+}
+
+// detectFailureBurst flags a run whose new failure groups reach minGroups
+// and span more than one spec: unrelated scenarios starting to fail together
+// more likely share one cause than contain as many new bugs
+func detectFailureBurst(newGroups []*models.FailureGroup, minGroups int) *models.FailureBurst {
+	if minGroups <= 0 || len(newGroups) < minGroups {
+		return nil
+	}
+
+	burst := &models.FailureBurst{NewGroups: len(newGroups)}
+	seen := make(map[string]bool)
+	for _, group := range newGroups {
+		burst.Scenarios += group.Count
+		for _, spec := range group.AffectedSpecs {
+			if !seen[spec] {
+				seen[spec] = true
+				burst.Specs = append(burst.Specs, spec)
+			}
+		}
+	}
+	if len(burst.Specs) < 2 {
+		return nil
+	}
+	sort.Strings(burst.Specs)
+	return burst
+}
+
+// classifyRecurrence decides how a signature relates to earlier runs. A known
+// signature that was absent from the previous run has come back: a regression.
+func classifyRecurrence(existing *storage.FailurePattern, previousRun time.Time) string {
+	if existing == nil {
+		return "new"
+	}
+	if !previousRun.IsZero() && existing.LastSeen.Before(previousRun) {
+		return "regression"
+	}
+	return "recurring"
+}
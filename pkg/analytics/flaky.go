@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// UnstableScenarios rates every scenario run recorded for a partition in the
+// last N days and returns the flaky ones, most flaky first, and the ones that
+// have been failing consistently
+func (e *Engine) UnstableScenarios(partition storage.Partition, days int) (flaky, broken []*models.FlakyTest, err error) {
+	flaky = make([]*models.FlakyTest, 0)
+	broken = make([]*models.FlakyTest, 0)
+	if e.db == nil {
+		return flaky, broken, nil
+	}
+
+	runs, err := e.db.GetScenarioOutcomes(partition, days)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, scenarioRuns := range storage.GroupScenarioRuns(runs) {
+		latest := scenarioRuns[len(scenarioRuns)-1] // runs are oldest first
+		test := unstableTest(latest.SpecName, latest.ScenarioName, scenarioRuns)
+		switch {
+		case test == nil:
+		case test.IsBroken():
+			broken = append(broken, test)
+		default:
+			flaky = append(flaky, test)
+		}
+	}
+
+	sortUnstable(flaky, broken)
+	return flaky, broken, nil
+}
+
+// unstableTest rates the runs of one scenario, oldest first. It returns nil
+// for a stable scenario, a "flaky" verdict when the score exceeds
+// flakyThreshold and otherwise a "broken" one if the latest runs all failed.
+func unstableTest(specName, scenarioName string, runs []storage.ScenarioRun) *models.FlakyTest {
+	f := storage.AssessFlakiness(runs)
+
+	test := &models.FlakyTest{
+		SpecName:          specName,
+		ScenarioName:      scenarioName,
+		FlakyScore:        f.Score,
+		FailureRate:       f.FailureRate(),
+		ConsecutivePasses: f.ConsecutivePasses,
+		ConsecutiveFails:  f.ConsecutiveFails,
+		Occurrences:       f.Runs,
+	}
+	if len(runs) > 0 {
+		test.LastSeen = runs[len(runs)-1].Timestamp
+	}
+
+	switch {
+	case f.Score > flakyThreshold:
+		test.Verdict = "flaky"
+		test.Evidence = flakyEvidence(f)
+	case f.Broken():
+		test.Verdict = "broken"
+		test.BrokenSince = f.StreakStart
+		test.Evidence = append(test.Evidence, fmt.Sprintf("failed the last %d runs in a row since %s",
+			f.ConsecutiveFails, f.StreakStart.Format("2006-01-02")))
+	default:
+		return nil
+	}
+	return test
+}
+
+// flakyEvidence explains a flaky score
+func flakyEvidence(f storage.Flakiness) []string {
+	var evidence []string
+	if f.Flips > 0 {
+		evidence = append(evidence, fmt.Sprintf("%d pass/fail flips in %d runs", f.Flips, f.Runs))
+	}
+	if f.SameCommitConflicts > 0 {
+		evidence = append(evidence, fmt.Sprintf("passed and failed on the same commit (%d commit(s))", f.SameCommitConflicts))
+	}
+	if f.RetryPasses > 0 {
+		evidence = append(evidence, fmt.Sprintf("passed only after a retry in %d run(s)", f.RetryPasses))
+	}
+	return evidence
+}
+
+// sortUnstable orders flaky tests by score and broken tests by how long they
+// have been failing, longest first
+func sortUnstable(flaky, broken []*models.FlakyTest) {
+	sort.SliceStable(flaky, func(i, j int) bool {
+		return flaky[i].FlakyScore > flaky[j].FlakyScore
+	})
+	sort.SliceStable(broken, func(i, j int) bool {
+		return broken[i].BrokenSince.Before(broken[j].BrokenSince)
+	})
+}
+
+// withCurrentRun returns the scenario's indexed runs followed by this run
+func withCurrentRun(history *storage.ScenarioRunIndex, suite *models.EnhancedSuiteResult, spec *models.SpecResult, scenario *models.ScenarioResult) []storage.ScenarioRun {
+	commit := ""
+	if suite.RunMetadata != nil {
+		commit = suite.RunMetadata.GitCommit
+	}
+
+	// Capped so appending this run copies instead of writing into the index
+	past := history.Runs(scenarioKey(spec, scenario))
+	return append(past[:len(past):len(past)], storage.ScenarioRun{
+		ScenarioRecord: storage.ScenarioRecord{Status: scenarioStatus(scenario), Retries: scenario.Retries},
+		Timestamp:      suite.Timestamp,
+		GitCommit:      commit,
+	})
+}
+
+// scenarioStatus returns the status a scenario is recorded with in history
+func scenarioStatus(scenario *models.ScenarioResult) string {
+	switch {
+	case scenario.Failed:
+		return "failed"
+	case scenario.Skipped:
+		return "skipped"
+	default:
+		return "passed"
+	}
+}
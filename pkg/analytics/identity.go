@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"strings"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+const (
+	// renameSimilarityInPlace is the step similarity needed to treat a new
+	// heading at a previously recorded line as a rename
+	renameSimilarityInPlace = 0.5
+	// renameSimilarityMoved is the step similarity needed when the scenario
+	// also moved within the file
+	renameSimilarityMoved = 0.8
+)
+
+// ResolveScenarioIdentities maps each scenario's derived ID to the ID its
+// history is recorded under. A scenario with no history that closely matches
+// one that disappeared from the same spec file (same line, or near-identical
+// steps) is treated as renamed, and the rename is remembered.
+func (e *Engine) ResolveScenarioIdentities(suite *models.EnhancedSuiteResult) {
+	if e.db == nil {
+		return
+	}
+
+	aliases, err := e.db.GetScenarioAliases()
+	if err != nil {
+		logger.Warnf("Failed to load scenario aliases: %v", err)
+		return
+	}
+
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			if canonical, ok := aliases[scenario.ID]; ok {
+				scenario.ID = canonical
+			}
+		}
+		if spec.RelativePath != "" {
+			e.detectRenames(spec)
+		}
+	}
+}
+
+// detectRenames pairs scenarios without history with recorded scenarios of the
+// same spec file that are missing from this run
+func (e *Engine) detectRenames(spec *models.SpecResult) {
+	snapshots, err := e.db.GetScenarioSnapshots(spec.RelativePath, e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load scenario history for %s: %v", spec.RelativePath, err)
+		return
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+
+	known := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		known[snapshot.ScenarioID] = true
+	}
+	present := make(map[string]bool, len(spec.Scenarios))
+	for _, scenario := range spec.Scenarios {
+		present[scenario.ID] = true
+	}
+
+	for _, scenario := range spec.Scenarios {
+		if scenario.ID == "" || known[scenario.ID] {
+			continue
+		}
+
+		steps := scenario.StepTexts()
+		var best *storage.ScenarioSnapshot
+		bestScore := 0.0
+		for i := range snapshots {
+			candidate := &snapshots[i]
+			if present[candidate.ScenarioID] || candidate.RowIndex != scenario.RowIndex {
+				continue
+			}
+			score := stepSimilarity(steps, strings.Split(candidate.Content, "\n"))
+			threshold := renameSimilarityMoved
+			if scenario.LineStart > 0 && candidate.LineStart == scenario.LineStart {
+				threshold = renameSimilarityInPlace
+			}
+			if score >= threshold && score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		logger.Infof("Scenario %q looks like a rename of %q (%.0f%% step similarity); keeping its history",
+			scenario.ScenarioHeading, best.ScenarioName, bestScore*100)
+		if err := e.db.AddScenarioAlias(scenario.ID, best.ScenarioID); err != nil {
+			logger.Warnf("Failed to record scenario rename: %v", err)
+		}
+		scenario.ID = best.ScenarioID
+		present[best.ScenarioID] = true
+	}
+}
+
+// stepSimilarity is the Jaccard similarity of two scenarios' step texts
+func stepSimilarity(a, b []string) float64 {
+	setA := make(map[string]bool, len(a))
+	for _, step := range a {
+		if step != "" {
+			setA[step] = true
+		}
+	}
+	setB := make(map[string]bool, len(b))
+	for _, step := range b {
+		if step != "" {
+			setB[step] = true
+		}
+	}
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for step := range setA {
+		if setB[step] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
@@ -0,0 +1,222 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// minStepSlowdown ignores regressions too small to matter, whatever the ratio
+const minStepSlowdown = 100 * time.Millisecond
+
+// minScenarioChange ignores scenario duration changes too small to matter,
+// however steady the scenario was
+const minScenarioChange = 250 * time.Millisecond
+
+// madScale turns a median absolute deviation into an estimate of the
+// standard deviation of normally distributed durations
+const madScale = 1.4826
+
+// minSpreadRatio is the least spread assumed for a scenario, as a share of its
+// median, so a perfectly steady history does not make every change significant
+const minSpreadRatio = 0.01
+
+// AnalyzePerformance compares this run's timings with their history and
+// reports the bottlenecks found
+func (e *Engine) AnalyzePerformance(suite *models.EnhancedSuiteResult) *models.PerformanceMetrics {
+	metrics := &models.PerformanceMetrics{
+		Bottlenecks: make([]*models.Bottleneck, 0),
+	}
+
+	if e.db == nil {
+		return metrics
+	}
+
+	metrics.Bottlenecks = append(metrics.Bottlenecks, e.detectStepRegressions(suite)...)
+	metrics.Bottlenecks = append(metrics.Bottlenecks, e.detectScenarioAnomalies(suite)...)
+
+	sort.SliceStable(metrics.Bottlenecks, func(i, j int) bool {
+		return metrics.Bottlenecks[i].Impact > metrics.Bottlenecks[j].Impact
+	})
+	return metrics
+}
+
+// detectStepRegressions flags steps that ran significantly slower than their
+// historical median and p95
+func (e *Engine) detectStepRegressions(suite *models.EnhancedSuiteResult) []*models.Bottleneck {
+	history, err := e.db.GetStepDurations(e.partition(suite), e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load step history: %v", err)
+		return nil
+	}
+
+	// Keep the slowest occurrence of each step text in this run
+	worst := make(map[string]*models.Bottleneck)
+	var order []string
+
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			for _, step := range scenario.Steps {
+				samples := history[step.StepText]
+				if step.StepText == "" || len(samples) < e.config.HistoryMinSamples {
+					continue
+				}
+
+				baseline := time.Duration(median(samples)) * time.Millisecond
+				p95 := time.Duration(percentile(samples, 95)) * time.Millisecond
+				current := step.ExecutionTime
+
+				if current <= p95 || current-baseline < minStepSlowdown {
+					continue
+				}
+				ratio := float64(current) / float64(baseline)
+				if baseline > 0 && ratio < e.config.StepRegressionThreshold {
+					continue
+				}
+
+				if existing, ok := worst[step.StepText]; ok && existing.Duration >= current {
+					continue
+				}
+				if _, ok := worst[step.StepText]; !ok {
+					order = append(order, step.StepText)
+				}
+
+				worst[step.StepText] = &models.Bottleneck{
+					Location:       fmt.Sprintf("%s › %s › %s", spec.SpecHeading, scenario.ScenarioHeading, step.StepText),
+					Type:           "slow_step",
+					Severity:       regressionSeverity(baseline, current),
+					Impact:         current - baseline,
+					Duration:       current,
+					BaselineMedian: baseline,
+					BaselineP95:    p95,
+					Samples:        len(samples),
+					Recommendations: []string{
+						fmt.Sprintf("Step took %s vs a historical median of %s (p95 %s over %d runs)",
+							FormatDuration(current), FormatDuration(baseline), FormatDuration(p95), len(samples)),
+						"Check recent changes to the step implementation and the services it calls",
+					},
+				}
+			}
+		}
+	}
+
+	bottlenecks := make([]*models.Bottleneck, 0, len(order))
+	for _, stepText := range order {
+		bottlenecks = append(bottlenecks, worst[stepText])
+	}
+	return bottlenecks
+}
+
+// detectScenarioAnomalies compares the duration of each passed scenario with
+// its own passed runs in history. A duration is anomalous when its robust
+// z-score, the distance from the median in scaled MADs, exceeds
+// config.DurationAnomalyThreshold and it lies outside the p5-p95 range.
+// Speed-ups are reported too, as they can mean the scenario stopped doing
+// part of its work.
+func (e *Engine) detectScenarioAnomalies(suite *models.EnhancedSuiteResult) []*models.Bottleneck {
+	outcomes, err := e.db.GetScenarioOutcomes(e.partition(suite), e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load scenario history: %v", err)
+		return nil
+	}
+	history := storage.IndexScenarioRuns(outcomes)
+
+	bottlenecks := make([]*models.Bottleneck, 0)
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			if scenarioStatus(scenario) != "passed" {
+				continue // failed runs stop early and are no measure of speed
+			}
+
+			var samples []int64
+			for _, run := range history.Runs(scenarioKey(spec, scenario)) {
+				if run.Status == "passed" {
+					samples = append(samples, run.Duration)
+				}
+			}
+			if len(samples) == 0 || len(samples) < e.config.HistoryMinSamples {
+				continue
+			}
+
+			center := median(samples)
+			spread := max(medianAbsoluteDeviation(samples, center)*madScale, center*minSpreadRatio, 1)
+			current := scenario.ExecutionTime
+			change := float64(current.Milliseconds()) - center
+			deviation := change / spread
+
+			if math.Abs(change) < float64(minScenarioChange.Milliseconds()) || math.Abs(deviation) < e.config.DurationAnomalyThreshold {
+				continue
+			}
+			p95 := percentile(samples, 95)
+			if (change > 0 && float64(current.Milliseconds()) <= p95) ||
+				(change < 0 && float64(current.Milliseconds()) >= percentile(samples, 5)) {
+				continue
+			}
+
+			baseline := time.Duration(center) * time.Millisecond
+			mad := time.Duration(medianAbsoluteDeviation(samples, center)) * time.Millisecond
+			bottleneck := &models.Bottleneck{
+				Location:       fmt.Sprintf("%s › %s", spec.SpecHeading, scenario.ScenarioHeading),
+				Type:           "slow_scenario",
+				Severity:       anomalySeverity(deviation, e.config.DurationAnomalyThreshold),
+				Impact:         current - baseline,
+				Duration:       current,
+				BaselineMedian: baseline,
+				BaselineP95:    time.Duration(p95) * time.Millisecond,
+				BaselineMAD:    mad,
+				Deviation:      deviation,
+				Samples:        len(samples),
+				Recommendations: []string{
+					fmt.Sprintf("Scenario took %s vs a historical median of %s (MAD %s over %d passed runs), %.1f deviations away",
+						FormatDuration(current), FormatDuration(baseline), FormatDuration(mad), len(samples), math.Abs(deviation)),
+				},
+			}
+			if change > 0 {
+				bottleneck.Recommendations = append(bottleneck.Recommendations,
+					"Look for slower steps in this scenario and recent changes to the services it calls")
+			} else {
+				bottleneck.Type = "fast_scenario"
+				bottleneck.Recommendations = append(bottleneck.Recommendations,
+					"Check that the scenario still exercises everything it should, e.g. no steps skipped or data cached")
+			}
+			bottlenecks = append(bottlenecks, bottleneck)
+		}
+	}
+	return bottlenecks
+}
+
+// anomalySeverity grades a scenario duration anomaly by its robust z-score.
+// Speed-ups are informational.
+func anomalySeverity(deviation, threshold float64) string {
+	switch {
+	case deviation < 0:
+		return "low"
+	case deviation >= 3*threshold:
+		return "critical"
+	case deviation >= 2*threshold:
+		return "high"
+	default:
+		return "medium"
+	}
+}
+
+// regressionSeverity grades a slowdown by how many times slower than baseline it is
+func regressionSeverity(baseline, current time.Duration) string {
+	if baseline <= 0 {
+		return "high"
+	}
+	ratio := float64(current) / float64(baseline)
+	switch {
+	case ratio >= 3:
+		return "critical"
+	case ratio >= 2:
+		return "high"
+	default:
+		return "medium"
+	}
+}
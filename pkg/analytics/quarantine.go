@@ -0,0 +1,114 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/quarantine"
+	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
+)
+
+// SuggestQuarantine proposes quarantining the run's flaky scenarios and
+// releasing quarantined ones that expired or have passed consistently, rating
+// each scenario's history with this run included. Broken scenarios are not
+// proposed: they fail for a reason and need a fix, not a quarantine.
+func (e *Engine) SuggestQuarantine(suite *models.EnhancedSuiteResult, list *quarantine.List, now time.Time) []*models.QuarantineSuggestion {
+	if e.db == nil || list == nil {
+		return nil
+	}
+
+	outcomes, err := e.db.GetScenarioOutcomes(e.partition(suite), e.config.TrendWindowDays)
+	if err != nil {
+		logger.Warnf("Failed to load scenario history: %v", err)
+		return nil
+	}
+	history := storage.IndexScenarioRuns(outcomes)
+
+	var suggestions []*models.QuarantineSuggestion
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			f := storage.AssessFlakiness(withCurrentRun(history, suite, spec, scenario))
+			if suggestion := e.quarantineSuggestion(spec, scenario, list.Find(spec, scenario), f, now); suggestion != nil {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+
+	sortSuggestions(suggestions)
+	return suggestions
+}
+
+// QuarantineSuggestions rates every scenario recorded for a partition in the
+// last N days against the quarantine list, like SuggestQuarantine does for
+// the scenarios of one run
+func (e *Engine) QuarantineSuggestions(list *quarantine.List, partition storage.Partition, days int, now time.Time) ([]*models.QuarantineSuggestion, error) {
+	suggestions := make([]*models.QuarantineSuggestion, 0)
+	if e.db == nil {
+		return suggestions, nil
+	}
+
+	runs, err := e.db.GetScenarioOutcomes(partition, days)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scenarioRuns := range storage.GroupScenarioRuns(runs) {
+		latest := scenarioRuns[len(scenarioRuns)-1] // runs are oldest first
+		spec := &models.SpecResult{SpecHeading: latest.SpecName, RelativePath: latest.SpecFile}
+		scenario := &models.ScenarioResult{ID: latest.ScenarioID, ScenarioHeading: latest.ScenarioName}
+
+		f := storage.AssessFlakiness(scenarioRuns)
+		if suggestion := e.quarantineSuggestion(spec, scenario, list.Find(spec, scenario), f, now); suggestion != nil {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	sortSuggestions(suggestions)
+	return suggestions, nil
+}
+
+// quarantineSuggestion applies the configured thresholds to one scenario.
+// entry is the quarantine entry naming it, if any.
+func (e *Engine) quarantineSuggestion(spec *models.SpecResult, scenario *models.ScenarioResult, entry *quarantine.Entry, f storage.Flakiness, now time.Time) *models.QuarantineSuggestion {
+	suggestion := &models.QuarantineSuggestion{
+		SpecName:     spec.SpecHeading,
+		SpecFile:     spec.RelativePath,
+		ScenarioName: scenario.ScenarioHeading,
+		ScenarioID:   scenario.ID,
+		FlakyScore:   f.Score,
+		Runs:         f.Runs,
+	}
+
+	switch {
+	case entry != nil && entry.Expired(now):
+		suggestion.Action = "release"
+		suggestion.Reason = fmt.Sprintf("quarantine expired on %s (owner: %s)", entry.Expires, entry.OwnerOrUnknown())
+	case entry != nil:
+		if e.config.QuarantineReleaseAfter <= 0 || f.ConsecutivePasses < e.config.QuarantineReleaseAfter {
+			return nil
+		}
+		suggestion.Action = "release"
+		suggestion.Reason = fmt.Sprintf("passed the last %d runs in a row (owner: %s)", f.ConsecutivePasses, entry.OwnerOrUnknown())
+	default:
+		if f.Runs < e.config.QuarantineSuggestMinRuns || f.Score < e.config.QuarantineSuggestScore || f.Score == 0 {
+			return nil
+		}
+		suggestion.Action = "add"
+		suggestion.Reason = fmt.Sprintf("flaky score %.2f over %d runs: %s", f.Score, f.Runs, strings.Join(flakyEvidence(f), ", "))
+	}
+	return suggestion
+}
+
+// sortSuggestions puts additions first, most flaky first, then releases
+func sortSuggestions(suggestions []*models.QuarantineSuggestion) {
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Action != suggestions[j].Action {
+			return suggestions[i].Action == "add"
+		}
+		return suggestions[i].Action == "add" && suggestions[i].FlakyScore > suggestions[j].FlakyScore
+	})
+}
@@ -0,0 +1,39 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+// percentile returns the p-th percentile (0-100) of values using linear
+// interpolation between closest ranks. values must not be empty.
+func percentile(values []int64, p float64) float64 {
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	if len(sorted) == 1 {
+		return float64(sorted[0])
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return float64(sorted[lower])*(1-weight) + float64(sorted[upper])*weight
+}
+
+// median returns the 50th percentile of values
+func median(values []int64) float64 {
+	return percentile(values, 50)
+}
+
+// medianAbsoluteDeviation returns the median distance of values from their
+// median, a spread measure that a few outliers do not inflate
+func medianAbsoluteDeviation(values []int64, center float64) float64 {
+	deviations := make([]int64, len(values))
+	for i, v := range values {
+		deviations[i] = int64(math.Round(math.Abs(float64(v) - center)))
+	}
+	return median(deviations)
+}
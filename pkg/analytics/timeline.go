@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// generateTimeline creates the execution timeline from the recorded spans.
+// Without spans, e.g. for results loaded from a file, spec durations are laid
+// end to end from the suite timestamp, which is only right for serial runs.
+func (e *Engine) generateTimeline(suite *models.EnhancedSuiteResult) []*models.TimelineEntry {
+	var timeline []*models.TimelineEntry
+	if len(suite.ExecutionSpans) > 0 {
+		for _, span := range suite.ExecutionSpans {
+			timeline = append(timeline, timelineEntries(span.Start, span.End, span.SpecName, span.Status, span.Stream)...)
+		}
+		sort.SliceStable(timeline, func(i, j int) bool {
+			return timeline[i].Timestamp.Before(timeline[j].Timestamp)
+		})
+		return timeline
+	}
+
+	currentTime := suite.Timestamp
+	for _, spec := range suite.SpecResults {
+		end := currentTime.Add(spec.ExecutionTime)
+		timeline = append(timeline, timelineEntries(currentTime, end, spec.SpecHeading, spec.GetStatus(), 1)...)
+		currentTime = end
+	}
+	return timeline
+}
+
+// timelineEntries returns the start and end entries of one spec
+func timelineEntries(start, end time.Time, specName, status string, stream int) []*models.TimelineEntry {
+	event := "success"
+	if status == "failed" {
+		event = "failure"
+	}
+	return []*models.TimelineEntry{
+		{Timestamp: start, Event: "spec_start", SpecName: specName, Duration: end.Sub(start), Status: status, Stream: stream},
+		{Timestamp: end, Event: event, SpecName: specName, Duration: end.Sub(start), Status: status, Stream: stream},
+	}
+}
+
+// streamLanes lays the spans out as one lane per stream, and measures how
+// evenly the streams were loaded: a stream is idle from the suite's first
+// start to its last end whenever it runs no spec
+func streamLanes(spans []*models.ExecutionSpan) ([]*models.StreamLane, *models.ParallelMetrics) {
+	if len(spans) == 0 {
+		return nil, nil
+	}
+
+	first, last := spans[0].Start, spans[0].End
+	byStream := make(map[int]*models.StreamLane)
+	for _, span := range spans {
+		if span.Start.Before(first) {
+			first = span.Start
+		}
+		if span.End.After(last) {
+			last = span.End
+		}
+		if byStream[span.Stream] == nil {
+			byStream[span.Stream] = &models.StreamLane{Stream: span.Stream}
+		}
+	}
+	wallClock := last.Sub(first)
+
+	for _, span := range spans {
+		lane := byStream[span.Stream]
+		lane.Busy += span.Duration()
+		lane.Segments = append(lane.Segments, &models.LaneSegment{
+			SpecName: span.SpecName,
+			Status:   span.Status,
+			Start:    span.Start,
+			Duration: span.Duration(),
+			Offset:   share(span.Start.Sub(first), wallClock),
+			Width:    share(span.Duration(), wallClock),
+		})
+	}
+
+	lanes := make([]*models.StreamLane, 0, len(byStream))
+	metrics := &models.ParallelMetrics{Streams: len(byStream), WallClock: wallClock}
+	var busiest time.Duration
+	for _, lane := range byStream {
+		lane.Idle = max(wallClock-lane.Busy, 0)
+		lane.Utilization = share(lane.Busy, wallClock)
+		metrics.BusyTime += lane.Busy
+		metrics.IdleTime += lane.Idle
+		busiest = max(busiest, lane.Busy)
+		lanes = append(lanes, lane)
+	}
+	sort.Slice(lanes, func(i, j int) bool {
+		return lanes[i].Stream < lanes[j].Stream
+	})
+
+	metrics.Utilization = share(metrics.BusyTime, wallClock*time.Duration(metrics.Streams))
+	if mean := metrics.BusyTime / time.Duration(metrics.Streams); mean > 0 {
+		metrics.Imbalance = (float64(busiest)/float64(mean) - 1) * 100
+	}
+	if wallClock > 0 {
+		metrics.Speedup = float64(metrics.BusyTime) / float64(wallClock)
+	}
+	return lanes, metrics
+}
+
+// share returns part as a percentage of whole, or 0 if whole is empty
+func share(part, whole time.Duration) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
@@ -5,15 +5,20 @@ import (
 	"html/template"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/getgauge/gauge-proto/go/gauge_messages"
 	"github.com/google/uuid"
 	"github.com/lirany1/gauge-html-report-ai/pkg/ai"
 	"github.com/lirany1/gauge-html-report-ai/pkg/analytics"
+	"github.com/lirany1/gauge-html-report-ai/pkg/ci"
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
 	"github.com/lirany1/gauge-html-report-ai/pkg/config"
 	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
 	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/quarantine"
+	"github.com/lirany1/gauge-html-report-ai/pkg/stacktrace"
 	"github.com/lirany1/gauge-html-report-ai/pkg/storage"
 )
 
@@ -22,7 +27,7 @@ type ReportBuilder struct {
 	reportsDir string
 	themePath  string
 	config     *config.Config
-	db         *storage.Database
+	db         storage.Store
 	analytics  *analytics.Engine
 	ai         *ai.Analyzer
 }
@@ -37,18 +42,47 @@ func NewReportBuilder(reportsDir, themePath string) *ReportBuilder {
 	}
 
 	// Initialize database
-	db, err := storage.NewDatabase(reportsDir)
-	if err != nil {
+	var db storage.Store
+	if store, err := storage.Open(reportsDir, cfg.HistoryDSN); err != nil {
 		logger.Warnf("Failed to initialize database: %v", err)
 		logger.Warnf("Historical data and trends will not be available")
-		db = nil
+	} else {
+		db = store
+	}
+
+	// Analytics and AI share one classifier so failure categories agree
+	classifier, err := classify.Load(classify.Path(cfg.ErrorRulesFile, os.Getenv("GAUGE_PROJECT_ROOT")))
+	if err != nil {
+		logger.Warnf("Using built-in error rules: %v", err)
+		classifier = classify.Default()
 	}
 
 	// Initialize analytics engine
 	analyticsEngine := analytics.NewEngine(cfg, db)
+	analyticsEngine.SetClassifier(classifier)
 
 	// Initialize AI analyzer
 	aiAnalyzer := ai.NewAnalyzer()
+	aiAnalyzer.SetClassifier(classifier)
+	aiAnalyzer.SetClusterThreshold(cfg.FailureClusterThreshold)
+	aiAnalyzer.SetEmbeddingThreshold(cfg.EmbeddingThreshold)
+	if db != nil {
+		aiAnalyzer.SetEmbeddingCache(db)
+		if cfg.AICacheTTLDays > 0 {
+			aiAnalyzer.SetResponseCache(db, time.Duration(cfg.AICacheTTLDays)*24*time.Hour, cfg.AICacheRefresh)
+		}
+	}
+	aiAnalyzer.SetOutagePolicy(ai.OutagePolicy{
+		Ratio:        cfg.OutageFailureRatio,
+		MinScenarios: cfg.OutageMinScenarios,
+		Window:       time.Duration(cfg.OutageWindowMinutes) * time.Minute,
+	})
+	aiAnalyzer.SetLLMLimits(ai.LLMLimits{
+		Concurrency:       cfg.AIConcurrency,
+		RequestsPerMinute: cfg.AIRequestsPerMinute,
+		MaxRetries:        cfg.AIMaxRetries,
+		Deadline:          time.Duration(cfg.AIDeadlineSeconds) * time.Second,
+	})
 
 	return &ReportBuilder{
 		reportsDir: reportsDir,
@@ -68,8 +102,9 @@ func (rb *ReportBuilder) Close() error {
 	return nil
 }
 
-// BuildReport generates the HTML report from suite results
-func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResult) error {
+// BuildReport generates the HTML report from suite results. spans are the
+// spec start and end times recorded per stream during execution, if any.
+func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResult, spans []*models.ExecutionSpan) error {
 	// Create reports directory
 	reportDir := filepath.Join(rb.reportsDir, "html-report")
 	if err := os.MkdirAll(reportDir, 0755); err != nil {
@@ -78,11 +113,32 @@ func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResul
 
 	// Convert proto result to enhanced suite result
 	enhanced := rb.convertToEnhancedSuite(suiteResult)
+	enhanced.ExecutionSpans = spans
+
+	// Point failures at the project code they hit
+	stacktrace.NewResolver(os.Getenv("GAUGE_PROJECT_ROOT"), enhanced.RunMetadata).Annotate(enhanced)
+
+	// Key scenarios to their history, following renames
+	rb.analytics.ResolveScenarioIdentities(enhanced)
+
+	// Quarantined scenarios are reported apart and left out of the success rate
+	quarantinePath := quarantine.Path(rb.config.QuarantineFile, os.Getenv("GAUGE_PROJECT_ROOT"))
+	quarantineList, err := quarantine.Load(quarantinePath)
+	if err != nil {
+		logger.Warnf("Ignoring quarantine list: %v", err)
+	} else {
+		quarantineList.Apply(enhanced, time.Now())
+	}
 
 	// Run analytics
 	enhanced.Analytics = rb.analytics.Analyze(enhanced)
 	enhanced.Trends = rb.analytics.GenerateTrends(enhanced)
-	enhanced.FlakyTests = rb.analytics.DetectFlakyTests(enhanced)
+	enhanced.FlakyTests, enhanced.BrokenTests = rb.analytics.DetectUnstableTests(enhanced)
+	for _, warning := range enhanced.QuarantineWarnings {
+		logger.Warnf("Quarantine: %s", warning)
+	}
+	enhanced.QuarantineSuggestions = rb.analytics.SuggestQuarantine(enhanced, quarantineList, time.Now())
+	enhanced.PerformanceMetrics = rb.analytics.AnalyzePerformance(enhanced)
 
 	// Run AI analysis
 	failureGroups := rb.ai.GroupFailures(enhanced)
@@ -94,12 +150,17 @@ func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResul
 		modelFailureGroups[i] = &models.FailureGroup{
 			Signature:         fg.Signature,
 			ErrorType:         string(fg.ErrorType),
+			Pattern:           fg.Pattern,
 			RootCause:         fg.RootCause,
 			Count:             fg.Count,
 			AffectedScenarios: fg.AffectedScenarios,
 			AffectedSpecs:     fg.AffectedSpecs,
 			Severity:          fg.Severity,
 			SuggestedFix:      fg.SuggestedFix,
+			AISuggested:       fg.AISuggested,
+			UserFrame:         fg.UserFrame,
+			MergedSignatures:  fg.MergedSignatures,
+			Confidence:        fg.Confidence,
 		}
 	}
 
@@ -117,6 +178,30 @@ func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResul
 		FailureGroups:    modelFailureGroups,
 	}
 
+	// Mark failure groups as new, recurring or regressions before this run is saved
+	enhanced.AIInsights.FailureBurst = rb.analytics.TrackFailurePatterns(enhanced, modelFailureGroups)
+
+	// An environment outage is reported once, with the failures it explains
+	if outage := executiveSummary.Outage; outage != nil {
+		modelOutage := &models.Outage{
+			Trigger:   outage.Trigger,
+			Summary:   outage.Summary,
+			Evidence:  outage.Evidence,
+			Scenarios: outage.Scenarios,
+		}
+		remaining := make([]*models.FailureGroup, 0, len(modelFailureGroups))
+		for i, fg := range failureGroups {
+			if outage.Explains(fg) {
+				modelOutage.Groups = append(modelOutage.Groups, modelFailureGroups[i])
+			} else {
+				remaining = append(remaining, modelFailureGroups[i])
+			}
+		}
+		enhanced.AIInsights.Outage = modelOutage
+		enhanced.AIInsights.FailureGroups = remaining
+		enhanced.AIInsights.FailureBurst = nil
+	}
+
 	// Save to database for historical tracking
 	if rb.db != nil {
 		executionID := uuid.New().String()
@@ -125,6 +210,11 @@ func (rb *ReportBuilder) BuildReport(suiteResult *gauge_messages.ProtoSuiteResul
 		} else {
 			logger.Infof("Saved execution data with ID: %s", executionID)
 		}
+
+		policy := storage.RetentionPolicy{MaxAgeDays: rb.config.HistoryRetentionDays, MaxRuns: rb.config.HistoryMaxRuns}
+		if _, err := rb.db.Prune(policy, false); err != nil {
+			logger.Warnf("Failed to apply history retention: %v", err)
+		}
 	}
 
 	// Copy theme assets
@@ -156,6 +246,7 @@ func (rb *ReportBuilder) convertToEnhancedSuite(proto *gauge_messages.ProtoSuite
 		Tags:          tags,
 		ExecutionTime: time.Duration(proto.GetExecutionTime()) * time.Millisecond,
 		Timestamp:     time.Now(),
+		RunMetadata:   ci.Collect(os.Getenv("GAUGE_PROJECT_ROOT")),
 		SpecResults:   make([]*models.SpecResult, 0),
 	}
 
@@ -218,12 +309,19 @@ func (rb *ReportBuilder) convertSpecResult(proto *gauge_messages.ProtoSpecResult
 
 	// Convert scenarios from proto items
 	for _, item := range proto.GetProtoSpec().GetItems() {
-		if item.GetItemType() == gauge_messages.ProtoItem_Scenario {
+		switch item.GetItemType() {
+		case gauge_messages.ProtoItem_Scenario:
 			scenario := rb.convertScenario(item.GetScenario())
 			spec.Scenarios = append(spec.Scenarios, scenario)
+		case gauge_messages.ProtoItem_TableDrivenScenario:
+			tableDriven := item.GetTableDrivenScenario()
+			scenario := rb.convertScenario(tableDriven.GetScenario())
+			scenario.RowIndex = int(tableDriven.GetTableRowIndex()) + 1
+			spec.Scenarios = append(spec.Scenarios, scenario)
 		}
 	}
 
+	spec.AssignScenarioIDs(os.Getenv("GAUGE_PROJECT_ROOT"))
 	return spec
 }
 
@@ -244,6 +342,8 @@ func (rb *ReportBuilder) convertScenario(proto *gauge_messages.ProtoScenario) *m
 		Failed:          failed,
 		Skipped:         skipped,
 		Steps:           make([]*models.StepResult, 0),
+		LineStart:       int(proto.GetSpan().GetStart()),
+		Retries:         int(proto.GetRetriesCount()),
 	}
 
 	// Convert scenario items (steps)
@@ -388,12 +488,24 @@ func (rb *ReportBuilder) getTemplate() *template.Template {
 		"formatDuration": func(d time.Duration) string {
 			return analytics.FormatDuration(d)
 		},
+		"formatImpact": func(d time.Duration) string {
+			if d < 0 {
+				return "-" + analytics.FormatDuration(-d)
+			}
+			return "+" + analytics.FormatDuration(d)
+		},
 		"formatSuccessRate": func(rate float64) string {
 			return fmt.Sprintf("%.1f", rate)
 		},
+		"formatRatio": func(ratio float64) string {
+			return fmt.Sprintf("%.0f%%", ratio*100)
+		},
 		"formatTimestamp": func(t time.Time) string {
 			return t.Format("January 2, 2006 at 3:04 PM")
 		},
+		"formatDate": func(t time.Time) string {
+			return t.Format("Jan 2, 2006")
+		},
 		"getFailedScenariosCount": func(spec *models.SpecResult) int {
 			return spec.GetFailedScenariosCount()
 		},
@@ -403,6 +515,14 @@ func (rb *ReportBuilder) getTemplate() *template.Template {
 		"getSkippedScenariosCount": func(spec *models.SpecResult) int {
 			return spec.GetSkippedScenariosCount()
 		},
+		// sourceURL lets file links through, which html/template would
+		// otherwise rewrite; other schemes are left to the usual escaping
+		"sourceURL": func(frame *models.StackFrame) interface{} {
+			if strings.HasPrefix(frame.URL, "file://") {
+				return template.URL(frame.URL)
+			}
+			return frame.URL
+		},
 	}
 
 	tmplStr := rb.getTemplateString()
@@ -479,6 +599,13 @@ func (rb *ReportBuilder) getTemplateString() string {
                 <div>
                     <h1 class="text-2xl font-bold text-gray-900">{{.ProjectName}}</h1>
                     <p class="text-sm text-gray-500 mt-1">Test Execution Report - {{formatTimestamp .Timestamp}}</p>
+                    {{with .RunMetadata}}
+                    <p class="text-xs text-gray-500 mt-1">
+                        {{if .BuildNumber}}{{if .BuildURL}}<a href="{{.BuildURL}}" class="text-blue-600 hover:underline" target="_blank" rel="noopener">Build #{{.BuildNumber}}</a>{{else}}Build #{{.BuildNumber}}{{end}} · {{end}}
+                        {{if .Branch}}{{.Branch}}{{end}}{{if .GitCommit}} @ <span class="font-mono" title="{{.GitCommit}}">{{.ShortCommit}}</span>{{end}}
+                        {{if .Agent}} · {{.Agent}}{{end}}
+                    </p>
+                    {{end}}
                 </div>
                 <div class="flex items-center gap-4">
                     <span class="px-3 py-1 rounded-full text-sm font-medium {{if gt .SuccessRate 80.0}}bg-green-100 text-green-800{{else if gt .SuccessRate 50.0}}bg-yellow-100 text-yellow-800{{else}}bg-red-100 text-red-800{{end}}">
@@ -669,6 +796,9 @@ func (rb *ReportBuilder) getTemplateString() string {
                             {{else}}
                             <p class="text-xs text-gray-500 mt-1">No failures</p>
                             {{end}}
+                            {{if gt .QuarantinedFailuresCount 0}}
+                            <p class="text-xs text-gray-500 mt-1">🔒 +{{.QuarantinedFailuresCount}} quarantined</p>
+                            {{end}}
                         </div>
                         <div class="bg-red-100 rounded-full p-3">
                             <svg class="w-6 h-6 text-red-600" fill="none" stroke="currentColor" viewBox="0 0 24 24">
@@ -828,7 +958,7 @@ func (rb *ReportBuilder) getTemplateString() string {
                                             <div>
                                                 <p class="text-xs text-blue-700 font-medium">Total Runs</p>
                                                 <p class="text-2xl font-bold text-blue-900">{{.Occurrences}}</p>
-                                                <p class="text-xs text-blue-600 mt-1">Last 30 days</p>
+                                                {{with $.Trends}}<p class="text-xs text-blue-600 mt-1">Last {{.WindowDays}} days</p>{{end}}
                                             </div>
                                             <svg class="h-8 w-8 text-blue-500" fill="none" stroke="currentColor" viewBox="0 0 24 24">
                                                 <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M9 19v-6a2 2 0 00-2-2H5a2 2 0 00-2 2v6a2 2 0 002 2h2a2 2 0 002-2zm0 0V9a2 2 0 012-2h2a2 2 0 012 2v10m-6 0a2 2 0 002 2h2a2 2 0 002-2m0 0V5a2 2 0 012-2h2a2 2 0 012 2v14a2 2 0 01-2 2h-2a2 2 0 01-2-2z"/>
@@ -837,6 +967,17 @@ func (rb *ReportBuilder) getTemplateString() string {
                                     </div>
                                 </div>
 
+                                {{if .Evidence}}
+                                <!-- Evidence -->
+                                <div class="mb-3 text-xs text-gray-700">
+                                    <p class="font-semibold text-gray-900 mb-1">🔎 Evidence:</p>
+                                    <ul class="space-y-1 ml-4">
+                                        {{range .Evidence}}<li class="list-disc">{{.}}</li>{{end}}
+                                        {{if gt .ConsecutivePasses 0}}<li class="list-disc">Currently passing {{.ConsecutivePasses}} run(s) in a row</li>{{else if gt .ConsecutiveFails 0}}<li class="list-disc">Currently failing {{.ConsecutiveFails}} run(s) in a row</li>{{end}}
+                                    </ul>
+                                </div>
+                                {{end}}
+
                                 <!-- Recommendations -->
                                 <div class="bg-blue-50 border border-blue-200 rounded-lg p-3">
                                     <p class="text-xs font-semibold text-blue-900 mb-2">💡 Recommended Actions:</p>
@@ -874,7 +1015,123 @@ func (rb *ReportBuilder) getTemplateString() string {
         {{end}}
         {{end}}
 
+        {{if .BrokenTests}}
+        <!-- Broken Tests -->
+        <section class="mb-8">
+            <div class="bg-white border border-red-200 rounded-lg shadow-sm overflow-hidden">
+                <div class="bg-gradient-to-r from-red-500 to-red-600 px-6 py-4">
+                    <h2 class="text-xl font-bold text-white">⛔ Broken Tests</h2>
+                    <p class="text-red-50 text-sm mt-1">{{len .BrokenTests}} test(s) failing consistently - not flaky, broken</p>
+                </div>
+                <div class="px-6 py-4 divide-y divide-gray-100">
+                    {{range .BrokenTests}}
+                    <div class="py-3 flex items-start justify-between">
+                        <div>
+                            <h4 class="text-base font-semibold text-gray-900">{{.ScenarioName}}</h4>
+                            <p class="text-sm text-gray-600">📋 Specification: <span class="font-medium">{{.SpecName}}</span></p>
+                        </div>
+                        <div class="text-right">
+                            <span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-red-100 text-red-800" title="First failure {{formatTimestamp .BrokenSince}}">
+                                Broken since {{formatDate .BrokenSince}}
+                            </span>
+                            <p class="text-xs text-gray-500 mt-1">Failed the last {{.ConsecutiveFails}} run(s) in a row</p>
+                        </div>
+                    </div>
+                    {{end}}
+                </div>
+            </div>
+        </section>
+        {{end}}
+
+        {{if or .QuarantinedFailures .QuarantineWarnings .QuarantineSuggestions}}
+        <!-- Quarantine -->
+        <section class="mb-8">
+            <div class="bg-white border border-gray-300 rounded-lg shadow-sm overflow-hidden">
+                <div class="bg-gradient-to-r from-gray-600 to-gray-700 px-6 py-4">
+                    <h2 class="text-xl font-bold text-white">🔒 Quarantine</h2>
+                    <p class="text-gray-100 text-sm mt-1">{{.QuarantinedScenariosCount}} quarantined scenario(s), {{.QuarantinedFailuresCount}} failed - not counted in the success rate</p>
+                </div>
+                {{if .QuarantineWarnings}}
+                <div class="px-6 py-3 bg-yellow-50 border-b border-yellow-200">
+                    <ul class="text-sm text-yellow-800 space-y-1">
+                        {{range .QuarantineWarnings}}<li>⏰ {{.}}</li>{{end}}
+                    </ul>
+                </div>
+                {{end}}
+                {{if .QuarantineSuggestions}}
+                <div class="px-6 py-4 border-b border-gray-200">
+                    <h3 class="text-sm font-semibold text-gray-800 mb-2">💡 Suggestions</h3>
+                    <ul class="text-sm text-gray-700 space-y-1">
+                        {{range .QuarantineSuggestions}}
+                        <li>
+                            {{if eq .Action "add"}}<span class="px-2 py-0.5 bg-orange-100 text-orange-800 text-xs font-bold rounded">QUARANTINE</span>{{else}}<span class="px-2 py-0.5 bg-green-100 text-green-800 text-xs font-bold rounded">RELEASE</span>{{end}}
+                            <span class="font-medium">{{.ScenarioName}}</span> <span class="text-gray-500">({{.SpecName}})</span> - {{.Reason}}
+                        </li>
+                        {{end}}
+                    </ul>
+                    <p class="text-xs text-gray-500 mt-2">Run <code>html-report-enhanced history quarantine -o patch</code> for a patch to the quarantine file.</p>
+                </div>
+                {{end}}
+                <div class="px-6 py-4 divide-y divide-gray-100">
+                    {{range .QuarantinedFailures}}
+                    <div class="py-3">
+                        <div class="flex items-start justify-between">
+                            <div>
+                                <h4 class="text-base font-semibold text-gray-900">{{.Scenario.ScenarioHeading}}</h4>
+                                <p class="text-sm text-gray-600">📋 Specification: <span class="font-medium">{{.SpecHeading}}</span></p>
+                            </div>
+                            <div class="text-right text-xs text-gray-600">
+                                {{with .Scenario.Quarantine}}
+                                <p>Owner: <span class="font-medium">{{if .Owner}}{{.Owner}}{{else}}unknown{{end}}</span></p>
+                                {{if not .Expires.IsZero}}<p>Expires {{formatDate .Expires}}</p>{{end}}
+                                {{end}}
+                            </div>
+                        </div>
+                        {{if .Scenario.Quarantine.Reason}}<p class="text-sm text-gray-700 mt-1">Reason: {{.Scenario.Quarantine.Reason}}</p>{{end}}
+                        {{range .Scenario.Steps}}{{if .Failed}}{{if .ErrorMessage}}
+                        <p class="text-xs text-red-600 bg-red-50 p-2 rounded border border-red-200 mt-2"><span class="font-semibold">Error:</span> {{.ErrorMessage}}</p>
+                        {{end}}{{end}}{{end}}
+                    </div>
+                    {{end}}
+                </div>
+            </div>
+        </section>
+        {{end}}
+
         {{if .AIInsights}}
+        {{with .AIInsights.Outage}}
+        <!-- Environment Outage -->
+        <section class="mb-8">
+            <div class="bg-white border-2 border-red-500 rounded-lg shadow-md overflow-hidden">
+                <div class="bg-red-600 px-6 py-4">
+                    <h2 class="text-xl font-bold text-white">🌐 Environment Outage</h2>
+                    <p class="text-red-50 text-sm mt-1">{{.Scenarios}} failure(s) traced to {{.Trigger}} - not {{.Scenarios}} separate test bugs</p>
+                </div>
+                <div class="px-6 py-4">
+                    <p class="text-sm text-gray-800 mb-3">{{.Summary}}</p>
+                    <h4 class="text-sm font-semibold text-gray-700 mb-2">Evidence:</h4>
+                    <ul class="list-disc ml-5 text-sm text-gray-700 space-y-1">
+                        {{range .Evidence}}<li>{{.}}</li>{{end}}
+                    </ul>
+                    {{with .Groups}}
+                    <details class="mt-4">
+                        <summary class="cursor-pointer text-sm font-medium text-gray-700">{{len .}} failure group(s) explained by the outage</summary>
+                        <ul class="mt-2 space-y-2">
+                            {{range .}}
+                            <li class="text-sm bg-gray-50 rounded p-3 border border-gray-200">
+                                <span class="px-2 py-0.5 rounded-full text-xs font-medium bg-gray-100 text-gray-800">{{.ErrorType}}</span>
+                                <span class="font-medium text-gray-900">{{.RootCause}}</span>
+                                <span class="text-gray-500">· {{.Count}} scenario(s) in {{range $i, $spec := .AffectedSpecs}}{{if $i}}, {{end}}{{$spec}}{{end}}</span>
+                            </li>
+                            {{end}}
+                        </ul>
+                    </details>
+                    {{end}}
+                </div>
+            </div>
+        </section>
+        {{end}}
+
         {{if .AIInsights.FailureGroups}}
         {{if gt (len .AIInsights.FailureGroups) 0}}
         <!-- AI Failure Analysis -->
@@ -893,6 +1150,14 @@ func (rb *ReportBuilder) getTemplateString() string {
                     </div>
                 </div>
 
+                {{with .AIInsights.FailureBurst}}
+                <!-- Failure Burst -->
+                <div class="mx-6 mt-4 p-4 bg-amber-50 border border-amber-300 rounded-lg">
+                    <p class="text-sm font-semibold text-amber-900">⚡ {{.NewGroups}} new failures appeared together in this run</p>
+                    <p class="text-sm text-amber-800 mt-1">{{.Scenarios}} scenario(s) across {{len .Specs}} specs ({{range $i, $spec := .Specs}}{{if $i}}, {{end}}{{$spec}}{{end}}) started failing at once. Unrelated scenarios failing together usually share one cause, such as an environment outage, rather than being separate test bugs.</p>
+                </div>
+                {{end}}
+
                 <!-- Failure Groups -->
                 <div class="px-6 py-4">
                     <div class="space-y-4">
@@ -917,8 +1182,37 @@ func (rb *ReportBuilder) getTemplateString() string {
                                             <span class="px-2.5 py-1 rounded-full text-xs font-medium bg-blue-100 text-blue-800">
                                                 {{.Count}} occurrence(s)
                                             </span>
+
+                                            <!-- History Badge -->
+                                            {{if eq .Recurrence "new"}}
+                                            <span class="px-2.5 py-1 rounded-full text-xs font-medium bg-purple-100 text-purple-800">🆕 New</span>
+                                            {{else if eq .Recurrence "recurring"}}
+                                            <span class="px-2.5 py-1 rounded-full text-xs font-medium bg-gray-100 text-gray-700" title="First seen {{formatTimestamp .FirstSeen}}">🔁 Recurring since {{formatDate .FirstSeen}} · {{.SeenInRuns}} run(s)</span>
+                                            {{else if eq .Recurrence "regression"}}
+                                            <span class="px-2.5 py-1 rounded-full text-xs font-medium bg-red-100 text-red-800" title="First seen {{formatTimestamp .FirstSeen}}">⚠️ Regression · last seen {{formatDate .LastSeen}}</span>
+                                            {{end}}
+                                            {{if .MergedSignatures}}
+                                            <span class="px-2.5 py-1 rounded-full text-xs font-medium bg-amber-100 text-amber-800" title="Near-duplicate failure groups merged by message and stack frame similarity">🧩 +{{len .MergedSignatures}} similar · {{formatRatio .Confidence}} confidence</span>
+                                            {{end}}
                                         </div>
                                         <h3 class="text-base font-semibold text-gray-900">{{.RootCause}}</h3>
+                                        {{if .Pattern}}
+                                        <p class="text-xs font-mono text-gray-500 mt-1 break-all" title="Signature {{.Signature}}">{{.Pattern}}</p>
+                                        {{end}}
+                                        {{with .UserFrame}}
+                                        <p class="text-xs text-gray-600 mt-1">📍 First user frame: <span class="font-medium text-gray-800">{{.Function}}</span> at {{if .URL}}<a href="{{sourceURL .}}" target="_blank" rel="noopener" class="font-mono text-blue-700 hover:underline">{{.Location}}</a>{{else}}<span class="font-mono">{{.Location}}</span>{{end}}</p>
+                                        {{end}}
+                                        {{if or .FirstBuild .FirstCommit}}
+                                        <p class="text-xs text-gray-600 mt-1">🧬 First appeared{{if .FirstBuild}} in build <span class="font-medium text-gray-800">{{.FirstBuild}}</span>{{end}}{{if .FirstCommit}} at commit <span class="font-mono" title="{{.FirstCommit}}">{{.ShortFirstCommit}}</span>{{end}}</p>
+                                        {{end}}
+                                        {{with .IntroducedWith}}
+                                        <details class="text-xs text-gray-600 mt-1">
+                                            <summary class="cursor-pointer">Introduced together with {{len .}} other failure(s)</summary>
+                                            <ul class="ml-4 mt-1 font-mono text-gray-500 break-all">
+                                                {{range .}}<li>{{.}}</li>{{end}}
+                                            </ul>
+                                        </details>
+                                        {{end}}
                                     </div>
                                 </div>
 
@@ -1064,6 +1358,69 @@ func (rb *ReportBuilder) getTemplateString() string {
         {{end}}
         {{end}}
 
+        {{if .PerformanceMetrics}}
+        {{if .PerformanceMetrics.Bottlenecks}}
+        <!-- Performance Regressions -->
+        <section class="mb-8">
+            <h2 class="text-lg font-semibold text-gray-900 mb-4">Performance Regressions</h2>
+            <div class="bg-white rounded-lg shadow-sm border border-gray-200 p-6">
+                <p class="text-sm text-gray-600 mb-4">Compared with each item's own history over the trend window; scenarios that ran significantly faster are listed as speed-ups</p>
+                <div class="space-y-3">
+                    {{range .PerformanceMetrics.Bottlenecks}}
+                    <div class="border-l-4 {{if .IsSpeedup}}border-green-500{{else if eq .Severity "critical"}}border-red-600{{else if eq .Severity "high"}}border-orange-500{{else}}border-yellow-500{{end}} bg-gray-50 rounded-r p-3">
+                        <div class="flex items-center justify-between">
+                            <p class="text-sm font-medium text-gray-900 truncate">{{if .IsSpeedup}}⚡ Speed-up: {{else if eq .Type "slow_scenario"}}🐢 Slow-down: {{end}}{{.Location}}</p>
+                            <span class="ml-3 px-2.5 py-1 rounded text-xs font-bold {{if .IsSpeedup}}bg-green-100 text-green-800{{else if eq .Severity "critical"}}bg-red-100 text-red-800{{else if eq .Severity "high"}}bg-orange-100 text-orange-800{{else}}bg-yellow-100 text-yellow-800{{end}}">
+                                {{formatImpact .Impact}}
+                            </span>
+                        </div>
+                        <p class="text-xs text-gray-600 mt-1">
+                            {{formatDuration .Duration}} now · median {{formatDuration .BaselineMedian}}{{if .BaselineMAD}} · MAD {{formatDuration .BaselineMAD}}{{end}} · p95 {{formatDuration .BaselineP95}} · {{.Samples}} sample(s){{if .Deviation}} · {{printf "%.1f" .Deviation}}σ (robust){{end}}
+                        </p>
+                    </div>
+                    {{end}}
+                </div>
+            </div>
+        </section>
+        {{end}}
+        {{end}}
+
+        {{if .Analytics}}
+        {{if .Analytics.StreamLanes}}
+        <!-- Execution Timeline -->
+        <section class="mb-8">
+            <h2 class="text-lg font-semibold text-gray-900 mb-4">Execution Timeline</h2>
+            <div class="bg-white rounded-lg shadow-sm border border-gray-200 p-6">
+                {{with .Analytics.Parallel}}
+                <div class="grid grid-cols-2 md:grid-cols-6 gap-4 mb-6">
+                    <div><p class="text-xs text-gray-500">Streams</p><p class="text-lg font-semibold text-gray-900">{{.Streams}}</p></div>
+                    <div><p class="text-xs text-gray-500">Wall-clock</p><p class="text-lg font-semibold text-gray-900">{{formatDuration .WallClock}}</p></div>
+                    <div><p class="text-xs text-gray-500">Speed-up</p><p class="text-lg font-semibold text-gray-900">{{printf "%.1f" .Speedup}}×</p></div>
+                    <div><p class="text-xs text-gray-500">Utilization</p><p class="text-lg font-semibold text-gray-900">{{printf "%.0f" .Utilization}}%</p></div>
+                    <div><p class="text-xs text-gray-500">Idle time</p><p class="text-lg font-semibold text-gray-900">{{formatDuration .IdleTime}}</p></div>
+                    <div><p class="text-xs text-gray-500">Imbalance</p><p class="text-lg font-semibold {{if gt .Imbalance 25.0}}text-orange-600{{else}}text-gray-900{{end}}">{{printf "%.0f" .Imbalance}}%</p></div>
+                </div>
+                {{end}}
+                <div class="space-y-2">
+                    {{range .Analytics.StreamLanes}}
+                    <div class="flex items-center gap-3">
+                        <div class="w-28 flex-shrink-0 text-xs text-gray-600">
+                            <p class="font-medium">Stream {{.Stream}}</p>
+                            <p class="text-gray-400">{{printf "%.0f" .Utilization}}% busy · idle {{formatDuration .Idle}}</p>
+                        </div>
+                        <div class="relative flex-1 h-6 bg-gray-100 rounded">
+                            {{range .Segments}}
+                            <div class="absolute top-0 h-6 rounded-sm border-r border-white {{if eq .Status "failed"}}bg-red-400{{else if eq .Status "skipped"}}bg-gray-300{{else}}bg-green-400{{end}}" style="left: {{printf "%.3f" .Offset}}%; width: {{printf "%.3f" .Width}}%" title="{{.SpecName}} · {{formatDuration .Duration}}"></div>
+                            {{end}}
+                        </div>
+                    </div>
+                    {{end}}
+                </div>
+            </div>
+        </section>
+        {{end}}
+        {{end}}
+
         <!-- Test Specifications -->
         <section class="mb-8">
             <h2 class="text-lg font-semibold text-gray-900 mb-4">Test Specifications</h2>
@@ -1175,6 +1532,7 @@ func (rb *ReportBuilder) getTemplateString() string {
                                                 </svg>
                                                 <h4 class="text-sm font-semibold text-red-900">{{.ScenarioHeading}}</h4>
                                                 <span class="px-2 py-0.5 bg-red-200 text-red-800 text-xs font-bold rounded">FAILED</span>
+                                                {{if .Quarantine}}<span class="px-2 py-0.5 bg-gray-200 text-gray-700 text-xs font-bold rounded" title="{{.Quarantine.Reason}}">🔒 QUARANTINED</span>{{end}}
                                                 {{else if .Skipped}}
                                                 <svg class="w-4 h-4 text-gray-600 flex-shrink-0" fill="currentColor" viewBox="0 0 20 20">
                                                     <path fill-rule="evenodd" d="M10 18a8 8 0 100-16 8 8 0 000 16zM7 9a1 1 0 000 2h6a1 1 0 100-2H7z" clip-rule="evenodd"/>
@@ -1201,6 +1559,11 @@ func (rb *ReportBuilder) getTemplateString() string {
                                                         <span class="font-semibold">Error:</span> {{.ErrorMessage}}
                                                     </p>
                                                     {{end}}
+                                                    {{with .UserFrame}}
+                                                    <p class="text-xs text-gray-700 bg-yellow-50 p-2 rounded border border-yellow-200">
+                                                        📍 <span class="font-semibold">{{.Function}}</span> at {{if .URL}}<a href="{{sourceURL .}}" target="_blank" rel="noopener" class="font-mono text-blue-700 hover:underline">{{.Location}}</a>{{else}}<span class="font-mono">{{.Location}}</span>{{end}}
+                                                    </p>
+                                                    {{end}}
                                                     {{if .StackTrace}}
                                                     <details class="mt-2">
                                                         <summary class="text-xs text-gray-600 cursor-pointer hover:text-gray-900">View Stack Trace</summary>
@@ -1256,7 +1619,12 @@ func (rb *ReportBuilder) getTemplateString() string {
                     total: {{.PassedCount}} + {{.FailedCount}} + {{.SkippedCount}},
                     passed: {{.PassedCount}},
                     failed: {{.FailedCount}},
-                    duration: {{.ExecutionTime.Seconds}}
+                    duration: {{.ExecutionTime.Seconds}},
+                    buildNumber: '{{.BuildNumber}}',
+                    runs: {{.Runs}},
+                    branch: '{{.Branch}}',
+                    gitCommit: '{{.ShortCommit}}',
+                    agent: '{{.Agent}}'
                 },{{end}}
             ];
 
@@ -1335,12 +1703,17 @@ func (rb *ReportBuilder) getTemplateString() string {
                                 afterLabel: function(context) {
                                     const data = trendData[context.dataIndex];
                                     if (context.datasetIndex === 0) {
-                                        return [
+                                        const lines = [
                                             'Total: ' + data.total + ' scenarios',
                                             'Passed: ' + data.passed,
                                             'Failed: ' + data.failed,
                                             'Duration: ' + data.duration.toFixed(1) + 's'
                                         ];
+                                        if (data.buildNumber) lines.push('Build: #' + data.buildNumber);
+                                        if (data.runs > 1) lines.push('Daily average of ' + data.runs + ' runs');
+                                        if (data.branch || data.gitCommit) lines.push('Commit: ' + [data.branch, data.gitCommit].filter(Boolean).join(' @ '));
+                                        if (data.agent) lines.push('Agent: ' + data.agent);
+                                        return lines;
                                     }
                                     return null;
                                 }
@@ -2,7 +2,12 @@ package builder
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
 )
 
 func TestNewReportBuilder(t *testing.T) {
@@ -35,3 +40,100 @@ func TestReportBuilder_Close(t *testing.T) {
 		t.Errorf("Expected no error closing builder, got %v", err)
 	}
 }
+
+func TestReportBuilder_GenerateIndexHTML(t *testing.T) {
+	tempDir := t.TempDir()
+	builder := NewReportBuilder(tempDir, tempDir)
+	defer func() {
+		_ = builder.Close()
+	}()
+
+	now := time.Now()
+	suite := &models.EnhancedSuiteResult{
+		ProjectName: "Shop",
+		Timestamp:   now,
+		RunMetadata: &models.RunMetadata{BuildNumber: "412", BuildURL: "https://ci.example.com/412", Branch: "main", GitCommit: "abcdef123456"},
+		SpecResults: []*models.SpecResult{{
+			SpecHeading: "Checkout",
+			Scenarios: []*models.ScenarioResult{
+				{ScenarioHeading: "Pay by card", Failed: true, Steps: []*models.StepResult{{
+					StepText: "Pay", Failed: true, ErrorMessage: "card declined",
+					UserFrame: &models.StackFrame{Function: "verifyPayment", File: "/project/steps/pay.js", Line: 12, Path: "steps/pay.js", URL: "file:///project/steps/pay.js"},
+				}}},
+				{ScenarioHeading: "Pay by voucher", Failed: true, Quarantine: &models.Quarantine{Owner: "payments-team", Reason: "sandbox outage"}},
+			},
+		}},
+		QuarantinedScenariosCount: 1,
+		QuarantinedFailuresCount:  1,
+		QuarantineSuggestions: []*models.QuarantineSuggestion{
+			{Action: "add", SpecName: "Checkout", ScenarioName: "Pay by card", Reason: "flaky score 0.50 over 6 runs"},
+		},
+		Analytics: &models.Analytics{
+			StreamLanes: []*models.StreamLane{
+				{Stream: 1, Segments: []*models.LaneSegment{{SpecName: "Checkout", Status: "passed", Width: 100}}},
+				{Stream: 2, Segments: []*models.LaneSegment{{SpecName: "Login", Status: "failed", Offset: 10, Width: 40}}},
+			},
+			Parallel: &models.ParallelMetrics{Streams: 2, Utilization: 70, Imbalance: 42.9, Speedup: 1.4},
+		},
+		Trends: &models.TrendData{
+			WindowDays:     14,
+			HistoricalRuns: []*models.HistoricalRun{{Timestamp: now, SuccessRate: 50, BuildNumber: "411", GitCommit: "0123456789"}},
+		},
+		FlakyTests:  []*models.FlakyTest{{SpecName: "Checkout", ScenarioName: "Pay by card", FlakyScore: 0.5}},
+		BrokenTests: []*models.FlakyTest{{SpecName: "Checkout", ScenarioName: "Refund", Verdict: "broken", BrokenSince: now, ConsecutiveFails: 3}},
+		PerformanceMetrics: &models.PerformanceMetrics{
+			Bottlenecks: []*models.Bottleneck{
+				{Location: "Checkout › Pay by card › Pay", Severity: "high", Impact: time.Second},
+				{Location: "Checkout › Refund", Type: "fast_scenario", Severity: "low", Impact: -6 * time.Second, BaselineMAD: 50 * time.Millisecond, Deviation: -80.9},
+			},
+		},
+		AIInsights: &models.AIInsights{
+			ExecutiveSummary: &models.ExecutiveSummary{HealthStatus: "Poor"},
+			FailureGroups: []*models.FailureGroup{
+				{
+					Signature: "a", RootCause: "timed out", Pattern: "Timed out after <DURATION>", Recurrence: "new",
+					MergedSignatures: []string{"c", "d"}, Confidence: 0.86,
+					UserFrame: &models.StackFrame{
+						Function: "CartSteps.verifyTotal", File: "CartSteps.java", Line: 42, Path: "src/test/java/CartSteps.java",
+						URL: "https://github.com/acme/shop/blob/abc/src/test/java/CartSteps.java#L42",
+					},
+				},
+				{
+					Signature: "b", RootCause: "boom", Recurrence: "regression", FirstSeen: now, LastSeen: now,
+					FirstBuild: "398", FirstCommit: "9f86d081884c7d65", IntroducedWith: []string{"Connection refused to <IP>"},
+				},
+			},
+			FailureBurst: &models.FailureBurst{NewGroups: 5, Scenarios: 12, Specs: []string{"Cart", "Checkout"}},
+			Outage: &models.Outage{
+				Trigger: "network failures", Summary: "A shared dependency was most likely unavailable.", Scenarios: 6,
+				Evidence: []string{"6 of 10 executed scenarios (60%) failed with network or timeout errors, across 3 spec(s)"},
+				Groups:   []*models.FailureGroup{{ErrorType: "Network Error", RootCause: "connect ECONNREFUSED", Count: 6, AffectedSpecs: []string{"Cart", "Login"}}},
+			},
+		},
+	}
+
+	if err := builder.generateIndexHTML(tempDir, suite); err != nil {
+		t.Fatalf("Failed to render report: %v", err)
+	}
+
+	html, err := os.ReadFile(filepath.Join(tempDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	for _, want := range []string{"Performance Regressions", "Checkout › Pay by card › Pay", "🆕 New", "⚠️ Regression", "Build #412", "abcdef1", "buildNumber: '411'",
+		"Broken since", "Last 14 days", "🔒 QUARANTINED", "payments-team", "Reason: sandbox outage", "+1 quarantined",
+		"QUARANTINE</span>", "flaky score 0.50 over 6 runs",
+		"⚡ Speed-up: Checkout › Refund", "-6.0s", "MAD 50ms", "-80.9σ",
+		"Execution Timeline", "Stream 2", "left: 10.000%; width: 40.000%", "43%",
+		`href="https://github.com/acme/shop/blob/abc/src/test/java/CartSteps.java#L42"`, "src/test/java/CartSteps.java:42",
+		`href="file:///project/steps/pay.js"`, "steps/pay.js:12",
+		"Timed out after &lt;DURATION&gt;", "🧩 +2 similar · 86% confidence",
+		"in build <span class=\"font-medium text-gray-800\">398</span>", "9f86d08", "Introduced together with 1 other failure(s)", "Connection refused to &lt;IP&gt;",
+		"⚡ 5 new failures appeared together", "12 scenario(s) across 2 specs (Cart, Checkout)",
+		"🌐 Environment Outage", "6 failure(s) traced to network failures", "6 of 10 executed scenarios (60%)",
+		"1 failure group(s) explained by the outage", "connect ECONNREFUSED"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("Expected report to contain %q", want)
+		}
+	}
+}
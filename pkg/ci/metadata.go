@@ -0,0 +1,106 @@
+package ci
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// Collect gathers build metadata from well-known CI environment variables,
+// falling back to the git repository at dir (the working directory if empty)
+// for the branch and commit
+func Collect(dir string) *models.RunMetadata {
+	return collect(os.Getenv, func(args ...string) string {
+		return runGit(dir, args...)
+	})
+}
+
+// collect is Collect with injectable environment and git lookups
+func collect(getenv func(string) string, git func(args ...string) string) *models.RunMetadata {
+	var meta *models.RunMetadata
+
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		meta = &models.RunMetadata{
+			Provider:    "github-actions",
+			BuildNumber: getenv("GITHUB_RUN_NUMBER"),
+			Branch:      firstNonEmpty(getenv("GITHUB_HEAD_REF"), getenv("GITHUB_REF_NAME")),
+			GitCommit:   getenv("GITHUB_SHA"),
+			Agent:       getenv("RUNNER_NAME"),
+			JobName:     getenv("GITHUB_WORKFLOW"),
+		}
+		if server, repo, runID := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID"); server != "" && repo != "" && runID != "" {
+			meta.BuildURL = server + "/" + repo + "/actions/runs/" + runID
+		}
+		if server, repo := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"); server != "" && repo != "" {
+			meta.SourceURL = server + "/" + repo + "/blob/{commit}/{path}#L{line}"
+		}
+	case getenv("GITLAB_CI") == "true":
+		meta = &models.RunMetadata{
+			Provider:    "gitlab-ci",
+			BuildNumber: firstNonEmpty(getenv("CI_PIPELINE_IID"), getenv("CI_PIPELINE_ID")),
+			BuildURL:    firstNonEmpty(getenv("CI_PIPELINE_URL"), getenv("CI_JOB_URL")),
+			Branch:      firstNonEmpty(getenv("CI_COMMIT_REF_NAME"), getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")),
+			GitCommit:   getenv("CI_COMMIT_SHA"),
+			Agent:       getenv("CI_RUNNER_DESCRIPTION"),
+			JobName:     getenv("CI_JOB_NAME"),
+		}
+		if project := getenv("CI_PROJECT_URL"); project != "" {
+			meta.SourceURL = project + "/-/blob/{commit}/{path}#L{line}"
+		}
+	case getenv("JENKINS_URL") != "" || getenv("BUILD_URL") != "":
+		meta = &models.RunMetadata{
+			Provider:    "jenkins",
+			BuildNumber: getenv("BUILD_NUMBER"),
+			BuildURL:    getenv("BUILD_URL"),
+			Branch:      strings.TrimPrefix(firstNonEmpty(getenv("BRANCH_NAME"), getenv("GIT_BRANCH")), "origin/"),
+			GitCommit:   getenv("GIT_COMMIT"),
+			Agent:       getenv("NODE_NAME"),
+			JobName:     getenv("JOB_NAME"),
+		}
+	default:
+		meta = &models.RunMetadata{Provider: "local"}
+		if host, err := os.Hostname(); err == nil {
+			meta.Agent = host
+		}
+	}
+
+	// Links to source lines, for any host
+	if url := getenv("GAUGE_SOURCE_URL"); url != "" {
+		meta.SourceURL = url
+	}
+
+	// Fill gaps from the local repository
+	if meta.GitCommit == "" {
+		meta.GitCommit = git("rev-parse", "HEAD")
+	}
+	if meta.Branch == "" {
+		if branch := git("rev-parse", "--abbrev-ref", "HEAD"); branch != "HEAD" {
+			meta.Branch = branch
+		}
+	}
+
+	return meta
+}
+
+// runGit runs a git command and returns its trimmed output, or "" on failure
+func runGit(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package ci
+
+import "testing"
+
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func fakeGit(commit, branch string) func(args ...string) string {
+	return func(args ...string) string {
+		if len(args) == 2 && args[1] == "HEAD" {
+			return commit
+		}
+		return branch
+	}
+}
+
+func TestCollect_GitHubActions(t *testing.T) {
+	meta := collect(fakeEnv(map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_RUN_NUMBER": "412",
+		"GITHUB_RUN_ID":     "987",
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "acme/shop",
+		"GITHUB_REF_NAME":   "main",
+		"GITHUB_SHA":        "abc1234def",
+		"RUNNER_NAME":       "runner-7",
+	}), fakeGit("", ""))
+
+	if meta.Provider != "github-actions" || meta.BuildNumber != "412" || meta.Branch != "main" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+	if meta.BuildURL != "https://github.com/acme/shop/actions/runs/987" {
+		t.Errorf("Unexpected build URL: %s", meta.BuildURL)
+	}
+	if meta.ShortCommit() != "abc1234" || meta.Agent != "runner-7" {
+		t.Errorf("Unexpected commit/agent: %+v", meta)
+	}
+	if meta.SourceURL != "https://github.com/acme/shop/blob/{commit}/{path}#L{line}" {
+		t.Errorf("Unexpected source URL: %s", meta.SourceURL)
+	}
+}
+
+func TestCollect_Jenkins(t *testing.T) {
+	meta := collect(fakeEnv(map[string]string{
+		"BUILD_URL":    "https://ci.example.com/job/shop/88/",
+		"BUILD_NUMBER": "88",
+		"GIT_BRANCH":   "origin/release",
+		"GIT_COMMIT":   "fedcba987654",
+		"NODE_NAME":    "agent-3",
+	}), fakeGit("", ""))
+
+	if meta.Provider != "jenkins" || meta.BuildNumber != "88" || meta.Branch != "release" || meta.Agent != "agent-3" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+}
+
+func TestCollect_GitLab(t *testing.T) {
+	meta := collect(fakeEnv(map[string]string{
+		"GITLAB_CI":          "true",
+		"CI_PIPELINE_IID":    "55",
+		"CI_PIPELINE_URL":    "https://gitlab.example.com/shop/-/pipelines/1055",
+		"CI_COMMIT_REF_NAME": "feature/cart",
+		"CI_COMMIT_SHA":      "0123456789ab",
+	}), fakeGit("", ""))
+
+	if meta.Provider != "gitlab-ci" || meta.BuildNumber != "55" || meta.Branch != "feature/cart" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+}
+
+func TestCollect_LocalFallsBackToGit(t *testing.T) {
+	meta := collect(fakeEnv(nil), fakeGit("1111111222222", "topic"))
+
+	if meta.Provider != "local" || meta.GitCommit != "1111111222222" || meta.Branch != "topic" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+
+	detached := collect(fakeEnv(nil), fakeGit("1111111222222", "HEAD"))
+	if detached.Branch != "" {
+		t.Errorf("Expected no branch for detached HEAD, got %s", detached.Branch)
+	}
+}
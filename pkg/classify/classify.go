@@ -0,0 +1,210 @@
+package classify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultFile is the error rules file looked up in the Gauge project root
+const DefaultFile = "error-rules.yaml"
+
+// Categories of the built-in rules
+const (
+	Assertion   = "Assertion Failure"
+	Timeout     = "Timeout"
+	Network     = "Network Error"
+	NullPointer = "Null Pointer"
+	NotFound    = "Not Found"
+	Permission  = "Permission"
+	FileSystem  = "File System"
+	Database    = "Database"
+	TypeError   = "Type Error"
+	Environment = "Environment"
+	Unknown     = "Unknown Error" // no rule matched
+)
+
+// Rule adds its weight to a category when its pattern matches a failure
+type Rule struct {
+	Category string   `yaml:"category"`
+	Pattern  string   `yaml:"pattern"`          // regular expression, case-insensitive
+	Weight   *float64 `yaml:"weight,omitempty"` // positive, default 1 when nil
+	In       string   `yaml:"in,omitempty"`     // "message", "stacktrace", or both when empty
+
+	re     *regexp.Regexp
+	weight float64
+}
+
+// Category describes a category for failures no built-in category covers
+type Category struct {
+	Name       string `yaml:"name"`
+	Severity   string `yaml:"severity,omitempty"`   // "critical", "high", "medium" or "low"
+	Suggestion string `yaml:"suggestion,omitempty"` // shown when no AI suggestion is available
+}
+
+// File is the contents of an error rules file
+type File struct {
+	Categories []*Category `yaml:"categories"`
+	Rules      []*Rule     `yaml:"rules"`
+	// ReplaceDefaults drops the built-in rules instead of adding to them
+	ReplaceDefaults bool `yaml:"replace_defaults"`
+}
+
+// Classifier sorts failures into categories. Every rule whose pattern
+// matches adds its weight to its category and the heaviest category wins;
+// on a tie, the category whose first matching rule comes first wins.
+// Project rules come before the built-in ones.
+type Classifier struct {
+	rules      []*Rule
+	categories map[string]*Category
+}
+
+// weight returns a pointer to a rule weight
+func weight(w float64) *float64 {
+	return &w
+}
+
+// defaultRules are the built-in rules, most specific first
+var defaultRules = []*Rule{
+	{Category: Timeout, Pattern: `timed?[ -]?out(s|exception|error)?\b|deadline exceeded`, Weight: weight(4)},
+	{Category: FileSystem, Pattern: `no such file|file not found|\benoent\b|is a directory`, Weight: weight(4)},
+	{Category: NullPointer, Pattern: `null ?pointer|nullreferenceexception|nil pointer|nonetype|cannot read propert(y|ies) of (null|undefined)|undefined is not`, Weight: weight(4)},
+	{Category: Assertion, Pattern: `\bassert`, Weight: weight(3)},
+	{Category: Assertion, Pattern: `\bexpected\b|\bactual\b|should (be|have|equal|contain)|must be|not equal|\bequals?\b`, Weight: weight(2)},
+	{Category: Network, Pattern: `connection (refused|reset|closed|aborted)|\beconn\w+|no route to host|unreachable|\bdns\b|\bsocket\b|\bnetwork\b`, Weight: weight(3)},
+	{Category: Network, Pattern: `\bconnection\b|\bhttps?\b`, Weight: weight(1)},
+	{Category: Database, Pattern: `\bsql|database|duplicate key|constraint|deadlock|\btransaction\b`, Weight: weight(3)},
+	{Category: Permission, Pattern: `permission denied|access denied|unauthori[sz]ed|forbidden|\b40[13]\b`, Weight: weight(3)},
+	{Category: NotFound, Pattern: `not found|\b404\b|no such element|\bmissing\b`, Weight: weight(2)},
+	{Category: TypeError, Pattern: `type ?error|cannot convert|invalid type|classcastexception`, Weight: weight(2)},
+	{Category: Environment, Pattern: `environment|\bconfig(uration)?\b|variable not set|\bproperty\b`, Weight: weight(2)},
+	{Category: NullPointer, Pattern: `\b(null|nil|none|undefined)\b`, Weight: weight(1)},
+	{Category: FileSystem, Pattern: `\bdirectory\b|\bpath\b`, Weight: weight(1)},
+}
+
+// Default returns a classifier with the built-in rules only
+func Default() *Classifier {
+	c, err := New(&File{})
+	if err != nil {
+		panic(err) // the built-in rules are known to compile
+	}
+	return c
+}
+
+// New builds a classifier from the rules and categories of a rules file
+func New(file *File) (*Classifier, error) {
+	c := &Classifier{categories: make(map[string]*Category)}
+	for _, category := range file.Categories {
+		if category.Name == "" {
+			return nil, fmt.Errorf("category without a name")
+		}
+		c.categories[category.Name] = category
+	}
+
+	rules := file.Rules
+	if !file.ReplaceDefaults {
+		rules = append(append([]*Rule{}, file.Rules...), defaultRules...)
+	}
+	for i, rule := range rules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("rule %d names no category", i+1)
+		}
+		switch rule.In {
+		case "", "message", "stacktrace":
+		default:
+			return nil, fmt.Errorf("rule %d: unknown \"in\" value %q (use message or stacktrace)", i+1, rule.In)
+		}
+		if rule.Weight != nil && *rule.Weight <= 0 {
+			return nil, fmt.Errorf("rule %d: weight must be positive, got %v", i+1, *rule.Weight)
+		}
+		re, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		compiled := *rule
+		compiled.re = re
+		compiled.weight = 1
+		if rule.Weight != nil {
+			compiled.weight = *rule.Weight
+		}
+		c.rules = append(c.rules, &compiled)
+	}
+	return c, nil
+}
+
+// Path resolves the error rules file: file if set, relative to projectRoot
+// unless absolute, or DefaultFile in projectRoot
+func Path(file, projectRoot string) string {
+	if file == "" {
+		file = DefaultFile
+	}
+	if filepath.IsAbs(file) || projectRoot == "" {
+		return file
+	}
+	return filepath.Join(projectRoot, file)
+}
+
+// Load reads an error rules file. A missing file gives the built-in rules.
+func Load(path string) (*Classifier, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error rules file: %w", err)
+	}
+
+	file := &File{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse error rules file %s: %w", path, err)
+	}
+	c, err := New(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid error rules file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Classify returns the category of a failure from its error message and
+// stack trace, or Unknown
+func (c *Classifier) Classify(message, stackTrace string) string {
+	scores := make(map[string]float64)
+	var order []string // categories by first matching rule
+	for _, rule := range c.rules {
+		var text string
+		switch rule.In {
+		case "message":
+			text = message
+		case "stacktrace":
+			text = stackTrace
+		default:
+			text = message + "\n" + stackTrace
+		}
+		if strings.TrimSpace(text) == "" || !rule.re.MatchString(text) {
+			continue
+		}
+		if _, seen := scores[rule.Category]; !seen {
+			order = append(order, rule.Category)
+		}
+		scores[rule.Category] += rule.weight
+	}
+
+	best := Unknown
+	for _, category := range order {
+		if best == Unknown || scores[category] > scores[best] {
+			best = category
+		}
+	}
+	return best
+}
+
+// Category returns the description of a category from the rules file, or nil
+// for built-in categories and categories without one
+func (c *Classifier) Category(name string) *Category {
+	return c.categories[name]
+}
@@ -0,0 +1,137 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifier_Defaults(t *testing.T) {
+	classifier := Default()
+
+	tests := []struct {
+		message    string
+		stackTrace string
+		expected   string
+	}{
+		{"Expected 5 but got 1", "", Assertion},
+		{"Connection timeout after 30 seconds", "", Timeout},
+		{"Connection refused to host", "", Network},
+		{"java.net.SocketTimeoutException: Read timed out", "", Timeout},
+		{"Cannot read properties of undefined (reading 'id')", "", NullPointer},
+		{"open /tmp/data.csv: no such file or directory", "", FileSystem},
+		{"ERROR: duplicate key value violates unique constraint", "", Database},
+		{"Request failed with status 403 Forbidden", "", Permission},
+		{"Element #submit not found", "", NotFound},
+		{"Something odd happened", "", Unknown},
+		{"Step failed", "java.lang.NullPointerException\n\tat com.example.Cart.total(Cart.java:42)", NullPointer},
+		{"", "", Unknown},
+	}
+	for _, tt := range tests {
+		if got := classifier.Classify(tt.message, tt.stackTrace); got != tt.expected {
+			t.Errorf("Classify(%q): expected %s, got %s", tt.message, tt.expected, got)
+		}
+	}
+
+	// Results do not depend on rule iteration order between calls
+	for i := 0; i < 50; i++ {
+		if got := classifier.Classify("Read timed out, expected a response over the connection", ""); got != Timeout {
+			t.Fatalf("Expected a stable Timeout, got %s on call %d", got, i)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	classifier, err := Load(filepath.Join(dir, DefaultFile))
+	if err != nil {
+		t.Fatalf("Expected the built-in rules for a missing file, got %v", err)
+	}
+	if got := classifier.Classify("Expected 5 but got 1", ""); got != Assertion {
+		t.Errorf("Expected the built-in rules, got %s", got)
+	}
+
+	path := filepath.Join(dir, DefaultFile)
+	content := `categories:
+  - name: Payment Gateway
+    severity: critical
+    suggestion: Check the payment sandbox status page.
+rules:
+  - category: Payment Gateway
+    pattern: 'stripe|adyen|payment gateway'
+    weight: 5
+  - category: Feature Flag
+    pattern: 'flag \S+ is (off|disabled)'
+    in: message
+  - category: Feature Flag
+    pattern: 'LaunchDarkly'
+    in: stacktrace
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+	classifier, err = Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules file: %v", err)
+	}
+
+	// A heavy project rule outweighs the built-in timeout rule
+	if got := classifier.Classify("Stripe request timed out", ""); got != "Payment Gateway" {
+		t.Errorf("Expected Payment Gateway, got %s", got)
+	}
+	// Project rules come first, so they win ties with built-in ones
+	if got := classifier.Classify("Flag new-checkout is off", ""); got != "Feature Flag" {
+		t.Errorf("Expected Feature Flag, got %s", got)
+	}
+	// in restricts a rule to the stack trace
+	if got := classifier.Classify("LaunchDarkly", ""); got != Unknown {
+		t.Errorf("Expected a stack trace rule to ignore the message, got %s", got)
+	}
+	if got := classifier.Classify("Step failed", "at com.launchdarkly.Client.eval"); got != "Feature Flag" {
+		t.Errorf("Expected Feature Flag from the stack trace, got %s", got)
+	}
+	// The built-in rules still apply
+	if got := classifier.Classify("Expected 5 but got 1", ""); got != Assertion {
+		t.Errorf("Expected Assertion, got %s", got)
+	}
+
+	category := classifier.Category("Payment Gateway")
+	if category == nil || category.Severity != "critical" || category.Suggestion == "" {
+		t.Errorf("Expected the Payment Gateway category, got %+v", category)
+	}
+	if classifier.Category(Timeout) != nil {
+		t.Errorf("Expected no description for a built-in category")
+	}
+
+	if err := os.WriteFile(path, []byte("replace_defaults: true\nrules:\n  - category: Flaky\n    pattern: retry\n"), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+	classifier, err = Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load rules file: %v", err)
+	}
+	if got := classifier.Classify("Expected 5 but got 1", ""); got != Unknown {
+		t.Errorf("Expected the built-in rules to be replaced, got %s", got)
+	}
+
+	for content, want := range map[string]string{
+		"rules:\n  - pattern: x\n":                    "names no category",
+		"rules:\n  - category: X\n    pattern: '('\n": "missing closing",
+		"rules:\n  - category: X\n    in: headers\n":  `unknown "in" value "headers"`,
+		"rules:\n  - category: X\n    weight: 0\n":    "weight must be positive, got 0",
+		"rules:\n  - category: X\n    weight: -2\n":   "weight must be positive, got -2",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write rules file: %v", err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error containing %q, got %v", want, err)
+		}
+	}
+
+	if got := Path("", "/project"); got != filepath.Join("/project", DefaultFile) {
+		t.Errorf("Expected the default file in the project root, got %s", got)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/spf13/viper"
@@ -23,6 +24,72 @@ type Config struct {
 	TrendWindowDays    int
 	FlakyTestDetection bool
 
+	// Performance regression settings
+	StepRegressionThreshold  float64 // slowdown ratio vs historical median
+	DurationAnomalyThreshold float64 // robust z-score beyond which a scenario's duration is anomalous
+	HistoryMinSamples        int     // runs needed before comparing with history
+
+	// History storage settings. An empty HistoryDSN keeps the per-workspace
+	// SQLite file; a postgres:// DSN shares history between CI agents.
+	HistoryDSN string
+
+	// Trends, flaky detection and baselines only use runs of the same project
+	// and environment; with HistoryPartitionByTags also the same tag filter
+	HistoryPartitionByTags bool
+
+	// Retention: runs older than HistoryRetentionDays, or beyond the newest
+	// HistoryMaxRuns per project, environment and tag filter, are rolled up
+	// into daily aggregates after each report. Zero keeps everything.
+	HistoryRetentionDays int
+	HistoryMaxRuns       int
+
+	// Quarantine list; empty means quarantine.yaml in the project root.
+	// Scenarios with a flaky score of at least QuarantineSuggestScore over
+	// QuarantineSuggestMinRuns runs are suggested for quarantine, for
+	// QuarantineExpireDays; quarantined scenarios that passed
+	// QuarantineReleaseAfter runs in a row are suggested for release.
+	QuarantineFile           string
+	QuarantineReleaseAfter   int
+	QuarantineSuggestScore   float64
+	QuarantineSuggestMinRuns int
+	QuarantineExpireDays     int
+
+	// Error classification rules; empty means error-rules.yaml in the
+	// project root, and the built-in rules when that does not exist
+	ErrorRulesFile string
+
+	// Failure groups of one type at least this similar (0 to 1) are merged
+	FailureClusterThreshold float64
+
+	// Failure groups whose message embeddings from the local AI provider
+	// are at least this similar (cosine, 0 to 1) are merged
+	EmbeddingThreshold float64
+
+	// A run introducing at least this many new failure groups across
+	// several specs is flagged as a burst with a likely shared cause
+	FailureBurstMinGroups int
+
+	// A run is reported as an environment outage when at least this share
+	// of its executed scenarios, and at least OutageMinScenarios, failed with
+	// network or timeout errors within OutageWindowMinutes (0 for any time)
+	OutageFailureRatio  float64
+	OutageMinScenarios  int
+	OutageWindowMinutes int
+
+	// LLM responses are reused from the history database for this many
+	// days (0 disables the cache); AICacheRefresh replaces them instead
+	AICacheTTLDays int
+	AICacheRefresh bool
+
+	// LLM fix suggestions are requested AIConcurrency at a time, at most
+	// AIRequestsPerMinute (0 for no limit), with up to AIMaxRetries retries
+	// on 429 and 5xx answers; groups not answered within AIDeadlineSeconds
+	// (0 for no limit) keep their pattern-based suggestion
+	AIConcurrency       int
+	AIRequestsPerMinute int
+	AIMaxRetries        int
+	AIDeadlineSeconds   int
+
 	// Export settings
 	ExportFormats     []string
 	PDFTemplate       string
@@ -64,32 +131,50 @@ type Config struct {
 // NewConfig creates a new configuration with default values
 func NewConfig() *Config {
 	return &Config{
-		ProjectName:          getProjectName(),
-		ReportsDir:           "reports",
-		ThemePath:            "enhanced-default",
-		MinifyHTML:           false,
-		EnableAnalytics:      true,
-		EnableTrends:         true,
-		HistoricalData:       true,
-		TrendWindowDays:      30,
-		FlakyTestDetection:   true,
-		ExportFormats:        []string{"html"},
-		PDFTemplate:          "default",
-		MaxScreenshotSize:    "2MB",
-		EnableNotifications:  false,
-		NotificationChannels: []string{},
-		MaxConcurrentGen:     4,
-		CacheEnabled:         true,
-		CacheTTL:             24 * time.Hour,
-		DefaultTheme:         "light",
-		EnableDarkMode:       true,
-		ShowTimeline:         true,
-		ShowTrends:           true,
-		CollapseSections:     false,
-		EnableFullTextSearch: true,
-		EnableRegex:          true,
-		SearchIndexPath:      "search_index.json",
-		CustomFields:         make(map[string]interface{}),
+		ProjectName:              getProjectName(),
+		ReportsDir:               "reports",
+		ThemePath:                "enhanced-default",
+		MinifyHTML:               false,
+		EnableAnalytics:          true,
+		EnableTrends:             true,
+		HistoricalData:           true,
+		TrendWindowDays:          30,
+		FlakyTestDetection:       true,
+		StepRegressionThreshold:  1.5,
+		DurationAnomalyThreshold: 3.5,
+		HistoryMinSamples:        5,
+		QuarantineReleaseAfter:   10,
+		QuarantineSuggestScore:   0.5,
+		QuarantineSuggestMinRuns: 5,
+		QuarantineExpireDays:     30,
+		FailureClusterThreshold:  0.8,
+		EmbeddingThreshold:       0.85,
+		FailureBurstMinGroups:    4,
+		OutageFailureRatio:       0.5,
+		OutageMinScenarios:       5,
+		OutageWindowMinutes:      10,
+		AICacheTTLDays:           30,
+		AIConcurrency:            4,
+		AIRequestsPerMinute:      60,
+		AIMaxRetries:             3,
+		AIDeadlineSeconds:        120,
+		ExportFormats:            []string{"html"},
+		PDFTemplate:              "default",
+		MaxScreenshotSize:        "2MB",
+		EnableNotifications:      false,
+		NotificationChannels:     []string{},
+		MaxConcurrentGen:         4,
+		CacheEnabled:             true,
+		CacheTTL:                 24 * time.Hour,
+		DefaultTheme:             "light",
+		EnableDarkMode:           true,
+		ShowTimeline:             true,
+		ShowTrends:               true,
+		CollapseSections:         false,
+		EnableFullTextSearch:     true,
+		EnableRegex:              true,
+		SearchIndexPath:          "search_index.json",
+		CustomFields:             make(map[string]interface{}),
 	}
 }
 
@@ -150,6 +235,110 @@ func (c *Config) LoadFromEnv() {
 		c.EnableAnalytics = true
 	}
 
+	if dsn := os.Getenv("GAUGE_HISTORY_DSN"); dsn != "" {
+		c.HistoryDSN = dsn
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("GAUGE_TREND_WINDOW_DAYS")); err == nil {
+		c.TrendWindowDays = days
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("GAUGE_HISTORY_RETENTION_DAYS")); err == nil {
+		c.HistoryRetentionDays = days
+	}
+
+	if runs, err := strconv.Atoi(os.Getenv("GAUGE_HISTORY_MAX_RUNS")); err == nil {
+		c.HistoryMaxRuns = runs
+	}
+
+	if ratio, err := strconv.ParseFloat(os.Getenv("GAUGE_STEP_REGRESSION_THRESHOLD"), 64); err == nil {
+		c.StepRegressionThreshold = ratio
+	}
+
+	if samples, err := strconv.Atoi(os.Getenv("GAUGE_HISTORY_MIN_SAMPLES")); err == nil {
+		c.HistoryMinSamples = samples
+	}
+
+	if threshold, err := strconv.ParseFloat(os.Getenv("GAUGE_DURATION_ANOMALY_THRESHOLD"), 64); err == nil {
+		c.DurationAnomalyThreshold = threshold
+	}
+
+	if file := os.Getenv("GAUGE_QUARANTINE_FILE"); file != "" {
+		c.QuarantineFile = file
+	}
+
+	if runs, err := strconv.Atoi(os.Getenv("GAUGE_QUARANTINE_RELEASE_AFTER")); err == nil {
+		c.QuarantineReleaseAfter = runs
+	}
+
+	if score, err := strconv.ParseFloat(os.Getenv("GAUGE_QUARANTINE_SUGGEST_SCORE"), 64); err == nil {
+		c.QuarantineSuggestScore = score
+	}
+
+	if runs, err := strconv.Atoi(os.Getenv("GAUGE_QUARANTINE_SUGGEST_MIN_RUNS")); err == nil {
+		c.QuarantineSuggestMinRuns = runs
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("GAUGE_QUARANTINE_EXPIRE_DAYS")); err == nil {
+		c.QuarantineExpireDays = days
+	}
+
+	if file := os.Getenv("GAUGE_ERROR_RULES_FILE"); file != "" {
+		c.ErrorRulesFile = file
+	}
+
+	if threshold, err := strconv.ParseFloat(os.Getenv("GAUGE_FAILURE_CLUSTER_THRESHOLD"), 64); err == nil {
+		c.FailureClusterThreshold = threshold
+	}
+
+	if threshold, err := strconv.ParseFloat(os.Getenv("GAUGE_EMBEDDING_CLUSTER_THRESHOLD"), 64); err == nil {
+		c.EmbeddingThreshold = threshold
+	}
+
+	if groups, err := strconv.Atoi(os.Getenv("GAUGE_FAILURE_BURST_MIN_GROUPS")); err == nil {
+		c.FailureBurstMinGroups = groups
+	}
+
+	if ratio, err := strconv.ParseFloat(os.Getenv("GAUGE_OUTAGE_FAILURE_RATIO"), 64); err == nil {
+		c.OutageFailureRatio = ratio
+	}
+
+	if scenarios, err := strconv.Atoi(os.Getenv("GAUGE_OUTAGE_MIN_SCENARIOS")); err == nil {
+		c.OutageMinScenarios = scenarios
+	}
+
+	if minutes, err := strconv.Atoi(os.Getenv("GAUGE_OUTAGE_WINDOW_MINUTES")); err == nil {
+		c.OutageWindowMinutes = minutes
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("GAUGE_AI_CACHE_TTL_DAYS")); err == nil {
+		c.AICacheTTLDays = days
+	}
+
+	if refresh := os.Getenv("GAUGE_AI_CACHE_REFRESH"); refresh == "true" {
+		c.AICacheRefresh = true
+	}
+
+	if concurrency, err := strconv.Atoi(os.Getenv("GAUGE_AI_CONCURRENCY")); err == nil {
+		c.AIConcurrency = concurrency
+	}
+
+	if rate, err := strconv.Atoi(os.Getenv("GAUGE_AI_REQUESTS_PER_MINUTE")); err == nil {
+		c.AIRequestsPerMinute = rate
+	}
+
+	if retries, err := strconv.Atoi(os.Getenv("GAUGE_AI_MAX_RETRIES")); err == nil {
+		c.AIMaxRetries = retries
+	}
+
+	if seconds, err := strconv.Atoi(os.Getenv("GAUGE_AI_DEADLINE_SECONDS")); err == nil {
+		c.AIDeadlineSeconds = seconds
+	}
+
+	if byTags := os.Getenv("GAUGE_HISTORY_PARTITION_BY_TAGS"); byTags == "true" {
+		c.HistoryPartitionByTags = true
+	}
+
 	if minify := os.Getenv("GAUGE_MINIFY_REPORTS"); minify == "true" {
 		c.MinifyHTML = true
 	}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestLoadFromEnv_HistorySettings(t *testing.T) {
+	cfg := NewConfig()
+	if cfg.StepRegressionThreshold != 1.5 || cfg.HistoryMinSamples != 5 || cfg.DurationAnomalyThreshold != 3.5 {
+		t.Fatalf("Unexpected defaults: step %v, samples %d, anomaly %v",
+			cfg.StepRegressionThreshold, cfg.HistoryMinSamples, cfg.DurationAnomalyThreshold)
+	}
+
+	t.Setenv("GAUGE_STEP_REGRESSION_THRESHOLD", "2.5")
+	t.Setenv("GAUGE_HISTORY_MIN_SAMPLES", "10")
+	t.Setenv("GAUGE_DURATION_ANOMALY_THRESHOLD", "4")
+	cfg.LoadFromEnv()
+	if cfg.StepRegressionThreshold != 2.5 || cfg.HistoryMinSamples != 10 || cfg.DurationAnomalyThreshold != 4 {
+		t.Errorf("Expected the env overrides, got step %v, samples %d, anomaly %v",
+			cfg.StepRegressionThreshold, cfg.HistoryMinSamples, cfg.DurationAnomalyThreshold)
+	}
+
+	t.Setenv("GAUGE_TREND_WINDOW_DAYS", "14")
+	cfg.LoadFromEnv()
+	if cfg.TrendWindowDays != 14 {
+		t.Errorf("Expected a 14-day trend window, got %d", cfg.TrendWindowDays)
+	}
+
+	// Invalid values keep the current setting
+	t.Setenv("GAUGE_HISTORY_MIN_SAMPLES", "many")
+	cfg.LoadFromEnv()
+	if cfg.HistoryMinSamples != 10 {
+		t.Errorf("Expected an invalid value to be ignored, got %d", cfg.HistoryMinSamples)
+	}
+}
@@ -10,11 +10,15 @@ import (
 
 	"github.com/getgauge/gauge-proto/go/gauge_messages"
 	"github.com/lirany1/gauge-html-report-ai/pkg/analytics"
+	"github.com/lirany1/gauge-html-report-ai/pkg/ci"
+	"github.com/lirany1/gauge-html-report-ai/pkg/classify"
 	"github.com/lirany1/gauge-html-report-ai/pkg/config"
 	"github.com/lirany1/gauge-html-report-ai/pkg/export"
 	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
 	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"github.com/lirany1/gauge-html-report-ai/pkg/quarantine"
 	"github.com/lirany1/gauge-html-report-ai/pkg/renderer"
+	"github.com/lirany1/gauge-html-report-ai/pkg/stacktrace"
 	"github.com/lirany1/gauge-html-report-ai/pkg/themes"
 	"google.golang.org/protobuf/proto"
 )
@@ -30,9 +34,17 @@ type Generator struct {
 
 // NewGenerator creates a new enhanced report generator
 func NewGenerator(cfg *config.Config) *Generator {
+	engine := analytics.NewEngine(cfg, nil) // Pass nil for database since generator doesn't use it
+	classifier, err := classify.Load(classify.Path(cfg.ErrorRulesFile, os.Getenv("GAUGE_PROJECT_ROOT")))
+	if err != nil {
+		logger.Warnf("Using built-in error rules: %v", err)
+	} else {
+		engine.SetClassifier(classifier)
+	}
+
 	return &Generator{
 		config:    cfg,
-		analytics: analytics.NewEngine(cfg, nil), // Pass nil for database since generator doesn't use it
+		analytics: engine,
 		renderer:  renderer.NewRenderer(cfg),
 		exporter:  export.NewExporter(cfg),
 		themes:    themes.NewManager(cfg),
@@ -72,10 +84,23 @@ func (g *Generator) Generate(suite *models.EnhancedSuiteResult, outputDir string
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	// Point failures at the project code they hit
+	stacktrace.NewResolver(os.Getenv("GAUGE_PROJECT_ROOT"), suite.RunMetadata).Annotate(suite)
+
+	// Quarantined scenarios are reported apart and left out of the success rate
+	quarantinePath := quarantine.Path(g.config.QuarantineFile, os.Getenv("GAUGE_PROJECT_ROOT"))
+	quarantineList, err := quarantine.Load(quarantinePath)
+	if err != nil {
+		logger.Warnf("Ignoring quarantine list: %v", err)
+	} else {
+		quarantineList.Apply(suite, time.Now())
+	}
+
 	// Run analytics if enabled
 	if g.config.EnableAnalytics {
 		logger.Info("Running analytics...")
 		suite.Analytics = g.analytics.Analyze(suite)
+		suite.PerformanceMetrics = g.analytics.AnalyzePerformance(suite)
 	}
 
 	// Generate historical trends if enabled
@@ -87,7 +112,8 @@ func (g *Generator) Generate(suite *models.EnhancedSuiteResult, outputDir string
 	// Detect flaky tests if enabled
 	if g.config.FlakyTestDetection {
 		logger.Info("Detecting flaky tests...")
-		suite.FlakyTests = g.analytics.DetectFlakyTests(suite)
+		suite.FlakyTests, suite.BrokenTests = g.analytics.DetectUnstableTests(suite)
+		suite.QuarantineSuggestions = g.analytics.SuggestQuarantine(suite, quarantineList, time.Now())
 	}
 
 	// Copy theme assets
@@ -143,6 +169,7 @@ func (g *Generator) transformProtoToEnhanced(proto *gauge_messages.ProtoSuiteRes
 		Tags:               []string{proto.GetTags()}, // Tags is a string, convert to slice
 		ExecutionTime:      time.Duration(proto.GetExecutionTime()) * time.Millisecond,
 		Timestamp:          time.Now(), // Use current time since timestamp is string
+		RunMetadata:        ci.Collect(""),
 		SuccessRate:        calculateSuccessRate(proto),
 		SpecResults:        make([]*models.SpecResult, 0),
 		BeforeSuiteFailure: transformHookFailure(proto.GetPreHookFailure()),
@@ -195,12 +222,20 @@ func (g *Generator) transformSpec(protoSpec *gauge_messages.ProtoSpecResult) *mo
 
 	// Transform scenarios
 	for _, protoItem := range protoSpec.GetProtoSpec().GetItems() {
-		if protoItem.GetItemType() == gauge_messages.ProtoItem_Scenario {
+		switch protoItem.GetItemType() {
+		case gauge_messages.ProtoItem_Scenario:
 			scenario := g.transformScenario(protoItem.GetScenario())
 			spec.Scenarios = append(spec.Scenarios, scenario)
+		case gauge_messages.ProtoItem_TableDrivenScenario:
+			tableDriven := protoItem.GetTableDrivenScenario()
+			scenario := g.transformScenario(tableDriven.GetScenario())
+			scenario.RowIndex = int(tableDriven.GetTableRowIndex()) + 1
+			spec.Scenarios = append(spec.Scenarios, scenario)
 		}
 	}
 
+	projectRoot, _ := os.Getwd()
+	spec.AssignScenarioIDs(projectRoot)
 	return spec
 }
 
@@ -213,8 +248,10 @@ func (g *Generator) transformScenario(protoScenario *gauge_messages.ProtoScenari
 		//nolint:staticcheck // Using deprecated Gauge proto method until framework provides alternative
 		Failed: protoScenario.GetFailed(),
 		//nolint:staticcheck // Using deprecated Gauge proto method until framework provides alternative
-		Skipped: protoScenario.GetSkipped(),
-		Steps:   make([]*models.StepResult, 0),
+		Skipped:   protoScenario.GetSkipped(),
+		Steps:     make([]*models.StepResult, 0),
+		LineStart: int(protoScenario.GetSpan().GetStart()),
+		Retries:   int(protoScenario.GetRetriesCount()),
 	}
 }
 
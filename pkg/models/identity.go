@@ -0,0 +1,58 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AssignScenarioIDs gives every scenario of the spec a stable ID derived from
+// the spec file path (relative to projectRoot), the scenario heading and its
+// data table row. Scenarios that share a heading and row within the file are
+// told apart by their order of appearance.
+func (s *SpecResult) AssignScenarioIDs(projectRoot string) {
+	s.RelativePath = relativeSpecPath(s.FileName, s.SpecHeading, projectRoot)
+
+	seen := make(map[string]int)
+	for _, scenario := range s.Scenarios {
+		key := fmt.Sprintf("%s\x00%d", strings.TrimSpace(scenario.ScenarioHeading), scenario.RowIndex)
+		seen[key]++
+		scenario.ID = ScenarioID(s.RelativePath, scenario.ScenarioHeading, scenario.RowIndex, seen[key])
+	}
+}
+
+// ScenarioID derives the stable ID of the occurrence-th scenario (1-based) with
+// the given heading and data table row in specPath
+func ScenarioID(specPath, heading string, rowIndex, occurrence int) string {
+	key := fmt.Sprintf("%s\x00%s\x00%d", specPath, strings.TrimSpace(heading), rowIndex)
+	if occurrence > 1 {
+		key += fmt.Sprintf("\x00%d", occurrence)
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StepTexts returns the text of each step, in order
+func (s *ScenarioResult) StepTexts() []string {
+	texts := make([]string, 0, len(s.Steps))
+	for _, step := range s.Steps {
+		texts = append(texts, step.StepText)
+	}
+	return texts
+}
+
+// relativeSpecPath makes fileName relative to projectRoot with forward slashes,
+// so IDs match across agents that check the project out in different places
+func relativeSpecPath(fileName, specHeading, projectRoot string) string {
+	if fileName == "" {
+		return specHeading
+	}
+	if projectRoot != "" && filepath.IsAbs(fileName) {
+		if rel, err := filepath.Rel(projectRoot, fileName); err == nil && !strings.HasPrefix(rel, "..") {
+			fileName = rel
+		}
+	}
+	return filepath.ToSlash(fileName)
+}
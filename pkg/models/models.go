@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 	"time"
@@ -14,6 +15,7 @@ type EnhancedSuiteResult struct {
 	ExecutionTime time.Duration
 	Timestamp     time.Time
 	SuccessRate   float64
+	RunMetadata   *RunMetadata
 
 	// Counts
 	PassedSpecsCount      int
@@ -25,8 +27,16 @@ type EnhancedSuiteResult struct {
 	SkippedScenariosCount int
 	TotalScenariosCount   int
 
+	// Quarantined scenarios are counted here only, not as passed, failed or
+	// skipped, and are left out of SuccessRate; see CountScenarios
+	QuarantinedScenariosCount int
+	QuarantinedFailuresCount  int
+	QuarantineWarnings        []string // expired entries still naming a scenario
+	QuarantineSuggestions     []*QuarantineSuggestion
+
 	// Results
 	SpecResults        []*SpecResult
+	ExecutionSpans     []*ExecutionSpan // real spec start and end times per stream, when recorded
 	BeforeSuiteFailure *HookFailure
 	AfterSuiteFailure  *HookFailure
 	Messages           []string
@@ -36,6 +46,7 @@ type EnhancedSuiteResult struct {
 	Analytics          *Analytics
 	Trends             *TrendData
 	FlakyTests         []*FlakyTest
+	BrokenTests        []*FlakyTest // failing consistently since BrokenSince
 	PerformanceMetrics *PerformanceMetrics
 	AIInsights         *AIInsights
 }
@@ -44,6 +55,7 @@ type EnhancedSuiteResult struct {
 type SpecResult struct {
 	SpecHeading   string
 	FileName      string
+	RelativePath  string // FileName relative to the project root; see AssignScenarioIDs
 	Tags          []string
 	ExecutionTime time.Duration
 	Failed        bool
@@ -65,6 +77,24 @@ type ScenarioResult struct {
 	TableRows       int
 	Messages        []string
 	Screenshots     [][]byte
+
+	// Identity across runs; see AssignScenarioIDs
+	ID        string
+	LineStart int // first line of the scenario in its spec file, 0 if unknown
+	RowIndex  int // 1-based data table row of a table-driven run, 0 otherwise
+
+	Retries int // times Gauge retried the scenario (--max-retries-count)
+
+	Quarantine *Quarantine // nil unless the scenario is on the quarantine list
+}
+
+// Quarantine records who quarantined a scenario and why. A quarantined
+// scenario still runs, but its failures are reported separately and do not
+// count against the suite.
+type Quarantine struct {
+	Owner   string
+	Reason  string
+	Expires time.Time // zero for no expiry
 }
 
 // StepResult represents a single step execution
@@ -75,10 +105,50 @@ type StepResult struct {
 	Skipped       bool
 	ErrorMessage  string
 	StackTrace    string
+	UserFrame     *StackFrame // innermost stack frame in project code, if recognized
 	Screenshots   [][]byte
 	Messages      []string
 }
 
+// StackFrame is one frame of a parsed stack trace
+type StackFrame struct {
+	Function  string
+	File      string // as printed in the trace
+	Line      int    // 0 if unknown
+	Framework bool   // in the language runtime, a test framework or a dependency
+	Path      string // relative to the project root, when the file was found there
+	URL       string // link to the source line, when known
+}
+
+// Location returns file:line, or the file alone when the line is unknown
+func (f *StackFrame) Location() string {
+	file := f.File
+	if f.Path != "" {
+		file = f.Path
+	}
+	if f.Line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d", file, f.Line)
+}
+
+// RunMetadata describes where and from what source a run was executed
+type RunMetadata struct {
+	Provider    string // "jenkins", "github-actions", "gitlab-ci", "local"
+	BuildNumber string
+	BuildURL    string
+	Branch      string
+	GitCommit   string
+	Agent       string
+	JobName     string
+	SourceURL   string // source link with {commit}, {path} and {line} placeholders
+}
+
+// ShortCommit returns the abbreviated git commit hash
+func (m *RunMetadata) ShortCommit() string {
+	return shortCommit(m.GitCommit)
+}
+
 // HookFailure represents a hook execution failure
 type HookFailure struct {
 	ErrorMessage string
@@ -105,10 +175,47 @@ type Analytics struct {
 	TagDistribution     map[string]int
 	FailureDistribution map[string]int
 	TimelineData        []*TimelineEntry
+	TimelineEstimated   bool // no spans were recorded; spec durations are laid end to end
+
+	// Parallel execution, from the recorded spans
+	StreamLanes []*StreamLane
+	Parallel    *ParallelMetrics
+}
+
+// StreamLane is one Gauge execution stream's row in the timeline
+type StreamLane struct {
+	Stream      int
+	Segments    []*LaneSegment
+	Busy        time.Duration // time spent running specs
+	Idle        time.Duration // rest of the suite's wall-clock time
+	Utilization float64       // busy share of the wall-clock time, in percent
+}
+
+// LaneSegment is a spec on a stream lane, placed relative to the suite's
+// wall-clock time
+type LaneSegment struct {
+	SpecName string
+	Status   string
+	Start    time.Time
+	Duration time.Duration
+	Offset   float64 // start, in percent of the wall-clock time
+	Width    float64 // duration, in percent of the wall-clock time
+}
+
+// ParallelMetrics describes how well the work was spread over the streams
+type ParallelMetrics struct {
+	Streams     int
+	WallClock   time.Duration // first spec start to last spec end
+	BusyTime    time.Duration // summed over streams
+	IdleTime    time.Duration // summed over streams
+	Utilization float64       // BusyTime over Streams × WallClock, in percent
+	Imbalance   float64       // busiest stream's time over the mean, minus one, in percent
+	Speedup     float64       // BusyTime over WallClock
 }
 
 // TrendData holds historical trend information
 type TrendData struct {
+	WindowDays         int // days of history the trends and flaky-test verdicts cover
 	HistoricalRuns     []*HistoricalRun
 	SuccessRateTrend   []float64
 	ExecutionTimeTrend []time.Duration
@@ -126,7 +233,23 @@ type HistoricalRun struct {
 	FailedCount   int
 	SkippedCount  int
 	BuildNumber   string
+	BuildURL      string
+	Branch        string
 	GitCommit     string
+	Agent         string
+	Runs          int // 1, or the number of runs averaged into a compacted day
+}
+
+// ShortCommit returns the abbreviated git commit hash
+func (r *HistoricalRun) ShortCommit() string {
+	return shortCommit(r.GitCommit)
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
 }
 
 // TrendPredictions holds ML-based predictions
@@ -154,6 +277,15 @@ type FlakyTest struct {
 	ConsecutiveFails  int
 	LastSeen          time.Time
 	Occurrences       int
+
+	Verdict     string    // "flaky" or "broken"
+	BrokenSince time.Time // first failure of the current streak of a broken test
+	Evidence    []string  // why the verdict was reached, e.g. "passed and failed on commit 1a2b3c4"
+}
+
+// IsBroken reports whether the test fails consistently rather than intermittently
+func (f *FlakyTest) IsBroken() bool {
+	return f.Verdict == "broken"
 }
 
 // PerformanceMetrics holds performance analysis data
@@ -168,10 +300,24 @@ type PerformanceMetrics struct {
 // Bottleneck represents a performance bottleneck
 type Bottleneck struct {
 	Location        string
-	Type            string // "slow_step", "memory_leak", "cpu_intensive"
-	Severity        string // "low", "medium", "high", "critical"
-	Impact          time.Duration
+	Type            string        // "slow_step", "slow_scenario", "fast_scenario", "memory_leak", "cpu_intensive"
+	Severity        string        // "low", "medium", "high", "critical"
+	Impact          time.Duration // time lost against the baseline; negative for a speed-up
 	Recommendations []string
+
+	// Historical comparison, set for regressions detected against history
+	Duration       time.Duration
+	BaselineMedian time.Duration
+	BaselineP95    time.Duration
+	BaselineMAD    time.Duration // median absolute deviation, for scenario anomalies
+	Deviation      float64       // robust z-score: distance from the median in scaled MADs
+	Samples        int
+}
+
+// IsSpeedup reports whether the bottleneck is a significant speed-up rather
+// than a slowdown
+func (b *Bottleneck) IsSpeedup() bool {
+	return b.Type == "fast_scenario"
 }
 
 // SpecPerformance tracks specification performance
@@ -195,6 +341,23 @@ type TimelineEntry struct {
 	SpecName  string
 	Duration  time.Duration
 	Status    string
+	Stream    int
+}
+
+// ExecutionSpan records when a spec ran and on which Gauge execution stream,
+// from the plugin's execution notifications
+type ExecutionSpan struct {
+	Stream   int // 1 for serial runs
+	SpecName string
+	FileName string
+	Start    time.Time
+	End      time.Time
+	Status   string // "passed", "failed" or "skipped"
+}
+
+// Duration returns how long the spec ran
+func (s *ExecutionSpan) Duration() time.Duration {
+	return s.End.Sub(s.Start)
 }
 
 // GetHTMLFileName returns the HTML filename for a spec
@@ -252,6 +415,19 @@ func (s *SpecResult) GetSkippedScenariosCount() int {
 type AIInsights struct {
 	ExecutiveSummary *ExecutiveSummary
 	FailureGroups    []*FailureGroup
+	FailureBurst     *FailureBurst // nil unless many new failures appeared together
+	Outage           *Outage       // nil unless the run failed because its environment was down
+}
+
+// Outage is the verdict that a shared dependency was down during the run.
+// The failure groups it explains are listed under it rather than in
+// AIInsights.FailureGroups.
+type Outage struct {
+	Trigger   string // "before-suite hook" or "network failures"
+	Summary   string
+	Evidence  []string
+	Scenarios int // failed scenarios explained by the outage
+	Groups    []*FailureGroup
 }
 
 // ExecutiveSummary provides high-level test health assessment
@@ -267,10 +443,108 @@ type ExecutiveSummary struct {
 type FailureGroup struct {
 	Signature         string
 	ErrorType         string
+	Pattern           string // error message with variable parts replaced by placeholders
 	RootCause         string
 	Count             int
 	AffectedScenarios []string
 	AffectedSpecs     []string
 	Severity          string
 	SuggestedFix      string
+	AISuggested       bool        // SuggestedFix came from the LLM, not a built-in pattern
+	UserFrame         *StackFrame // where the first failure hit project code
+
+	// Near-duplicate groups merged into this one, and the lowest similarity
+	// among them from 0 to 1 (1 when nothing was merged)
+	MergedSignatures []string
+	Confidence       float64
+
+	// Cross-run history, filled when a history database is available
+	Recurrence string // "new", "recurring", "regression"
+	FirstSeen  time.Time
+	LastSeen   time.Time // last run before this one that had the signature
+	SeenInRuns int       // runs with this signature, including this one
+
+	// Where the signature came from: the CI build and commit of its first
+	// run, and the other failures that first appeared in that run
+	FirstBuild     string
+	FirstCommit    string
+	IntroducedWith []string
+}
+
+// ShortFirstCommit returns the abbreviated commit the failure first appeared at
+func (g *FailureGroup) ShortFirstCommit() string {
+	return shortCommit(g.FirstCommit)
+}
+
+// FailureBurst flags many unrelated failures appearing together in one run,
+// which points at a shared cause such as an environment outage rather than
+// as many separate test bugs
+type FailureBurst struct {
+	NewGroups int      // failure groups first seen in this run
+	Scenarios int      // scenarios failing with them
+	Specs     []string // specs they span
+}
+
+// QuarantinedScenario is a quarantined scenario together with its spec
+type QuarantinedScenario struct {
+	SpecHeading string
+	Scenario    *ScenarioResult
+}
+
+// QuarantineSuggestion proposes adding a flaky scenario to the quarantine list
+// or releasing a quarantined one
+type QuarantineSuggestion struct {
+	Action       string // "add" or "release"
+	SpecName     string
+	SpecFile     string // relative to the project root, when known
+	ScenarioName string
+	ScenarioID   string
+	FlakyScore   float64
+	Runs         int
+	Reason       string // why, from the scenario's history
+}
+
+// CountScenarios recomputes the scenario counts and SuccessRate, counting
+// quarantined scenarios apart from passed, failed and skipped ones
+func (s *EnhancedSuiteResult) CountScenarios() {
+	s.TotalScenariosCount = 0
+	s.PassedScenariosCount, s.FailedScenariosCount, s.SkippedScenariosCount = 0, 0, 0
+	s.QuarantinedScenariosCount, s.QuarantinedFailuresCount = 0, 0
+
+	for _, spec := range s.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			s.TotalScenariosCount++
+			switch {
+			case scenario.Quarantine != nil:
+				s.QuarantinedScenariosCount++
+				if scenario.Failed {
+					s.QuarantinedFailuresCount++
+				}
+			case scenario.Failed:
+				s.FailedScenariosCount++
+			case scenario.Skipped:
+				s.SkippedScenariosCount++
+			default:
+				s.PassedScenariosCount++
+			}
+		}
+	}
+
+	s.SuccessRate = 0
+	if counted := s.TotalScenariosCount - s.QuarantinedScenariosCount; counted > 0 {
+		s.SuccessRate = float64(s.PassedScenariosCount) / float64(counted) * 100
+	}
+}
+
+// QuarantinedFailures lists the quarantined scenarios that failed in this run
+func (s *EnhancedSuiteResult) QuarantinedFailures() []*QuarantinedScenario {
+	var failures []*QuarantinedScenario
+	for _, spec := range s.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			if scenario.Quarantine != nil && scenario.Failed {
+				failures = append(failures, &QuarantinedScenario{SpecHeading: spec.SpecHeading, Scenario: scenario})
+			}
+		}
+	}
+	return failures
 }
@@ -249,3 +249,44 @@ func TestStepResult_FailureHandling(t *testing.T) {
 		t.Errorf("Messages count = %v, want %v", len(step.Messages), 2)
 	}
 }
+
+func TestSpecResult_AssignScenarioIDs(t *testing.T) {
+	newSpec := func(fileName string) *SpecResult {
+		return &SpecResult{
+			FileName: fileName,
+			Scenarios: []*ScenarioResult{
+				{ScenarioHeading: "Login"},
+				{ScenarioHeading: "Login"},
+				{ScenarioHeading: "Search", RowIndex: 1},
+				{ScenarioHeading: "Search", RowIndex: 2},
+			},
+		}
+	}
+
+	spec := newSpec("/ci/agent-1/project/specs/login.spec")
+	spec.AssignScenarioIDs("/ci/agent-1/project")
+
+	if spec.RelativePath != "specs/login.spec" {
+		t.Errorf("Expected relative path specs/login.spec, got %s", spec.RelativePath)
+	}
+
+	ids := make(map[string]bool)
+	for _, scenario := range spec.Scenarios {
+		if scenario.ID == "" {
+			t.Fatalf("Scenario %q has no ID", scenario.ScenarioHeading)
+		}
+		ids[scenario.ID] = true
+	}
+	if len(ids) != len(spec.Scenarios) {
+		t.Errorf("Expected %d distinct IDs for duplicate headings and rows, got %d", len(spec.Scenarios), len(ids))
+	}
+
+	// The same project checked out elsewhere yields the same IDs
+	other := newSpec("/home/dev/project/specs/login.spec")
+	other.AssignScenarioIDs("/home/dev/project")
+	for i, scenario := range other.Scenarios {
+		if scenario.ID != spec.Scenarios[i].ID {
+			t.Errorf("Scenario %d: expected ID %s regardless of checkout location, got %s", i, spec.Scenarios[i].ID, scenario.ID)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/lirany1/gauge-html-report-ai/pkg/builder"
 	"github.com/lirany1/gauge-html-report-ai/pkg/config"
 	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+	"github.com/lirany1/gauge-html-report-ai/pkg/timeline"
 	"google.golang.org/grpc"
 )
 
@@ -21,6 +22,7 @@ type Plugin struct {
 	server        *grpc.Server
 	stopChan      chan struct{}
 	reportBuilder *builder.ReportBuilder
+	timeline      *timeline.Recorder
 }
 
 // NewPlugin creates a new plugin instance
@@ -31,6 +33,7 @@ func NewPlugin() *Plugin {
 	return &Plugin{
 		config:   cfg,
 		stopChan: make(chan struct{}),
+		timeline: timeline.NewRecorder(),
 	}
 }
 
@@ -129,15 +132,22 @@ func (p *Plugin) Kill(ctx context.Context, request *gauge_messages.KillProcessRe
 	return &gauge_messages.Empty{}, nil
 }
 
-// Implementing remaining Reporter interface methods
+// NotifySpecExecutionStarting records when and on which stream a spec started
 func (p *Plugin) NotifySpecExecutionStarting(ctx context.Context, info *gauge_messages.SpecExecutionStartingRequest) (*gauge_messages.Empty, error) {
+	spec := info.GetCurrentExecutionInfo().GetCurrentSpec()
+	p.timeline.SpecStarting(int(info.GetStream()), spec.GetFileName(), spec.GetName())
 	return &gauge_messages.Empty{}, nil
 }
 
+// NotifySpecExecutionEnding records when a spec finished
 func (p *Plugin) NotifySpecExecutionEnding(ctx context.Context, result *gauge_messages.SpecExecutionEndingRequest) (*gauge_messages.Empty, error) {
+	spec := result.GetCurrentExecutionInfo().GetCurrentSpec()
+	p.timeline.SpecEnding(int(result.GetStream()), spec.GetFileName(), spec.GetName(),
+		result.GetSpecResult().GetFailed(), result.GetSpecResult().GetSkipped())
 	return &gauge_messages.Empty{}, nil
 }
 
+// Implementing remaining Reporter interface methods
 func (p *Plugin) NotifyScenarioExecutionStarting(ctx context.Context, info *gauge_messages.ScenarioExecutionStartingRequest) (*gauge_messages.Empty, error) {
 	return &gauge_messages.Empty{}, nil
 }
@@ -188,7 +198,7 @@ func (p *Plugin) NotifySuiteResult(ctx context.Context, result *gauge_messages.S
 		}
 
 		// Build the HTML report
-		err := p.reportBuilder.BuildReport(result.GetSuiteResult())
+		err := p.reportBuilder.BuildReport(result.GetSuiteResult(), p.timeline.Spans())
 		if err != nil {
 			logger.Errorf("Failed to generate report: %v", err)
 			return &gauge_messages.Empty{}, err
@@ -0,0 +1,286 @@
+package quarantine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// diffContext is the number of unchanged lines around each change in a diff
+const diffContext = 3
+
+// Patch is a machine-readable change to a quarantine file, for a bot to
+// commit or open a pull request with
+type Patch struct {
+	File    string   `json:"file"`
+	Add     []*Entry `json:"add"`
+	Release []*Entry `json:"release"`
+	Diff    string   `json:"diff"` // unified diff, applies with git apply or patch -p1
+
+	Content []byte `json:"-"` // the file with the patch applied
+}
+
+// Empty reports whether the patch changes nothing
+func (p *Patch) Empty() bool {
+	return len(p.Add) == 0 && len(p.Release) == 0
+}
+
+// Patch turns suggestions into a change to the quarantine file at path, which
+// the list was loaded from. Added entries get owner and, when days > 0, expire
+// after that many days. Comments and the order of the remaining entries are
+// kept.
+func (l *List) Patch(path string, suggestions []*models.QuarantineSuggestion, owner string, days int, now time.Time) (*Patch, error) {
+	patch := &Patch{File: diffName(path), Add: make([]*Entry, 0), Release: make([]*Entry, 0)}
+	for _, suggestion := range suggestions {
+		spec := &models.SpecResult{SpecHeading: suggestion.SpecName, RelativePath: suggestion.SpecFile}
+		scenario := &models.ScenarioResult{ID: suggestion.ScenarioID, ScenarioHeading: suggestion.ScenarioName}
+
+		switch suggestion.Action {
+		case "add":
+			if l.Find(spec, scenario) != nil {
+				continue
+			}
+			entry := &Entry{
+				Scenario: suggestion.ScenarioName,
+				Spec:     suggestion.SpecFile,
+				Owner:    owner,
+				Reason:   suggestion.Reason,
+				Added:    now.Format(dateLayout),
+			}
+			if entry.Spec == "" {
+				entry.Spec = suggestion.SpecName
+			}
+			if days > 0 {
+				entry.Expires = now.AddDate(0, 0, days).Format(dateLayout)
+			}
+			patch.Add = append(patch.Add, entry)
+		case "release":
+			if entry := l.Find(spec, scenario); entry != nil && !containsEntry(patch.Release, entry) {
+				patch.Release = append(patch.Release, entry)
+			}
+		}
+	}
+
+	before, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+	if patch.Empty() {
+		patch.Content = before
+		return patch, nil
+	}
+
+	patch.Content, err = rewrite(before, patch.Add, patch.Release)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update quarantine file %s: %w", path, err)
+	}
+	patch.Diff = unifiedDiff(patch.File, before, patch.Content)
+	return patch, nil
+}
+
+// rewrite removes the released entries from a quarantine file and appends the
+// added ones, editing the YAML document tree so comments survive
+func rewrite(data []byte, add, release []*Entry) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	}
+
+	var entries *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "quarantine" {
+			entries = root.Content[i+1]
+		}
+	}
+	if entries == nil || entries.Kind != yaml.SequenceNode {
+		if entries == nil {
+			entries = &yaml.Node{}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "quarantine"}, entries)
+		}
+		*entries = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	entries.Style = 0 // block style, even if the list was written as []
+
+	kept := entries.Content[:0]
+	for _, node := range entries.Content {
+		var entry Entry
+		if err := node.Decode(&entry); err == nil && containsEntry(release, &entry) {
+			continue
+		}
+		kept = append(kept, node)
+	}
+	entries.Content = kept
+
+	for _, entry := range add {
+		var node yaml.Node
+		if err := node.Encode(entry); err != nil {
+			return nil, err
+		}
+		entries.Content = append(entries.Content, &node)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// containsEntry reports whether entries holds an entry equal to entry
+func containsEntry(entries []*Entry, entry *Entry) bool {
+	for _, e := range entries {
+		if *e == *entry {
+			return true
+		}
+	}
+	return false
+}
+
+// diffName is the path a diff of the file is written against: relative to
+// the working directory when possible, with forward slashes
+func diffName(path string) string {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// diffLine is one line of an edit script: ' ' kept, '-' removed or '+' added.
+// oldLine and newLine are the 0-based positions in both files before the line.
+type diffLine struct {
+	kind             byte
+	text             string
+	oldLine, newLine int
+}
+
+// unifiedDiff returns a unified diff from before to after of the file name.
+// The files are small, so a quadratic longest-common-subsequence is fine.
+func unifiedDiff(name string, before, after []byte) string {
+	a, b := splitLines(before), splitLines(after)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var script []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, diffLine{' ', a[i], i, j})
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			script = append(script, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	if len(before) == 0 {
+		out.WriteString("--- /dev/null\n")
+	} else {
+		fmt.Fprintf(&out, "--- a/%s\n", name)
+	}
+	fmt.Fprintf(&out, "+++ b/%s\n", name)
+
+	for start := 0; start < len(script); {
+		for start < len(script) && script[start].kind == ' ' {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+
+		// Extend the hunk while the next change is close enough to share context
+		last := start
+		for k := start; k < len(script) && k-last <= 2*diffContext; k++ {
+			if script[k].kind != ' ' {
+				last = k
+			}
+		}
+		from := max(0, start-diffContext)
+		to := min(len(script), last+diffContext+1)
+
+		oldCount, newCount := 0, 0
+		for _, line := range script[from:to] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(script[from].oldLine, oldCount), hunkRange(script[from].newLine, newCount))
+		for _, line := range script[from:to] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk; an empty range starts at
+// the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits data into lines that keep their newline
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,157 @@
+package quarantine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultFile is the quarantine list looked up in the Gauge project root
+const DefaultFile = "quarantine.yaml"
+
+// dateLayout is the format of the added and expires dates
+const dateLayout = "2006-01-02"
+
+// Entry quarantines one scenario. It matches on ID when set, otherwise on
+// heading and, when given, spec (file path relative to the project root, or
+// spec heading).
+type Entry struct {
+	Scenario string `yaml:"scenario" json:"scenario"`
+	Spec     string `yaml:"spec,omitempty" json:"spec,omitempty"`
+	ID       string `yaml:"id,omitempty" json:"id,omitempty"`
+	Owner    string `yaml:"owner" json:"owner"`
+	Reason   string `yaml:"reason" json:"reason"`
+	Added    string `yaml:"added,omitempty" json:"added,omitempty"`     // YYYY-MM-DD
+	Expires  string `yaml:"expires,omitempty" json:"expires,omitempty"` // YYYY-MM-DD, last day the entry applies
+}
+
+// List is the contents of a quarantine file
+type List struct {
+	Entries []*Entry `yaml:"quarantine" json:"quarantine"`
+}
+
+// Path resolves the quarantine file: file if set, relative to projectRoot
+// unless absolute, or DefaultFile in projectRoot
+func Path(file, projectRoot string) string {
+	if file == "" {
+		file = DefaultFile
+	}
+	if filepath.IsAbs(file) || projectRoot == "" {
+		return file
+	}
+	return filepath.Join(projectRoot, file)
+}
+
+// Load reads a quarantine file. A missing file is an empty list.
+func Load(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &List{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+
+	list := &List{}
+	if err := yaml.Unmarshal(data, list); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine file %s: %w", path, err)
+	}
+	for i, entry := range list.Entries {
+		if entry.Scenario == "" && entry.ID == "" {
+			return nil, fmt.Errorf("quarantine entry %d in %s names no scenario", i+1, path)
+		}
+		if _, err := entry.ExpiresOn(); err != nil {
+			return nil, fmt.Errorf("quarantine entry %d in %s: %w", i+1, path, err)
+		}
+	}
+	return list, nil
+}
+
+// ExpiresOn returns the last day the entry applies (UTC midnight), or the
+// zero time if it does not expire
+func (e *Entry) ExpiresOn() (time.Time, error) {
+	if e.Expires == "" {
+		return time.Time{}, nil
+	}
+	day, err := time.Parse(dateLayout, e.Expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expires date %q, want YYYY-MM-DD", e.Expires)
+	}
+	return day, nil
+}
+
+// Expired reports whether the entry's last day is over at now
+func (e *Entry) Expired(now time.Time) bool {
+	day, err := e.ExpiresOn()
+	return err == nil && !day.IsZero() && !now.Before(day.AddDate(0, 0, 1))
+}
+
+// OwnerOrUnknown returns the entry's owner, or "unknown" if none is given
+func (e *Entry) OwnerOrUnknown() string {
+	if e.Owner == "" {
+		return "unknown"
+	}
+	return e.Owner
+}
+
+// Matches reports whether the entry names the scenario
+func (e *Entry) Matches(spec *models.SpecResult, scenario *models.ScenarioResult) bool {
+	if e.ID != "" {
+		return e.ID == scenario.ID
+	}
+	if !strings.EqualFold(strings.TrimSpace(e.Scenario), strings.TrimSpace(scenario.ScenarioHeading)) {
+		return false
+	}
+	if e.Spec == "" {
+		return true
+	}
+	path := filepath.ToSlash(e.Spec)
+	return path == spec.RelativePath || path == filepath.ToSlash(spec.FileName) || e.Spec == spec.SpecHeading
+}
+
+// Find returns the first entry naming the scenario, expired or not
+func (l *List) Find(spec *models.SpecResult, scenario *models.ScenarioResult) *Entry {
+	for _, entry := range l.Entries {
+		if entry.Matches(spec, scenario) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Apply marks the suite's scenarios named by unexpired entries as quarantined,
+// recounting the suite if any were, and warns about expired entries that
+// still name a scenario of this run
+func (l *List) Apply(suite *models.EnhancedSuiteResult, now time.Time) {
+	quarantined := false
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			entry := l.Find(spec, scenario)
+			if entry == nil {
+				continue
+			}
+			if entry.Expired(now) {
+				suite.QuarantineWarnings = append(suite.QuarantineWarnings,
+					fmt.Sprintf("Quarantine of %q expired on %s (owner: %s); its failures count again",
+						scenario.ScenarioHeading, entry.Expires, entry.OwnerOrUnknown()))
+				continue
+			}
+			expires, _ := entry.ExpiresOn()
+			scenario.Quarantine = &models.Quarantine{
+				Owner:   entry.Owner,
+				Reason:  entry.Reason,
+				Expires: expires,
+			}
+			quarantined = true
+		}
+	}
+	if quarantined {
+		suite.CountScenarios()
+	}
+}
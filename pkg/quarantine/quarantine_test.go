@@ -0,0 +1,187 @@
+package quarantine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	list, err := Load(filepath.Join(dir, DefaultFile))
+	if err != nil || len(list.Entries) != 0 {
+		t.Fatalf("Expected an empty list for a missing file, got %+v (%v)", list, err)
+	}
+
+	path := filepath.Join(dir, DefaultFile)
+	if err := os.WriteFile(path, []byte("quarantine:\n  - scenario: Pay by card\n    expires: next week\n"), 0644); err != nil {
+		t.Fatalf("Failed to write quarantine file: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "invalid expires date") {
+		t.Errorf("Expected an invalid date error, got %v", err)
+	}
+
+	if got := Path("", "/project"); got != filepath.Join("/project", DefaultFile) {
+		t.Errorf("Expected the default file in the project root, got %s", got)
+	}
+	if got := Path("/etc/quarantine.yaml", "/project"); got != "/etc/quarantine.yaml" {
+		t.Errorf("Expected an absolute path to be kept, got %s", got)
+	}
+}
+
+func TestList_Apply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	content := `quarantine:
+  - scenario: Pay by card
+    spec: specs/checkout.spec
+    owner: payments-team
+    reason: Payment sandbox times out
+    expires: 2026-11-30
+  - scenario: Pay by voucher
+    owner: alice
+    reason: Voucher service flaky
+    expires: 2026-10-01
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write quarantine file: %v", err)
+	}
+	list, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load quarantine file: %v", err)
+	}
+
+	card := &models.ScenarioResult{ScenarioHeading: "Pay by card", Failed: true}
+	voucher := &models.ScenarioResult{ScenarioHeading: "Pay by voucher", Failed: true}
+	suite := &models.EnhancedSuiteResult{SpecResults: []*models.SpecResult{{
+		SpecHeading:  "Checkout",
+		FileName:     "/project/specs/checkout.spec",
+		RelativePath: "specs/checkout.spec",
+		Scenarios: []*models.ScenarioResult{
+			card, voucher, {ScenarioHeading: "Pay by cash"}, {ScenarioHeading: "Pay by cheque"},
+		},
+	}}}
+
+	list.Apply(suite, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+
+	if card.Quarantine == nil || card.Quarantine.Owner != "payments-team" || card.Quarantine.Expires.Format("2006-01-02") != "2026-11-30" {
+		t.Errorf("Expected 'Pay by card' to be quarantined until 2026-11-30, got %+v", card.Quarantine)
+	}
+	if voucher.Quarantine != nil {
+		t.Errorf("Expected the expired entry not to apply, got %+v", voucher.Quarantine)
+	}
+	if len(suite.QuarantineWarnings) != 1 || !strings.Contains(suite.QuarantineWarnings[0], "expired on 2026-10-01") {
+		t.Errorf("Expected one expiry warning, got %v", suite.QuarantineWarnings)
+	}
+
+	// 2 of the 3 counted scenarios passed; the quarantined failure is left out
+	if suite.QuarantinedScenariosCount != 1 || suite.QuarantinedFailuresCount != 1 || suite.FailedScenariosCount != 1 {
+		t.Errorf("Unexpected counts: %d quarantined, %d quarantined failures, %d failed",
+			suite.QuarantinedScenariosCount, suite.QuarantinedFailuresCount, suite.FailedScenariosCount)
+	}
+	if want := 200.0 / 3.0; fmt.Sprintf("%.2f", suite.SuccessRate) != fmt.Sprintf("%.2f", want) {
+		t.Errorf("Expected success rate %.2f, got %.2f", want, suite.SuccessRate)
+	}
+	if failures := suite.QuarantinedFailures(); len(failures) != 1 || failures[0].Scenario != card {
+		t.Errorf("Expected 'Pay by card' as the only quarantined failure, got %+v", failures)
+	}
+}
+
+func TestEntry_OwnerOrUnknown(t *testing.T) {
+	if owner := (&Entry{Owner: "alice"}).OwnerOrUnknown(); owner != "alice" {
+		t.Errorf("Expected alice, got %s", owner)
+	}
+	if owner := (&Entry{Scenario: "Pay by card"}).OwnerOrUnknown(); owner != "unknown" {
+		t.Errorf("Expected unknown, got %s", owner)
+	}
+}
+
+func TestList_Patch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	content := `# Owned by the QA guild; see CONTRIBUTING.md
+quarantine:
+  - scenario: Pay by card
+    owner: payments-team
+    reason: Payment sandbox times out
+  - scenario: Pay by voucher
+    owner: alice
+    reason: Voucher service flaky
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write quarantine file: %v", err)
+	}
+	list, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load quarantine file: %v", err)
+	}
+
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	patch, err := list.Patch(path, []*models.QuarantineSuggestion{
+		{Action: "add", SpecName: "Checkout", SpecFile: "specs/checkout.spec", ScenarioName: "Pay by gift card", Reason: "flaky score 0.80 over 5 runs"},
+		{Action: "add", ScenarioName: "Pay by voucher"}, // already quarantined
+		{Action: "release", ScenarioName: "Pay by card"},
+	}, "qa-bot", 30, now)
+	if err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+
+	if len(patch.Add) != 1 || patch.Add[0].Spec != "specs/checkout.spec" || patch.Add[0].Expires != "2026-11-17" {
+		t.Errorf("Expected one addition for the gift card expiring in 30 days, got %+v", patch.Add)
+	}
+	if len(patch.Release) != 1 || patch.Release[0].Scenario != "Pay by card" {
+		t.Errorf("Expected the card to be released, got %+v", patch.Release)
+	}
+
+	updated := string(patch.Content)
+	for _, want := range []string{"# Owned by the QA guild", "scenario: Pay by voucher", "scenario: Pay by gift card", "owner: qa-bot", "added: \"2026-10-18\""} {
+		if !strings.Contains(updated, want) {
+			t.Errorf("Expected the updated file to contain %q, got:\n%s", want, updated)
+		}
+	}
+	if strings.Contains(updated, "Pay by card") {
+		t.Errorf("Expected the released entry to be removed, got:\n%s", updated)
+	}
+
+	if !strings.HasPrefix(patch.Diff, "--- a/") || !strings.Contains(patch.Diff, "-  - scenario: Pay by card\n") ||
+		!strings.Contains(patch.Diff, "+  - scenario: Pay by gift card\n") {
+		t.Errorf("Expected a unified diff removing the card and adding the gift card, got:\n%s", patch.Diff)
+	}
+
+	// The patched file loads back with the same entries
+	if err := os.WriteFile(path, patch.Content, 0644); err != nil {
+		t.Fatalf("Failed to write patched file: %v", err)
+	}
+	reloaded, err := Load(path)
+	if err != nil || len(reloaded.Entries) != 2 {
+		t.Fatalf("Expected the patched file to hold 2 entries, got %+v (%v)", reloaded, err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk"
+	want := `--- a/q.yaml
++++ b/q.yaml
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+\ No newline at end of file
+`
+	if got := unifiedDiff("q.yaml", []byte(before), []byte(after)); got != want {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+}
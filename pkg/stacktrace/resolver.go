@@ -0,0 +1,143 @@
+package stacktrace
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// javaSourceRoots are where Java and Kotlin sources usually live; traces name
+// only the file, so the package gives the directory below one of these
+var javaSourceRoots = []string{"", "src/test/java", "src/main/java", "src/test/kotlin", "src/main/kotlin", "src"}
+
+// Resolver finds the first user frame of failures in the project's files
+// and links it to the source
+type Resolver struct {
+	root      string // absolute project root
+	sourceURL string // with {commit}, {path} and {line} placeholders
+	commit    string
+	paths     map[string]string // frame file to project path, "" if not found
+}
+
+// NewResolver creates a resolver for the project at projectRoot (the working
+// directory if empty). meta, if given, supplies the source link template and
+// the commit; without a template, frames link to the local file.
+func NewResolver(projectRoot string, meta *models.RunMetadata) *Resolver {
+	if projectRoot == "" {
+		projectRoot = "."
+	}
+	root, err := filepath.Abs(projectRoot)
+	if err != nil {
+		root = projectRoot
+	}
+	r := &Resolver{root: root, paths: make(map[string]string)}
+	if meta != nil {
+		r.sourceURL = meta.SourceURL
+		r.commit = meta.GitCommit
+	}
+	return r
+}
+
+// Annotate sets the first user frame of every failed step with a stack trace
+func (r *Resolver) Annotate(suite *models.EnhancedSuiteResult) {
+	for _, spec := range suite.SpecResults {
+		for _, scenario := range spec.Scenarios {
+			for _, step := range scenario.Steps {
+				if step.Failed && step.StackTrace != "" {
+					step.UserFrame = r.UserFrame(step.StackTrace)
+				}
+			}
+		}
+	}
+}
+
+// UserFrame parses a stack trace and returns its innermost frame in project
+// code with its project path and link, or nil
+func (r *Resolver) UserFrame(trace string) *models.StackFrame {
+	frame := FirstUserFrame(Parse(trace))
+	if frame == nil {
+		return nil
+	}
+	frame.Path = r.projectPath(frame)
+	frame.URL = r.link(frame)
+	return frame
+}
+
+// projectPath returns the frame's file relative to the project root, with
+// forward slashes, or "" if it is not in the project
+func (r *Resolver) projectPath(frame *models.StackFrame) string {
+	key := frame.Function + "\x00" + frame.File
+	if p, ok := r.paths[key]; ok {
+		return p
+	}
+
+	var found string
+	file := toSlash(frame.File)
+	switch {
+	case file == "":
+	case filepath.IsAbs(frame.File) || strings.HasPrefix(file, "/"):
+		if rel, err := filepath.Rel(r.root, filepath.FromSlash(file)); err == nil && !strings.HasPrefix(rel, "..") {
+			found = filepath.ToSlash(rel)
+		}
+	case !strings.Contains(file, "/") && (strings.HasSuffix(file, ".java") || strings.HasSuffix(file, ".kt")):
+		found = r.findJavaSource(frame.Function, file)
+	default:
+		if r.exists(file) {
+			found = path.Clean(file)
+		}
+	}
+
+	r.paths[key] = found
+	return found
+}
+
+// findJavaSource looks for a Java file under the package directory of the
+// frame's class in the usual source roots
+func (r *Resolver) findJavaSource(function, file string) string {
+	parts := strings.Split(function, ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	// Drop the method and the class; what is left is the package
+	dir := strings.Join(parts[:len(parts)-2], "/")
+	for _, sourceRoot := range javaSourceRoots {
+		candidate := path.Join(sourceRoot, dir, file)
+		if r.exists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// exists reports whether a project-relative path is a file
+func (r *Resolver) exists(rel string) bool {
+	info, err := os.Stat(filepath.Join(r.root, filepath.FromSlash(rel)))
+	return err == nil && !info.IsDir()
+}
+
+// link returns the URL of the frame's source line, or "" if the file is not
+// in the project
+func (r *Resolver) link(frame *models.StackFrame) string {
+	if frame.Path == "" {
+		return ""
+	}
+	if r.sourceURL == "" {
+		u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(r.root, filepath.FromSlash(frame.Path)))}
+		return u.String()
+	}
+
+	commit := r.commit
+	if commit == "" {
+		commit = "HEAD"
+	}
+	line := ""
+	if frame.Line > 0 {
+		line = strconv.Itoa(frame.Line)
+	}
+	return strings.NewReplacer("{commit}", commit, "{path}", frame.Path, "{line}", line).Replace(r.sourceURL)
+}
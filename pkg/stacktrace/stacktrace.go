@@ -0,0 +1,154 @@
+package stacktrace
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// Frame formats of the Gauge language runners. Each line of a trace is tried
+// against them in turn; lines matching none (messages, "Caused by:", "...
+// 12 more") are skipped.
+var (
+	// at com.example.Cart.total(Cart.java:42), at java.base/java.lang.Thread.run(Thread.java:833)
+	javaFrame = regexp.MustCompile(`^\s*at\s+(?:[\w.$]+/)?([\w.$<>]+)\(((?:[^():\s]+\.\w+)|Native Method|Unknown Source)(?::(\d+))?\)\s*$`)
+	// at Shop.Cart.Total() in C:\src\Shop\Cart.cs:line 42
+	csharpFrame = regexp.MustCompile(`^\s*at\s+(.+?)\s+in\s+(.+?):line\s+(\d+)\s*$`)
+	// at System.Threading.Tasks.Task.Execute()
+	csharpBareFrame = regexp.MustCompile("^\\s*at\\s+([\\w.`<>+\\[\\],]+)\\(.*\\)\\s*$")
+	// File "/project/step_impl/cart.py", line 42, in total
+	pythonFrame = regexp.MustCompile(`^\s*File "(.+?)", line (\d+)(?:, in (.+?))?\s*$`)
+	// at total (/project/tests/cart.js:42:7), at /project/tests/cart.js:42:7
+	jsFrame = regexp.MustCompile(`^\s*at\s+(?:(.+?)\s+\()?(.+?):(\d+):\d+\)?\s*$`)
+	// /project/step_implementation.rb:42:in `total', from cart.rb:42:in 'Cart#total'
+	rubyFrame = regexp.MustCompile("^\\s*(?:from\\s+)?(.+?\\.rb):(\\d+):in\\s+[`'](.+?)'")
+	// github.com/acme/shop.(*Cart).Total(0xc000010000)
+	goFunction = regexp.MustCompile(`^\s*((?:[\w.\-~]+/)*[\w.\-~]+\.[\w.()*\[\]{}$]+)\(.*\)\s*$`)
+	// 	/project/cart.go:42 +0x1d, Error Trace:	/project/cart_test.go:42
+	goFile = regexp.MustCompile(`^\s*(?:Error Trace:\s*)?(\S+\.go):(\d+)(?:\s+\+0x[0-9a-f]+)?\s*$`)
+)
+
+// Parse splits a stack trace into frames, innermost first. Python, which
+// prints the innermost frame last, is reversed to match the others.
+func Parse(trace string) []*models.StackFrame {
+	var frames, python []*models.StackFrame
+	var goFunc string // function line waiting for its file line
+
+	for _, line := range strings.Split(strings.ReplaceAll(trace, "\r\n", "\n"), "\n") {
+		if m := goFile.FindStringSubmatch(line); m != nil {
+			frames = append(frames, newFrame(goFunc, m[1], m[2], isGoFramework))
+			goFunc = ""
+			continue
+		}
+		goFunc = ""
+
+		switch {
+		case javaFrame.MatchString(line):
+			m := javaFrame.FindStringSubmatch(line)
+			file := m[2]
+			if file == "Native Method" || file == "Unknown Source" {
+				file = ""
+			}
+			frames = append(frames, newFrame(m[1], file, m[3], isJavaFramework))
+		case csharpFrame.MatchString(line):
+			m := csharpFrame.FindStringSubmatch(line)
+			frames = append(frames, newFrame(m[1], m[2], m[3], isCSharpFramework))
+		case pythonFrame.MatchString(line):
+			m := pythonFrame.FindStringSubmatch(line)
+			python = append(python, newFrame(m[3], m[1], m[2], isPythonFramework))
+		case jsFrame.MatchString(line):
+			m := jsFrame.FindStringSubmatch(line)
+			function := strings.TrimPrefix(strings.TrimPrefix(m[1], "async "), "new ")
+			frames = append(frames, newFrame(function, strings.TrimPrefix(m[2], "file://"), m[3], isJSFramework))
+		case csharpBareFrame.MatchString(line):
+			m := csharpBareFrame.FindStringSubmatch(line)
+			frames = append(frames, newFrame(m[1], "", "", isCSharpFramework))
+		case rubyFrame.MatchString(line):
+			m := rubyFrame.FindStringSubmatch(line)
+			frames = append(frames, newFrame(m[3], m[1], m[2], isRubyFramework))
+		case goFunction.MatchString(line):
+			goFunc = goFunction.FindStringSubmatch(line)[1]
+		}
+	}
+
+	for i := len(python) - 1; i >= 0; i-- {
+		frames = append(frames, python[i])
+	}
+	return frames
+}
+
+// FirstUserFrame returns the innermost frame in project code, or nil
+func FirstUserFrame(frames []*models.StackFrame) *models.StackFrame {
+	for _, frame := range frames {
+		if !frame.Framework {
+			return frame
+		}
+	}
+	return nil
+}
+
+// newFrame builds a frame and classifies it with the language's rule
+func newFrame(function, file, line string, framework func(function, file string) bool) *models.StackFrame {
+	frame := &models.StackFrame{Function: strings.TrimSpace(function), File: strings.TrimSpace(file)}
+	frame.Line, _ = strconv.Atoi(line)
+	frame.Framework = framework(frame.Function, frame.File)
+	return frame
+}
+
+func isJavaFramework(function, file string) bool {
+	return file == "" || hasAnyPrefix(function,
+		"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.", "scala.",
+		"org.junit.", "junit.", "org.testng.", "org.assertj.", "org.hamcrest.", "com.google.common.",
+		"org.openqa.selenium.", "com.codeborne.selenide.", "io.restassured.", "org.springframework.",
+		"com.thoughtworks.gauge.", "org.apache.", "net.bytebuddy.")
+}
+
+func isCSharpFramework(function, file string) bool {
+	return file == "" || hasAnyPrefix(function,
+		"System.", "Microsoft.", "NUnit.", "Xunit.", "FluentAssertions.", "OpenQA.Selenium.", "Gauge.", "Castle.")
+}
+
+func isPythonFramework(function, file string) bool {
+	return strings.HasPrefix(file, "<") || containsAny(toSlash(file),
+		"/site-packages/", "/dist-packages/", "/lib/python", "/getgauge/")
+}
+
+func isJSFramework(function, file string) bool {
+	return file == "" || strings.HasPrefix(file, "node:") || strings.HasPrefix(file, "internal/") ||
+		containsAny(toSlash(file), "/node_modules/", "<anonymous>")
+}
+
+func isRubyFramework(function, file string) bool {
+	return strings.HasPrefix(file, "<internal:") || containsAny(toSlash(file), "/gems/", "/rubygems/", "/lib/ruby/")
+}
+
+func isGoFramework(function, file string) bool {
+	return containsAny(toSlash(file), "/go/src/", "/pkg/mod/", "/libexec/src/") ||
+		hasAnyPrefix(function, "runtime.", "testing.", "reflect.", "github.com/getgauge/", "github.com/stretchr/testify/")
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, parts ...string) bool {
+	for _, part := range parts {
+		if strings.Contains(s, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// toSlash converts Windows separators, which runners on Windows print
+// whatever the platform the report is built on
+func toSlash(path string) string {
+	return strings.ReplaceAll(path, `\`, "/")
+}
@@ -0,0 +1,148 @@
+package stacktrace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+func TestParse_UserFrame(t *testing.T) {
+	tests := []struct {
+		language string
+		trace    string
+		frames   int
+		function string
+		file     string
+		line     int
+	}{
+		{
+			language: "java",
+			trace: `java.lang.AssertionError: expected:<5> but was:<1>
+	at org.junit.Assert.fail(Assert.java:89)
+	at org.junit.Assert.assertEquals(Assert.java:120)
+	at com.example.steps.CartSteps.verifyTotal(CartSteps.java:42)
+	at java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)
+	at com.thoughtworks.gauge.execution.MethodExecutor.execute(MethodExecutor.java:38)
+	... 12 more`,
+			frames: 5, function: "com.example.steps.CartSteps.verifyTotal", file: "CartSteps.java", line: 42,
+		},
+		{
+			language: "csharp",
+			trace: `   at NUnit.Framework.Assert.AreEqual(Object expected, Object actual)
+   at Shop.Specs.CartSteps.VerifyTotal(Int32 total) in C:\src\shop\Specs\CartSteps.cs:line 42
+   at System.RuntimeMethodHandle.InvokeMethod(Object target, Span` + "`" + `1& arguments)`,
+			frames: 3, function: "Shop.Specs.CartSteps.VerifyTotal(Int32 total)", file: `C:\src\shop\Specs\CartSteps.cs`, line: 42,
+		},
+		{
+			language: "python",
+			trace: `Traceback (most recent call last):
+  File "/usr/lib/python3.11/site-packages/getgauge/executor.py", line 30, in execute
+    step.impl(*params)
+  File "/project/step_impl/cart.py", line 42, in verify_total
+    assert total == expected
+  File "/project/step_impl/helpers.py", line 7, in check
+    raise AssertionError(msg)
+AssertionError: 1 != 5`,
+			frames: 3, function: "check", file: "/project/step_impl/helpers.py", line: 7,
+		},
+		{
+			language: "javascript",
+			trace: `AssertionError [ERR_ASSERTION]: 1 == 5
+    at Object.ok (node:assert:123:5)
+    at verifyTotal (/project/tests/step_implementation.js:42:10)
+    at async Promise.all (index 0)
+    at /project/node_modules/gauge-js/src/executor.js:20:7`,
+			frames: 3, function: "verifyTotal", file: "/project/tests/step_implementation.js", line: 42,
+		},
+		{
+			language: "ruby",
+			trace: `/usr/lib/ruby/gems/3.2.0/gems/rspec-expectations-3.12.0/lib/rspec/expectations/fail_with.rb:37:in ` + "`" + `fail_with'
+/project/step_implementations/cart.rb:42:in 'block in <top (required)>'
+	from /usr/lib/ruby/gems/3.2.0/gems/gauge-ruby-0.5.0/lib/executor.rb:20:in ` + "`" + `execute'`,
+			frames: 3, function: "block in <top (required)>", file: "/project/step_implementations/cart.rb", line: 42,
+		},
+		{
+			language: "go",
+			trace: `goroutine 7 [running]:
+runtime/debug.Stack()
+	/usr/local/go/src/runtime/debug/stack.go:24 +0x5e
+github.com/acme/shop/steps.(*Cart).VerifyTotal(0xc000010000, 0x5)
+	/project/steps/cart.go:42 +0x1d
+github.com/getgauge/gauge-go/gauge.execute(...)
+	/root/go/pkg/mod/github.com/getgauge/gauge-go@v0.3.0/gauge/gauge.go:80 +0x44`,
+			frames: 3, function: "github.com/acme/shop/steps.(*Cart).VerifyTotal", file: "/project/steps/cart.go", line: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			frames := Parse(tt.trace)
+			if len(frames) != tt.frames {
+				t.Fatalf("Expected %d frames, got %d: %+v", tt.frames, len(frames), frames)
+			}
+			frame := FirstUserFrame(frames)
+			if frame == nil {
+				t.Fatal("Expected a user frame")
+			}
+			if frame.Function != tt.function || frame.File != tt.file || frame.Line != tt.line {
+				t.Errorf("Expected %s at %s:%d, got %s at %s:%d",
+					tt.function, tt.file, tt.line, frame.Function, frame.File, frame.Line)
+			}
+		})
+	}
+
+	if frame := FirstUserFrame(Parse("Element not found")); frame != nil {
+		t.Errorf("Expected no frame in a plain message, got %+v", frame)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{"src/test/java/com/example/steps/CartSteps.java", "step_impl/cart.py"} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	meta := &models.RunMetadata{
+		GitCommit: "abc1234",
+		SourceURL: "https://github.com/acme/shop/blob/{commit}/{path}#L{line}",
+	}
+	resolver := NewResolver(root, meta)
+
+	// Java names only the file; the package finds it under a source root
+	frame := resolver.UserFrame("\tat com.example.steps.CartSteps.verifyTotal(CartSteps.java:42)")
+	if frame == nil || frame.Path != "src/test/java/com/example/steps/CartSteps.java" {
+		t.Fatalf("Expected the Java source to be found, got %+v", frame)
+	}
+	if frame.URL != "https://github.com/acme/shop/blob/abc1234/src/test/java/com/example/steps/CartSteps.java#L42" {
+		t.Errorf("Unexpected source URL: %s", frame.URL)
+	}
+	if frame.Location() != "src/test/java/com/example/steps/CartSteps.java:42" {
+		t.Errorf("Unexpected location: %s", frame.Location())
+	}
+
+	// Absolute paths under the project root become relative
+	trace := `  File "` + filepath.Join(root, "step_impl", "cart.py") + `", line 7, in check`
+	if frame := resolver.UserFrame(trace); frame == nil || frame.Path != "step_impl/cart.py" {
+		t.Errorf("Expected the Python file relative to the root, got %+v", frame)
+	}
+
+	// Files outside the project are shown but not linked
+	frame = resolver.UserFrame("    at verify (/elsewhere/steps.js:3:1)")
+	if frame == nil || frame.Path != "" || frame.URL != "" || frame.Location() != "/elsewhere/steps.js:3" {
+		t.Errorf("Expected an unlinked frame outside the project, got %+v", frame)
+	}
+
+	// Without a link template, frames link to the local file
+	local := NewResolver(root, nil).UserFrame(trace)
+	if local == nil || local.URL != "file://"+filepath.ToSlash(filepath.Join(root, "step_impl", "cart.py")) {
+		t.Errorf("Expected a file link, got %+v", local)
+	}
+}
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// ArchiveFormat identifies history archives in their manifest
+const ArchiveFormat = "gauge-history"
+
+// archiveManifestFile names the manifest entry of every archive
+const archiveManifestFile = "manifest.json"
+
+// archiveTable describes how a table is exported and merged on import
+type archiveTable struct {
+	name    string
+	columns []string // surrogate keys and created_at are not exported
+	// onConflict is appended to the INSERT on import; empty for plain inserts
+	onConflict string
+	// childOf names the column referencing executions; rows are only
+	// imported together with a newly imported execution
+	childOf string
+}
+
+// archiveTables lists the exported tables, parents before children
+var archiveTables = []archiveTable{
+	{
+		name: "executions",
+		columns: []string{
+			"id", "timestamp", "duration", "total_scenarios", "passed_scenarios",
+			"failed_scenarios", "skipped_scenarios", "success_rate", "environment",
+			"tags", "metadata", "build_number", "build_url", "branch", "git_commit",
+			"ci_agent", "project", "tag_filter",
+		},
+	},
+	{
+		name: "scenario_history",
+		columns: []string{
+			"execution_id", "scenario_name", "spec_name", "status", "duration",
+			"error_message", "stack_trace", "scenario_id", "spec_file", "line_start",
+			"row_index", "content", "retries",
+		},
+		childOf: "execution_id",
+	},
+	{
+		name:    "spec_history",
+		columns: []string{"execution_id", "spec_name", "spec_file", "status", "duration", "tags", "stream"},
+		childOf: "execution_id",
+	},
+	{
+		name:    "performance_metrics",
+		columns: []string{"execution_id", "step_text", "duration", "scenario_name", "spec_name"},
+		childOf: "execution_id",
+	},
+	{
+		name: "failure_patterns",
+		columns: []string{
+			"error_signature", "first_seen", "last_seen", "occurrence_count",
+			"classification", "ai_analysis", "pattern", "first_build", "first_commit",
+			"project", "environment", "tag_filter",
+		},
+		onConflict: `ON CONFLICT (error_signature, project, environment, tag_filter) DO UPDATE SET
+			first_build = CASE WHEN failure_patterns.first_seen IS NULL OR excluded.first_seen < failure_patterns.first_seen
+				THEN excluded.first_build ELSE failure_patterns.first_build END,
+			first_commit = CASE WHEN failure_patterns.first_seen IS NULL OR excluded.first_seen < failure_patterns.first_seen
+				THEN excluded.first_commit ELSE failure_patterns.first_commit END,
+			first_seen = CASE WHEN failure_patterns.first_seen IS NULL OR excluded.first_seen < failure_patterns.first_seen
+				THEN excluded.first_seen ELSE failure_patterns.first_seen END,
+			last_seen = CASE WHEN failure_patterns.last_seen IS NULL OR excluded.last_seen > failure_patterns.last_seen
+				THEN excluded.last_seen ELSE failure_patterns.last_seen END,
+			occurrence_count = CASE WHEN excluded.occurrence_count > failure_patterns.occurrence_count
+				THEN excluded.occurrence_count ELSE failure_patterns.occurrence_count END,
+			classification = COALESCE(NULLIF(failure_patterns.classification, ''), excluded.classification),
+			ai_analysis = COALESCE(NULLIF(failure_patterns.ai_analysis, ''), excluded.ai_analysis),
+			pattern = COALESCE(NULLIF(failure_patterns.pattern, ''), excluded.pattern)`,
+	},
+	{
+		name:       "scenario_aliases",
+		columns:    []string{"alias_id", "canonical_id"},
+		onConflict: `ON CONFLICT (alias_id) DO NOTHING`,
+	},
+	{
+		name: "daily_aggregates",
+		columns: []string{
+			"day", "project", "environment", "tag_filter", "runs", "total_scenarios",
+			"passed_scenarios", "failed_scenarios", "skipped_scenarios", "total_duration",
+		},
+		onConflict: `ON CONFLICT (day, project, environment, tag_filter) DO NOTHING`,
+	},
+}
+
+// ArchiveManifest describes an exported history archive
+type ArchiveManifest struct {
+	Format        string         `json:"format"`
+	SchemaVersion int            `json:"schemaVersion"`
+	ExportedAt    time.Time      `json:"exportedAt"`
+	Backend       string         `json:"backend"`
+	Tables        map[string]int `json:"tables"` // rows per table
+}
+
+// ImportResult summarises an import
+type ImportResult struct {
+	SchemaVersion     int            `json:"schemaVersion"`
+	Imported          map[string]int `json:"imported"`          // rows written per table
+	SkippedExecutions int            `json:"skippedExecutions"` // already present
+}
+
+// Export writes the whole history as a zip archive holding one JSON-lines
+// file per table and a manifest with the schema version
+func (d *Database) Export(w io.Writer) (*ArchiveManifest, error) {
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ArchiveManifest{
+		Format:        ArchiveFormat,
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC(),
+		Backend:       d.Backend(),
+		Tables:        make(map[string]int),
+	}
+
+	archive := zip.NewWriter(w)
+	for _, table := range archiveTables {
+		entry, err := createEntry(archive, table.name+".jsonl", manifest.ExportedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s entry: %w", table.name, err)
+		}
+		count, err := d.exportTable(table, entry)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Tables[table.name] = count
+	}
+
+	// The manifest goes last so it can carry row counts; readers find it by name
+	entry, err := createEntry(archive, archiveManifestFile, manifest.ExportedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest entry: %w", err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// createEntry adds a compressed file stamped with the export time
+func createEntry(archive *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
+
+// exportTable writes every row of table as one JSON object per line
+func (d *Database) exportTable(table archiveTable, w io.Writer) (int, error) {
+	rows, err := d.query(fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(table.columns, ", "), table.name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	values := make([]interface{}, len(table.columns))
+	targets := make([]interface{}, len(table.columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return count, fmt.Errorf("failed to scan %s: %w", table.name, err)
+		}
+		row := make(map[string]interface{}, len(table.columns))
+		for i, column := range table.columns {
+			value := values[i]
+			switch v := value.(type) {
+			case []byte:
+				value = string(v)
+			case time.Time:
+				value = v.UTC().Format(time.RFC3339Nano)
+			}
+			row[column] = value
+		}
+		if err := encoder.Encode(row); err != nil {
+			return count, fmt.Errorf("failed to write %s: %w", table.name, err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+
+	return count, buffered.Flush()
+}
+
+// Import merges an archive written by Export into this database in one
+// transaction. Executions already present (by ID) are skipped together with
+// their scenario and step records; failure patterns are merged by signature.
+func (d *Database) Import(r io.ReaderAt, size int64) (*ImportResult, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	entries := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		entries[file.Name] = file
+	}
+
+	manifest, err := readManifest(entries[archiveManifestFile])
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > LatestSchemaVersion() {
+		return nil, fmt.Errorf("%w: archive has version %d, this plugin supports up to %d",
+			ErrSchemaTooNew, manifest.SchemaVersion, LatestSchemaVersion())
+	}
+
+	existing, err := d.executionIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	result := &ImportResult{SchemaVersion: manifest.SchemaVersion, Imported: make(map[string]int)}
+	imported := make(map[string]bool) // executions added by this import
+
+	for _, table := range archiveTables {
+		file, ok := entries[table.name+".jsonl"]
+		if !ok {
+			continue // Older archives lack newer tables
+		}
+		err := readJSONLines(file, func(row map[string]interface{}) error {
+			switch {
+			case table.name == "executions":
+				id := fmt.Sprint(row["id"])
+				if existing[id] || imported[id] {
+					result.SkippedExecutions++
+					return nil
+				}
+				imported[id] = true
+			case table.childOf != "":
+				if !imported[fmt.Sprint(row[table.childOf])] {
+					return nil
+				}
+			}
+
+			if err := d.insertRow(tx, table, row); err != nil {
+				return err
+			}
+			result.Imported[table.name]++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	logger.Infof("Imported %d executions (%d already present)", result.Imported["executions"], result.SkippedExecutions)
+	return result, nil
+}
+
+// insertRow inserts the known columns of row into table
+func (d *Database) insertRow(tx txExecer, table archiveTable, row map[string]interface{}) error {
+	var columns []string
+	var args []interface{}
+	for _, column := range table.columns {
+		if value, ok := row[column]; ok {
+			columns = append(columns, column)
+			args = append(args, value)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) %s`,
+		table.name, strings.Join(columns, ", "), placeholders(len(columns)), table.onConflict)
+	if _, err := tx.Exec(d.dialect.rebind(query), args...); err != nil {
+		return fmt.Errorf("failed to import %s row: %w", table.name, err)
+	}
+	return nil
+}
+
+// txExecer is the part of *sql.Tx used by insertRow
+type txExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// executionIDs returns the IDs of every stored execution
+func (d *Database) executionIDs() (map[string]bool, error) {
+	rows, err := d.query(`SELECT id FROM executions`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// readManifest decodes and validates the archive manifest
+func readManifest(file *zip.File) (*ArchiveManifest, error) {
+	if file == nil {
+		return nil, fmt.Errorf("not a history archive: %s is missing", archiveManifestFile)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var manifest ArchiveManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if manifest.Format != ArchiveFormat {
+		return nil, fmt.Errorf("not a history archive: format %q", manifest.Format)
+	}
+	return &manifest, nil
+}
+
+// readJSONLines calls fn for every JSON object in a JSON-lines archive entry.
+// Numbers are kept as json.Number so 64-bit integers survive.
+func readJSONLines(file *zip.File, fn func(row map[string]interface{}) error) error {
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file.Name, err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	for line := 1; ; line++ {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s line %d: %w", file.Name, line, err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
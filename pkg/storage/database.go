@@ -3,19 +3,22 @@ package storage
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	_ "github.com/lib/pq"
 	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// Database handles historical test execution data
+// Database handles historical test execution data on a SQL backend
 type Database struct {
-	db   *sql.DB
-	path string
+	db      *sql.DB
+	path    string
+	dialect *dialect
 }
 
 // ExecutionRecord represents a single test execution run
@@ -28,9 +31,16 @@ type ExecutionRecord struct {
 	FailedScenarios  int                    `json:"failedScenarios"`
 	SkippedScenarios int                    `json:"skippedScenarios"`
 	SuccessRate      float64                `json:"successRate"`
+	Project          string                 `json:"project,omitempty"`
 	Environment      string                 `json:"environment"`
+	TagFilter        string                 `json:"tagFilter,omitempty"`
 	Tags             []string               `json:"tags"`
 	Metadata         map[string]interface{} `json:"metadata"`
+	BuildNumber      string                 `json:"buildNumber,omitempty"`
+	BuildURL         string                 `json:"buildUrl,omitempty"`
+	Branch           string                 `json:"branch,omitempty"`
+	GitCommit        string                 `json:"gitCommit,omitempty"`
+	Agent            string                 `json:"agent,omitempty"`
 }
 
 // ScenarioRecord represents a single scenario execution
@@ -42,125 +52,90 @@ type ScenarioRecord struct {
 	Duration     int64  `json:"duration"`
 	ErrorMessage string `json:"errorMessage,omitempty"`
 	StackTrace   string `json:"stackTrace,omitempty"`
+
+	// Identity; empty for rows recorded before scenario IDs existed
+	ScenarioID string `json:"scenarioId,omitempty"`
+	SpecFile   string `json:"specFile,omitempty"`
+	LineStart  int    `json:"lineStart,omitempty"`
+	RowIndex   int    `json:"rowIndex,omitempty"`
+	Content    string `json:"content,omitempty"` // step texts, one per line
+
+	Retries int `json:"retries,omitempty"` // times Gauge retried the scenario in this run
 }
 
-// NewDatabase creates or opens the historical database
+// NewDatabase creates or opens the historical SQLite database under reportsDir
 func NewDatabase(reportsDir string) (*Database, error) {
-	historyDir := filepath.Join(reportsDir, ".gauge-history")
-	if err := os.MkdirAll(historyDir, 0755); err != nil {
+	return NewSQLiteDatabase(filepath.Join(reportsDir, ".gauge-history", "test-history.db"))
+}
+
+// NewSQLiteDatabase creates or opens a SQLite history database at dbPath
+func NewSQLiteDatabase(dbPath string) (*Database, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create history directory: %w", err)
 	}
 
-	dbPath := filepath.Join(historyDir, "test-history.db")
 	logger.Infof("Opening database at: %s", dbPath)
+	return openDatabase(sqliteDialect, dbPath, dbPath)
+}
+
+// NewPostgresDatabase connects to a shared PostgreSQL history database
+func NewPostgresDatabase(dsn string) (*Database, error) {
+	logger.Infof("Opening PostgreSQL database at: %s", redactDSN(dsn))
+	return openDatabase(postgresDialect, dsn, redactDSN(dsn))
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+// openDatabase connects with the given dialect and migrates the schema
+func openDatabase(dia *dialect, dsn, displayPath string) (*Database, error) {
+	db, err := sql.Open(dia.driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	database := &Database{
-		db:   db,
-		path: dbPath,
+		db:      db,
+		path:    displayPath,
+		dialect: dia,
 	}
 
 	// Run migrations
 	if err := database.migrate(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
 
-	logger.Infof("Database initialized successfully")
+	logger.Infof("Database initialized successfully (%s)", dia.name)
 	return database, nil
 }
 
-// migrate creates or updates the database schema
-func (d *Database) migrate() error {
-	migrations := []string{
-		// Executions table
-		`CREATE TABLE IF NOT EXISTS executions (
-			id TEXT PRIMARY KEY,
-			timestamp DATETIME NOT NULL,
-			duration INTEGER NOT NULL,
-			total_scenarios INTEGER,
-			passed_scenarios INTEGER,
-			failed_scenarios INTEGER,
-			skipped_scenarios INTEGER,
-			success_rate REAL,
-			environment TEXT,
-			tags TEXT,
-			metadata TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Index for timestamp queries
-		`CREATE INDEX IF NOT EXISTS idx_execution_timestamp 
-		 ON executions(timestamp DESC)`,
-
-		// Scenario history table
-		`CREATE TABLE IF NOT EXISTS scenario_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			execution_id TEXT NOT NULL,
-			scenario_name TEXT NOT NULL,
-			spec_name TEXT NOT NULL,
-			status TEXT NOT NULL,
-			duration INTEGER,
-			error_message TEXT,
-			stack_trace TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (execution_id) REFERENCES executions(id)
-		)`,
-
-		// Indexes for scenario queries
-		`CREATE INDEX IF NOT EXISTS idx_scenario_name 
-		 ON scenario_history(scenario_name)`,
-
-		`CREATE INDEX IF NOT EXISTS idx_scenario_execution 
-		 ON scenario_history(execution_id)`,
-
-		// Failure patterns table for grouping
-		`CREATE TABLE IF NOT EXISTS failure_patterns (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			error_signature TEXT NOT NULL UNIQUE,
-			first_seen DATETIME,
-			last_seen DATETIME,
-			occurrence_count INTEGER DEFAULT 1,
-			classification TEXT,
-			ai_analysis TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE INDEX IF NOT EXISTS idx_error_signature 
-		 ON failure_patterns(error_signature)`,
-
-		// Performance metrics table
-		`CREATE TABLE IF NOT EXISTS performance_metrics (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			execution_id TEXT NOT NULL,
-			step_text TEXT NOT NULL,
-			duration INTEGER NOT NULL,
-			scenario_name TEXT,
-			spec_name TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (execution_id) REFERENCES executions(id)
-		)`,
-
-		`CREATE INDEX IF NOT EXISTS idx_step_performance 
-		 ON performance_metrics(step_text, duration)`,
-	}
+// Backend returns the name of the SQL backend ("sqlite" or "postgres")
+func (d *Database) Backend() string {
+	return d.dialect.name
+}
 
-	for i, migration := range migrations {
-		if _, err := d.db.Exec(migration); err != nil {
-			return fmt.Errorf("migration %d failed: %w", i, err)
-		}
-	}
+// exec runs a statement written with '?' placeholders
+func (d *Database) exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.db.Exec(d.dialect.rebind(query), args...)
+}
 
-	logger.Infof("Database migrations completed")
-	return nil
+// query runs a query written with '?' placeholders
+func (d *Database) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.Query(d.dialect.rebind(query), args...)
+}
+
+// queryRow runs a single-row query written with '?' placeholders
+func (d *Database) queryRow(query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRow(d.dialect.rebind(query), args...)
+}
+
+// cutoff returns the timestamp parameter for "the last N days" filters
+func cutoff(days int) string {
+	return time.Now().UTC().AddDate(0, 0, -days).Format(time.RFC3339)
 }
 
 // SaveExecution saves an execution record to the database
@@ -169,8 +144,10 @@ func (d *Database) SaveExecution(exec *ExecutionRecord) error {
 		INSERT INTO executions (
 			id, timestamp, duration, total_scenarios,
 			passed_scenarios, failed_scenarios, skipped_scenarios,
-			success_rate, environment, tags, metadata
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			success_rate, environment, tags, metadata,
+			build_number, build_url, branch, git_commit, ci_agent,
+			project, tag_filter
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	tagsJSON, err := json.Marshal(exec.Tags)
@@ -182,9 +159,9 @@ func (d *Database) SaveExecution(exec *ExecutionRecord) error {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	_, err = d.db.Exec(query,
+	_, err = d.exec(query,
 		exec.ID,
-		exec.Timestamp.Format(time.RFC3339),
+		exec.Timestamp.UTC().Format(time.RFC3339),
 		exec.Duration,
 		exec.TotalScenarios,
 		exec.PassedScenarios,
@@ -194,6 +171,13 @@ func (d *Database) SaveExecution(exec *ExecutionRecord) error {
 		exec.Environment,
 		string(tagsJSON),
 		string(metadataJSON),
+		exec.BuildNumber,
+		exec.BuildURL,
+		exec.Branch,
+		exec.GitCommit,
+		exec.Agent,
+		nullIfEmpty(exec.Project),
+		exec.TagFilter,
 	)
 
 	if err != nil {
@@ -209,11 +193,12 @@ func (d *Database) SaveScenario(scenario *ScenarioRecord) error {
 	query := `
 		INSERT INTO scenario_history (
 			execution_id, scenario_name, spec_name, status,
-			duration, error_message, stack_trace
-		) VALUES (?, ?, ?, ?, ?, ?, ?)
+			duration, error_message, stack_trace,
+			scenario_id, spec_file, line_start, row_index, content, retries
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := d.db.Exec(query,
+	_, err := d.exec(query,
 		scenario.ExecutionID,
 		scenario.ScenarioName,
 		scenario.SpecName,
@@ -221,24 +206,90 @@ func (d *Database) SaveScenario(scenario *ScenarioRecord) error {
 		scenario.Duration,
 		scenario.ErrorMessage,
 		scenario.StackTrace,
+		nullIfEmpty(scenario.ScenarioID),
+		scenario.SpecFile,
+		scenario.LineStart,
+		scenario.RowIndex,
+		scenario.Content,
+		scenario.Retries,
 	)
 
 	return err
 }
 
-// GetRecentExecutions retrieves the last N executions
-func (d *Database) GetRecentExecutions(limit int) ([]ExecutionRecord, error) {
+// executionColumns selects every ExecutionRecord field from executions aliased e,
+// in the order scanExecution reads them
+const executionColumns = `
+	e.id, e.timestamp, e.duration, e.total_scenarios,
+	e.passed_scenarios, e.failed_scenarios, e.skipped_scenarios,
+	e.success_rate, e.environment, e.tags, e.metadata,
+	COALESCE(e.build_number, ''), COALESCE(e.build_url, ''), COALESCE(e.branch, ''),
+	COALESCE(e.git_commit, ''), COALESCE(e.ci_agent, ''),
+	COALESCE(e.project, ''), COALESCE(e.tag_filter, '')`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanExecution reads one row selected with executionColumns
+func scanExecution(row rowScanner) (ExecutionRecord, error) {
+	var exec ExecutionRecord
+	var timestamp string
+	var tagsJSON, metadataJSON string
+
+	err := row.Scan(
+		&exec.ID,
+		&timestamp,
+		&exec.Duration,
+		&exec.TotalScenarios,
+		&exec.PassedScenarios,
+		&exec.FailedScenarios,
+		&exec.SkippedScenarios,
+		&exec.SuccessRate,
+		&exec.Environment,
+		&tagsJSON,
+		&metadataJSON,
+		&exec.BuildNumber,
+		&exec.BuildURL,
+		&exec.Branch,
+		&exec.GitCommit,
+		&exec.Agent,
+		&exec.Project,
+		&exec.TagFilter,
+	)
+	if err != nil {
+		return exec, err
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return exec, fmt.Errorf("failed to parse timestamp %s: %w", timestamp, err)
+	}
+	exec.Timestamp = parsedTime
+
+	if err := json.Unmarshal([]byte(tagsJSON), &exec.Tags); err != nil {
+		logger.Warnf("Failed to unmarshal tags: %v", err)
+	}
+	if err := json.Unmarshal([]byte(metadataJSON), &exec.Metadata); err != nil {
+		logger.Warnf("Failed to unmarshal metadata: %v", err)
+	}
+
+	return exec, nil
+}
+
+// GetRecentExecutions retrieves the last N executions of a partition
+func (d *Database) GetRecentExecutions(partition Partition, limit int) ([]ExecutionRecord, error) {
+	filter, args := partition.filter("e")
 	query := `
-		SELECT 
-			id, timestamp, duration, total_scenarios,
-			passed_scenarios, failed_scenarios, skipped_scenarios,
-			success_rate, environment, tags, metadata
-		FROM executions
-		ORDER BY timestamp DESC
+		SELECT ` + executionColumns + `
+		FROM executions e
+		WHERE 1 = 1` + filter + `
+		ORDER BY e.timestamp DESC
 		LIMIT ?
 	`
 
-	rows, err := d.db.Query(query, limit)
+	rows, err := d.query(query, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -250,61 +301,72 @@ func (d *Database) GetRecentExecutions(limit int) ([]ExecutionRecord, error) {
 
 	var executions []ExecutionRecord
 	for rows.Next() {
-		var exec ExecutionRecord
-		var timestamp string
-		var tagsJSON, metadataJSON string
-
-		err := rows.Scan(
-			&exec.ID,
-			&timestamp,
-			&exec.Duration,
-			&exec.TotalScenarios,
-			&exec.PassedScenarios,
-			&exec.FailedScenarios,
-			&exec.SkippedScenarios,
-			&exec.SuccessRate,
-			&exec.Environment,
-			&tagsJSON,
-			&metadataJSON,
-		)
+		exec, err := scanExecution(rows)
 		if err != nil {
+			logger.Warnf("Skipping execution record: %v", err)
 			continue
 		}
-
-		parsedTime, err := time.Parse(time.RFC3339, timestamp)
-		if err != nil {
-			logger.Warnf("Failed to parse timestamp %s: %v", timestamp, err)
-			continue
-		}
-		exec.Timestamp = parsedTime
-
-		if err := json.Unmarshal([]byte(tagsJSON), &exec.Tags); err != nil {
-			logger.Warnf("Failed to unmarshal tags: %v", err)
-		}
-		if err := json.Unmarshal([]byte(metadataJSON), &exec.Metadata); err != nil {
-			logger.Warnf("Failed to unmarshal metadata: %v", err)
-		}
-
 		executions = append(executions, exec)
 	}
 
 	return executions, nil
 }
 
+// GetExecution retrieves one execution by ID, or nil if it does not exist
+func (d *Database) GetExecution(id string) (*ExecutionRecord, error) {
+	exec, err := scanExecution(d.queryRow(`SELECT `+executionColumns+` FROM executions e WHERE e.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exec, nil
+}
+
+// scenarioColumns selects every ScenarioRecord field from scenario_history
+// aliased sh, in the order of ScenarioRecord.scanTargets
+const scenarioColumns = `
+	sh.execution_id, sh.scenario_name, sh.spec_name,
+	sh.status, COALESCE(sh.duration, 0), COALESCE(sh.error_message, ''), COALESCE(sh.stack_trace, ''),
+	COALESCE(sh.scenario_id, ''), COALESCE(sh.spec_file, ''),
+	COALESCE(sh.line_start, 0), COALESCE(sh.row_index, 0), COALESCE(sh.content, ''),
+	COALESCE(sh.retries, 0)`
+
+// scanTargets returns the scan destinations matching scenarioColumns
+func (s *ScenarioRecord) scanTargets() []interface{} {
+	return []interface{}{
+		&s.ExecutionID,
+		&s.ScenarioName,
+		&s.SpecName,
+		&s.Status,
+		&s.Duration,
+		&s.ErrorMessage,
+		&s.StackTrace,
+		&s.ScenarioID,
+		&s.SpecFile,
+		&s.LineStart,
+		&s.RowIndex,
+		&s.Content,
+		&s.Retries,
+	}
+}
+
 // GetScenarioHistory retrieves historical data for a specific scenario
-func (d *Database) GetScenarioHistory(scenarioName string, days int) ([]ScenarioRecord, error) {
+func (d *Database) GetScenarioHistory(key ScenarioKey, partition Partition, days int) ([]ScenarioRecord, error) {
+	filter, args := key.filter()
+	scope, scopeArgs := partition.filter("e")
 	query := `
-		SELECT 
-			sh.execution_id, sh.scenario_name, sh.spec_name,
-			sh.status, sh.duration, sh.error_message, sh.stack_trace
+		SELECT ` + scenarioColumns + `
 		FROM scenario_history sh
 		JOIN executions e ON sh.execution_id = e.id
-		WHERE sh.scenario_name = ?
-		AND e.timestamp >= datetime('now', '-' || ? || ' days')
+		WHERE ` + filter + scope + `
+		AND e.timestamp >= ?
 		ORDER BY e.timestamp DESC
 	`
 
-	rows, err := d.db.Query(query, scenarioName, days)
+	args = append(args, scopeArgs...)
+	rows, err := d.query(query, append(args, cutoff(days))...)
 	if err != nil {
 		return nil, err
 	}
@@ -317,16 +379,7 @@ func (d *Database) GetScenarioHistory(scenarioName string, days int) ([]Scenario
 	var scenarios []ScenarioRecord
 	for rows.Next() {
 		var scenario ScenarioRecord
-		err := rows.Scan(
-			&scenario.ExecutionID,
-			&scenario.ScenarioName,
-			&scenario.SpecName,
-			&scenario.Status,
-			&scenario.Duration,
-			&scenario.ErrorMessage,
-			&scenario.StackTrace,
-		)
-		if err != nil {
+		if err := rows.Scan(scenario.scanTargets()...); err != nil {
 			continue
 		}
 		scenarios = append(scenarios, scenario)
@@ -336,59 +389,38 @@ func (d *Database) GetScenarioHistory(scenarioName string, days int) ([]Scenario
 }
 
 // CalculateFlakyScore calculates how flaky a scenario is (0.0 = stable, 1.0 = very flaky)
-func (d *Database) CalculateFlakyScore(scenarioName string, days int) (float64, error) {
-	query := `
-		SELECT 
-			COUNT(*) as total_runs,
-			SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_runs
-		FROM scenario_history sh
-		JOIN executions e ON sh.execution_id = e.id
-		WHERE sh.scenario_name = ?
-		AND e.timestamp >= datetime('now', '-' || ? || ' days')
-	`
-
-	var totalRuns, failedRuns int
-	err := d.db.QueryRow(query, scenarioName, days).Scan(&totalRuns, &failedRuns)
+// from its ordered run sequence; see AssessFlakiness
+func (d *Database) CalculateFlakyScore(key ScenarioKey, partition Partition, days int) (float64, error) {
+	runs, err := d.GetScenarioRunsByKey(key, partition, days)
 	if err != nil {
 		return 0.0, err
 	}
-
-	if totalRuns < 3 {
-		return 0.0, nil // Not enough data
-	}
-
-	failureRate := float64(failedRuns) / float64(totalRuns)
-
-	// Flaky score is highest when failure rate is around 50%
-	// Scale: 0% or 100% failure = 0.0 (stable), 50% failure = 1.0 (very flaky)
-	flakyScore := 1.0 - (2.0 * abs(failureRate-0.5))
-
-	return flakyScore, nil
+	return AssessFlakiness(runs).Score, nil
 }
 
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-// GetTrendData retrieves trend data for the last N days
-func (d *Database) GetTrendData(days int) ([]TrendPoint, error) {
+// GetTrendData retrieves trend data of a partition for the last N days
+func (d *Database) GetTrendData(partition Partition, days int) ([]TrendPoint, error) {
+	filter, args := partition.filter("e")
 	query := `
 		SELECT 
-			timestamp,
-			success_rate,
-			duration,
-			total_scenarios,
-			passed_scenarios,
-			failed_scenarios
-		FROM executions
-		WHERE timestamp >= datetime('now', '-' || ? || ' days')
-		ORDER BY timestamp ASC
+			e.timestamp,
+			e.success_rate,
+			e.duration,
+			e.total_scenarios,
+			e.passed_scenarios,
+			e.failed_scenarios,
+			e.skipped_scenarios,
+			COALESCE(e.build_number, ''),
+			COALESCE(e.build_url, ''),
+			COALESCE(e.branch, ''),
+			COALESCE(e.git_commit, ''),
+			COALESCE(e.ci_agent, '')
+		FROM executions e
+		WHERE e.timestamp >= ?` + filter + `
+		ORDER BY e.timestamp ASC
 	`
 
-	rows, err := d.db.Query(query, days)
+	rows, err := d.query(query, append([]interface{}{cutoff(days)}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -410,6 +442,12 @@ func (d *Database) GetTrendData(days int) ([]TrendPoint, error) {
 			&tp.Total,
 			&tp.Passed,
 			&tp.Failed,
+			&tp.Skipped,
+			&tp.BuildNumber,
+			&tp.BuildURL,
+			&tp.Branch,
+			&tp.GitCommit,
+			&tp.Agent,
 		)
 		if err != nil {
 			continue
@@ -435,33 +473,12 @@ type TrendPoint struct {
 	Total       int       `json:"total"`
 	Passed      int       `json:"passed"`
 	Failed      int       `json:"failed"`
-}
-
-// CleanupOldData removes data older than specified days
-func (d *Database) CleanupOldData(retentionDays int) error {
-	tables := []string{"scenario_history", "performance_metrics", "executions"}
-
-	for _, table := range tables {
-		query := fmt.Sprintf(`
-			DELETE FROM %s 
-			WHERE created_at < datetime('now', '-' || ? || ' days')
-		`, table)
-
-		result, err := d.db.Exec(query, retentionDays)
-		if err != nil {
-			logger.Warnf("Failed to cleanup %s: %v", table, err)
-			continue
-		}
-
-		rows, err := result.RowsAffected()
-		if err != nil {
-			logger.Warnf("Failed to get rows affected for %s: %v", table, err)
-			continue
-		}
-		logger.Infof("Cleaned up %d old records from %s", rows, table)
-	}
-
-	return nil
+	Skipped     int       `json:"skipped"`
+	BuildNumber string    `json:"buildNumber,omitempty"`
+	BuildURL    string    `json:"buildUrl,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	GitCommit   string    `json:"gitCommit,omitempty"`
+	Agent       string    `json:"agent,omitempty"`
 }
 
 // Close closes the database connection
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestNewDatabase_AppliesMigrations(t *testing.T) {
+	db := newTestDatabase(t)
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(), version)
+	}
+}
+
+func TestNewDatabase_ReopenIsIdempotent(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := first.SaveExecution(&ExecutionRecord{ID: "exec-1", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to save execution: %v", err)
+	}
+	_ = first.Close()
+
+	second, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer func() {
+		_ = second.Close()
+	}()
+
+	var applied int
+	if err := second.db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&applied); err != nil {
+		t.Fatalf("Failed to count schema versions: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("Expected %d recorded migrations, got %d", len(migrations), applied)
+	}
+
+	executions, err := second.GetRecentExecutions(Partition{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to read executions: %v", err)
+	}
+	if len(executions) != 1 {
+		t.Errorf("Expected existing execution to survive reopen, got %d", len(executions))
+	}
+}
+
+func TestNewDatabase_UpgradesUnversionedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, ".gauge-history", "test-history.db")
+
+	// Simulate a database created before schema versioning existed:
+	// the original tables, with no schema_version table
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Failed to create history directory: %v", err)
+	}
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open raw database: %v", err)
+	}
+	for _, stmt := range migrations[0].statements {
+		if _, err := raw.Exec(stmt); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+	if _, err := raw.Exec(`INSERT INTO executions (
+		id, timestamp, duration, total_scenarios, passed_scenarios, failed_scenarios,
+		skipped_scenarios, success_rate, environment, tags, metadata
+	) VALUES ('legacy', '2025-01-01T00:00:00Z', 1, 1, 1, 0, 0, 100, 'default', '[]', '{}')`); err != nil {
+		t.Fatalf("Failed to insert legacy execution: %v", err)
+	}
+	if _, err := raw.Exec(`INSERT INTO failure_patterns (
+		error_signature, first_seen, last_seen, occurrence_count, classification
+	) VALUES ('legacy-sig', '2025-01-01T00:00:00Z', '2025-01-01T00:00:00Z', 3, 'Timeout')`); err != nil {
+		t.Fatalf("Failed to insert legacy failure pattern: %v", err)
+	}
+	_ = raw.Close()
+
+	db, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("Expected unversioned database to upgrade, got %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(), version)
+	}
+
+	executions, err := db.GetRecentExecutions(Partition{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to read executions: %v", err)
+	}
+	if len(executions) != 1 || executions[0].ID != "legacy" {
+		t.Errorf("Expected legacy execution to survive the upgrade, got %+v", executions)
+	}
+	pattern, err := db.GetFailurePattern(Partition{Project: "shop", Environment: "default"}, "legacy-sig")
+	if err != nil || pattern == nil || pattern.Occurrences != 3 {
+		t.Errorf("Expected the legacy failure pattern to survive the upgrade, got %+v (%v)", pattern, err)
+	}
+}
+
+func TestNewDatabase_RefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := db.db.Exec(
+		`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+		LatestSchemaVersion()+1, "from the future", time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		t.Fatalf("Failed to insert future version: %v", err)
+	}
+	_ = db.Close()
+
+	_, err = NewDatabase(dir)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
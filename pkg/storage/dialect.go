@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dialect captures the SQL differences between supported backends.
+// Queries are written once with '?' placeholders and SQLite DDL, then
+// translated for the active backend.
+type dialect struct {
+	name       string
+	driverName string
+	// numbered placeholders ($1, $2, ...) instead of '?'
+	numberedPlaceholders bool
+	// DDL fragments to replace when creating the schema
+	ddlReplacements []string
+	// statement run inside each migration transaction to serialize migrators
+	migrationLock string
+}
+
+var (
+	sqliteDialect = &dialect{
+		name:       "sqlite",
+		driverName: "sqlite3",
+	}
+
+	postgresDialect = &dialect{
+		name:                 "postgres",
+		driverName:           "postgres",
+		numberedPlaceholders: true,
+		ddlReplacements: []string{
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+			"DATETIME", "TIMESTAMPTZ",
+			"REAL", "DOUBLE PRECISION",
+		},
+		migrationLock: "SELECT pg_advisory_xact_lock(7261840)",
+	}
+)
+
+// rebind converts '?' placeholders to the dialect's placeholder syntax
+func (d *dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			b.WriteByte(c)
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// translateDDL adapts a SQLite schema statement to the dialect
+func (d *dialect) translateDDL(stmt string) string {
+	if len(d.ddlReplacements) == 0 {
+		return stmt
+	}
+	return strings.NewReplacer(d.ddlReplacements...).Replace(stmt)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GetFailureEmbeddings returns the stored embedding vectors of the given
+// signatures for a model; signatures never embedded are left out
+func (d *Database) GetFailureEmbeddings(model string, signatures []string) (map[string][]float64, error) {
+	vectors := make(map[string][]float64)
+	if len(signatures) == 0 {
+		return vectors, nil
+	}
+
+	args := make([]interface{}, 0, len(signatures)+1)
+	args = append(args, model)
+	for _, signature := range signatures {
+		args = append(args, signature)
+	}
+	query := `
+		SELECT error_signature, vector
+		FROM failure_embeddings
+		WHERE model = ? AND error_signature IN (` + placeholders(len(signatures)) + `)
+	`
+
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failure embeddings: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var signature, vectorJSON string
+		if err := rows.Scan(&signature, &vectorJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan failure embedding: %w", err)
+		}
+		var vector []float64
+		if err := json.Unmarshal([]byte(vectorJSON), &vector); err != nil {
+			return nil, fmt.Errorf("failed to decode embedding of %s: %w", signature, err)
+		}
+		vectors[signature] = vector
+	}
+	return vectors, rows.Err()
+}
+
+// SaveFailureEmbeddings stores embedding vectors by signature for a model in
+// one transaction, replacing any stored ones
+func (d *Database) SaveFailureEmbeddings(model string, vectors map[string][]float64) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	stmt, err := tx.Prepare(d.dialect.rebind(`
+		INSERT INTO failure_embeddings (error_signature, model, vector)
+		VALUES (?, ?, ?)
+		ON CONFLICT (error_signature, model) DO UPDATE SET vector = excluded.vector
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare embedding insert: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for signature, vector := range vectors {
+		vectorJSON, err := json.Marshal(vector)
+		if err != nil {
+			return fmt.Errorf("failed to marshal embedding: %w", err)
+		}
+		if _, err := stmt.Exec(signature, model, string(vectorJSON)); err != nil {
+			return fmt.Errorf("failed to save failure embedding: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
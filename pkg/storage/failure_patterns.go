@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// FailurePattern is the cross-run record of one failure signature
+type FailurePattern struct {
+	Signature      string    `json:"signature"`
+	Pattern        string    `json:"pattern,omitempty"` // normalized error message
+	FirstSeen      time.Time `json:"firstSeen"`
+	FirstBuild     string    `json:"firstBuild,omitempty"`  // CI build of the first run with the signature
+	FirstCommit    string    `json:"firstCommit,omitempty"` // git commit of that run
+	LastSeen       time.Time `json:"lastSeen"`
+	Occurrences    int       `json:"occurrences"` // number of runs the signature appeared in
+	Classification string    `json:"classification"`
+	AIAnalysis     string    `json:"aiAnalysis,omitempty"`
+}
+
+// FailureSighting is a failure signature seen in one run
+type FailureSighting struct {
+	Signature      string
+	Pattern        string
+	Classification string
+	AIAnalysis     string    // LLM analysis; empty keeps the stored one
+	SeenAt         time.Time // run timestamp
+	BuildNumber    string
+	GitCommit      string
+}
+
+// failurePatternColumns are selected by every failure pattern query, in the
+// order scanFailurePattern reads them
+const failurePatternColumns = `error_signature, pattern, first_seen, first_build, first_commit,
+	last_seen, occurrence_count, classification, ai_analysis`
+
+// GetFailurePattern returns the stored pattern for a signature in a
+// partition, or nil if unseen. Patterns recorded before failure patterns were
+// partitioned belong to every partition, but the partition's own record of
+// the signature takes precedence.
+func (d *Database) GetFailurePattern(partition Partition, signature string) (*FailurePattern, error) {
+	query := `
+		SELECT ` + failurePatternColumns + `
+		FROM failure_patterns
+		WHERE error_signature = ?
+		  AND ((project = ? AND environment = ? AND tag_filter = ?)
+		    OR (project = '' AND environment = '' AND tag_filter = ''))
+		ORDER BY project DESC, environment DESC, tag_filter DESC
+		LIMIT 1
+	`
+
+	p, err := scanFailurePattern(d.queryRow(query, signature,
+		partition.Project, partition.Environment, partition.TagFilter))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failure pattern: %w", err)
+	}
+	return p, nil
+}
+
+// GetFailurePatternsFirstSeen returns the signatures that first appeared in
+// a partition in the run at firstSeen, that is the failures that run
+// introduced. Like GetFailurePattern, it includes patterns recorded before
+// partitioning that the partition has not taken over yet.
+func (d *Database) GetFailurePatternsFirstSeen(partition Partition, firstSeen time.Time) ([]FailurePattern, error) {
+	query := `
+		SELECT ` + failurePatternColumns + `
+		FROM failure_patterns fp
+		WHERE first_seen = ?
+		  AND ((project = ? AND environment = ? AND tag_filter = ?)
+		    OR (project = '' AND environment = '' AND tag_filter = ''
+		      AND NOT EXISTS (
+		        SELECT 1 FROM failure_patterns p
+		        WHERE p.error_signature = fp.error_signature
+		          AND p.project = ? AND p.environment = ? AND p.tag_filter = ?)))
+		ORDER BY error_signature
+	`
+
+	rows, err := d.query(query, firstSeen.UTC().Format(time.RFC3339),
+		partition.Project, partition.Environment, partition.TagFilter,
+		partition.Project, partition.Environment, partition.TagFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failure patterns: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var patterns []FailurePattern
+	for rows.Next() {
+		p, err := scanFailurePattern(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan failure pattern: %w", err)
+		}
+		patterns = append(patterns, *p)
+	}
+	return patterns, rows.Err()
+}
+
+// scanFailurePattern reads a row of failurePatternColumns
+func scanFailurePattern(row rowScanner) (*FailurePattern, error) {
+	var p FailurePattern
+	var pattern, firstSeen, firstBuild, firstCommit, lastSeen, classification, aiAnalysis sql.NullString
+	if err := row.Scan(
+		&p.Signature,
+		&pattern,
+		&firstSeen,
+		&firstBuild,
+		&firstCommit,
+		&lastSeen,
+		&p.Occurrences,
+		&classification,
+		&aiAnalysis,
+	); err != nil {
+		return nil, err
+	}
+
+	p.Pattern = pattern.String
+	p.FirstSeen = parseTimestamp(firstSeen.String)
+	p.FirstBuild = firstBuild.String
+	p.FirstCommit = firstCommit.String
+	p.LastSeen = parseTimestamp(lastSeen.String)
+	p.Classification = classification.String
+	p.AIAnalysis = aiAnalysis.String
+	return &p, nil
+}
+
+// RecordFailurePattern upserts a signature seen in a run of a partition,
+// incrementing its run count and moving last_seen forward (never back when an
+// older run is recorded late). The build and commit are kept from the first
+// run. A partition seeing a signature recorded before partitioning takes over
+// that record's history.
+func (d *Database) RecordFailurePattern(partition Partition, s FailureSighting) error {
+	adopt := `
+		INSERT INTO failure_patterns (
+			error_signature, project, environment, tag_filter, pattern, first_seen, first_build,
+			first_commit, last_seen, occurrence_count, classification, ai_analysis
+		)
+		SELECT error_signature, ?, ?, ?, pattern, first_seen, first_build,
+			first_commit, last_seen, occurrence_count, classification, ai_analysis
+		FROM failure_patterns
+		WHERE error_signature = ? AND project = '' AND environment = '' AND tag_filter = ''
+		ON CONFLICT (error_signature, project, environment, tag_filter) DO NOTHING
+	`
+	if _, err := d.exec(adopt, partition.Project, partition.Environment, partition.TagFilter, s.Signature); err != nil {
+		return fmt.Errorf("failed to record failure pattern: %w", err)
+	}
+
+	query := `
+		INSERT INTO failure_patterns (
+			error_signature, project, environment, tag_filter, pattern, first_seen,
+			first_build, first_commit, last_seen, occurrence_count, classification, ai_analysis
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT (error_signature, project, environment, tag_filter) DO UPDATE SET
+			last_seen = CASE WHEN excluded.last_seen > failure_patterns.last_seen
+				THEN excluded.last_seen ELSE failure_patterns.last_seen END,
+			occurrence_count = failure_patterns.occurrence_count + 1,
+			classification = excluded.classification,
+			ai_analysis = COALESCE(NULLIF(excluded.ai_analysis, ''), failure_patterns.ai_analysis),
+			pattern = COALESCE(NULLIF(failure_patterns.pattern, ''), excluded.pattern)
+	`
+
+	ts := s.SeenAt.UTC().Format(time.RFC3339)
+	if _, err := d.exec(query, s.Signature, partition.Project, partition.Environment, partition.TagFilter,
+		s.Pattern, ts, s.BuildNumber, s.GitCommit, ts, s.Classification, s.AIAnalysis); err != nil {
+		return fmt.Errorf("failed to record failure pattern: %w", err)
+	}
+	return nil
+}
+
+// parseTimestamp parses a stored timestamp, returning the zero time on failure
+func parseTimestamp(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logger.Warnf("Failed to parse timestamp %s: %v", value, err)
+		return time.Time{}
+	}
+	return parsed
+}
@@ -0,0 +1,107 @@
+package storage
+
+import "time"
+
+// minFlakinessRuns is the number of decided runs needed before a scenario is
+// rated at all
+const minFlakinessRuns = 3
+
+// minBrokenStreak is the number of trailing failures after which a scenario
+// that is not flaky counts as broken
+const minBrokenStreak = 2
+
+// Flakiness describes how a scenario behaved over an ordered sequence of runs.
+// Skipped runs are ignored.
+type Flakiness struct {
+	Runs   int // passed or failed runs
+	Failed int
+
+	Flips               int // status changes between consecutive runs
+	SameCommitConflicts int // commits on which the scenario both passed and failed
+	RetryPasses         int // runs that passed only after Gauge retried them
+
+	// Trailing streak; at most one of the two is non-zero
+	ConsecutivePasses int
+	ConsecutiveFails  int
+
+	StreakStart time.Time // first run of the trailing streak
+	Score       float64   // 0.0 = stable, 1.0 = very flaky
+}
+
+// AssessFlakiness rates the runs of one scenario, oldest first. The score is
+// the rate of pass/fail flips between consecutive runs plus the share of runs
+// that are direct evidence of flakiness: passing and failing on the same
+// commit, or passing after a retry. A scenario that broke once and kept
+// failing flips once and scores low; see Broken.
+func AssessFlakiness(runs []ScenarioRun) Flakiness {
+	var f Flakiness
+	commits := make(map[string]map[string]bool)
+	previous := ""
+
+	for _, run := range runs {
+		if run.Status != "passed" && run.Status != "failed" {
+			continue
+		}
+		f.Runs++
+
+		if run.Status == "failed" {
+			f.Failed++
+			if previous == "failed" {
+				f.ConsecutiveFails++
+			} else {
+				f.ConsecutiveFails, f.ConsecutivePasses = 1, 0
+				f.StreakStart = run.Timestamp
+			}
+		} else {
+			if run.Retries > 0 {
+				f.RetryPasses++
+			}
+			if previous == "passed" {
+				f.ConsecutivePasses++
+			} else {
+				f.ConsecutivePasses, f.ConsecutiveFails = 1, 0
+				f.StreakStart = run.Timestamp
+			}
+		}
+		if previous != "" && previous != run.Status {
+			f.Flips++
+		}
+		previous = run.Status
+
+		if run.GitCommit != "" {
+			if commits[run.GitCommit] == nil {
+				commits[run.GitCommit] = make(map[string]bool)
+			}
+			commits[run.GitCommit][run.Status] = true
+		}
+	}
+
+	for _, statuses := range commits {
+		if statuses["passed"] && statuses["failed"] {
+			f.SameCommitConflicts++
+		}
+	}
+
+	if f.Runs < minFlakinessRuns {
+		return f // Not enough data
+	}
+	flipRate := float64(f.Flips) / float64(f.Runs-1)
+	evidence := float64(f.SameCommitConflicts+f.RetryPasses) / float64(f.Runs)
+	f.Score = min(1.0, flipRate+evidence)
+	return f
+}
+
+// FailureRate returns the share of failed runs in percent
+func (f Flakiness) FailureRate() float64 {
+	if f.Runs == 0 {
+		return 0
+	}
+	return float64(f.Failed) / float64(f.Runs) * 100
+}
+
+// Broken reports whether the scenario has failed for its latest runs in a
+// row. It says nothing about how flaky the scenario was before, so callers
+// rate the score first; the breakage started at StreakStart.
+func (f Flakiness) Broken() bool {
+	return f.ConsecutiveFails >= minBrokenStreak
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetLLMResponse returns a cached LLM response and when it was stored, or ""
+// and the zero time if none is cached under key
+func (d *Database) GetLLMResponse(key string) (string, time.Time, error) {
+	var response, createdAt string
+	err := d.queryRow(`SELECT response, created_at FROM llm_responses WHERE cache_key = ?`, key).
+		Scan(&response, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get LLM response: %w", err)
+	}
+	return response, parseTimestamp(createdAt), nil
+}
+
+// SaveLLMResponse caches an LLM response under key, replacing any older one
+func (d *Database) SaveLLMResponse(key, provider, model, response string) error {
+	query := `
+		INSERT INTO llm_responses (cache_key, provider, model, response, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (cache_key) DO UPDATE SET
+			response = excluded.response,
+			created_at = excluded.created_at
+	`
+
+	if _, err := d.exec(query, key, provider, model, response, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to save LLM response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// ErrSchemaTooNew is returned when the database was written by a newer plugin version
+var ErrSchemaTooNew = errors.New("database schema is newer than this plugin supports")
+
+// migration is a single, ordered schema change
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations lists every schema change in order. Never edit or reorder an
+// entry once released; append a new version instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema",
+		statements: []string{
+			// Executions table
+			`CREATE TABLE IF NOT EXISTS executions (
+				id TEXT PRIMARY KEY,
+				timestamp DATETIME NOT NULL,
+				duration INTEGER NOT NULL,
+				total_scenarios INTEGER,
+				passed_scenarios INTEGER,
+				failed_scenarios INTEGER,
+				skipped_scenarios INTEGER,
+				success_rate REAL,
+				environment TEXT,
+				tags TEXT,
+				metadata TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+
+			// Index for timestamp queries
+			`CREATE INDEX IF NOT EXISTS idx_execution_timestamp
+			 ON executions(timestamp DESC)`,
+
+			// Scenario history table
+			`CREATE TABLE IF NOT EXISTS scenario_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				execution_id TEXT NOT NULL,
+				scenario_name TEXT NOT NULL,
+				spec_name TEXT NOT NULL,
+				status TEXT NOT NULL,
+				duration INTEGER,
+				error_message TEXT,
+				stack_trace TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (execution_id) REFERENCES executions(id)
+			)`,
+
+			// Indexes for scenario queries
+			`CREATE INDEX IF NOT EXISTS idx_scenario_name
+			 ON scenario_history(scenario_name)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_scenario_execution
+			 ON scenario_history(execution_id)`,
+
+			// Failure patterns table for grouping
+			`CREATE TABLE IF NOT EXISTS failure_patterns (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				error_signature TEXT NOT NULL UNIQUE,
+				first_seen DATETIME,
+				last_seen DATETIME,
+				occurrence_count INTEGER DEFAULT 1,
+				classification TEXT,
+				ai_analysis TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_error_signature
+			 ON failure_patterns(error_signature)`,
+
+			// Performance metrics table
+			`CREATE TABLE IF NOT EXISTS performance_metrics (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				execution_id TEXT NOT NULL,
+				step_text TEXT NOT NULL,
+				duration INTEGER NOT NULL,
+				scenario_name TEXT,
+				spec_name TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (execution_id) REFERENCES executions(id)
+			)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_step_performance
+			 ON performance_metrics(step_text, duration)`,
+		},
+	},
+	{
+		version:     2,
+		description: "CI metadata on executions",
+		statements: []string{
+			`ALTER TABLE executions ADD COLUMN build_number TEXT`,
+			`ALTER TABLE executions ADD COLUMN build_url TEXT`,
+			`ALTER TABLE executions ADD COLUMN branch TEXT`,
+			`ALTER TABLE executions ADD COLUMN git_commit TEXT`,
+			`ALTER TABLE executions ADD COLUMN ci_agent TEXT`,
+		},
+	},
+	{
+		version:     3,
+		description: "stable scenario identity",
+		statements: []string{
+			`ALTER TABLE scenario_history ADD COLUMN scenario_id TEXT`,
+			`ALTER TABLE scenario_history ADD COLUMN spec_file TEXT`,
+			`ALTER TABLE scenario_history ADD COLUMN line_start INTEGER`,
+			`ALTER TABLE scenario_history ADD COLUMN row_index INTEGER`,
+			`ALTER TABLE scenario_history ADD COLUMN content TEXT`,
+
+			`CREATE INDEX IF NOT EXISTS idx_scenario_id
+			 ON scenario_history(scenario_id)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_scenario_spec_file
+			 ON scenario_history(spec_file)`,
+
+			// Renamed scenarios: the ID derived from the new heading points at
+			// the ID its history was recorded under
+			`CREATE TABLE IF NOT EXISTS scenario_aliases (
+				alias_id TEXT PRIMARY KEY,
+				canonical_id TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+	},
+	{
+		version:     4,
+		description: "project and tag filter partitions",
+		statements: []string{
+			`ALTER TABLE executions ADD COLUMN project TEXT`,
+			`ALTER TABLE executions ADD COLUMN tag_filter TEXT`,
+
+			`CREATE INDEX IF NOT EXISTS idx_execution_partition
+			 ON executions(project, environment, timestamp DESC)`,
+		},
+	},
+	{
+		version:     5,
+		description: "daily aggregates of pruned runs",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS daily_aggregates (
+				day TEXT NOT NULL,
+				project TEXT NOT NULL DEFAULT '',
+				environment TEXT NOT NULL DEFAULT '',
+				tag_filter TEXT NOT NULL DEFAULT '',
+				runs INTEGER NOT NULL,
+				total_scenarios INTEGER NOT NULL,
+				passed_scenarios INTEGER NOT NULL,
+				failed_scenarios INTEGER NOT NULL,
+				skipped_scenarios INTEGER NOT NULL,
+				total_duration INTEGER NOT NULL,
+				PRIMARY KEY (day, project, environment, tag_filter)
+			)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_performance_execution
+			 ON performance_metrics(execution_id)`,
+		},
+	},
+	{
+		version:     6,
+		description: "scenario retries",
+		statements: []string{
+			`ALTER TABLE scenario_history ADD COLUMN retries INTEGER DEFAULT 0`,
+		},
+	},
+	{
+		version:     7,
+		description: "spec durations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS spec_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				execution_id TEXT NOT NULL,
+				spec_name TEXT NOT NULL,
+				spec_file TEXT,
+				status TEXT NOT NULL,
+				duration INTEGER NOT NULL,
+				tags TEXT,
+				stream INTEGER DEFAULT 0,
+				FOREIGN KEY (execution_id) REFERENCES executions(id)
+			)`,
+
+			`CREATE INDEX IF NOT EXISTS idx_spec_execution
+			 ON spec_history(execution_id)`,
+		},
+	},
+	{
+		version:     8,
+		description: "failure embeddings",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS failure_embeddings (
+				error_signature TEXT NOT NULL,
+				model TEXT NOT NULL,
+				vector TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (error_signature, model)
+			)`,
+		},
+	},
+	{
+		version:     9,
+		description: "failure pattern origin",
+		statements: []string{
+			`ALTER TABLE failure_patterns ADD COLUMN pattern TEXT`,
+			`ALTER TABLE failure_patterns ADD COLUMN first_build TEXT`,
+			`ALTER TABLE failure_patterns ADD COLUMN first_commit TEXT`,
+
+			`CREATE INDEX IF NOT EXISTS idx_failure_first_seen
+			 ON failure_patterns(first_seen)`,
+		},
+	},
+	{
+		version:     10,
+		description: "LLM response cache",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS llm_responses (
+				cache_key TEXT PRIMARY KEY,
+				provider TEXT NOT NULL,
+				model TEXT,
+				response TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     11,
+		description: "failure patterns per partition",
+		statements: []string{
+			// Signatures were unique across the whole database; key them by
+			// project, environment and tag filter instead. Existing patterns
+			// keep an empty partition, which every partition reads.
+			`CREATE TABLE failure_patterns_partitioned (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				error_signature TEXT NOT NULL,
+				project TEXT NOT NULL DEFAULT '',
+				environment TEXT NOT NULL DEFAULT '',
+				tag_filter TEXT NOT NULL DEFAULT '',
+				pattern TEXT,
+				first_seen DATETIME,
+				first_build TEXT,
+				first_commit TEXT,
+				last_seen DATETIME,
+				occurrence_count INTEGER DEFAULT 1,
+				classification TEXT,
+				ai_analysis TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (error_signature, project, environment, tag_filter)
+			)`,
+
+			`INSERT INTO failure_patterns_partitioned (
+				error_signature, pattern, first_seen, first_build, first_commit,
+				last_seen, occurrence_count, classification, ai_analysis, created_at
+			)
+			SELECT error_signature, pattern, first_seen, first_build, first_commit,
+				last_seen, occurrence_count, classification, ai_analysis, created_at
+			FROM failure_patterns`,
+
+			`DROP TABLE failure_patterns`,
+
+			`ALTER TABLE failure_patterns_partitioned RENAME TO failure_patterns`,
+
+			`CREATE INDEX IF NOT EXISTS idx_failure_first_seen
+			 ON failure_patterns(first_seen)`,
+		},
+	},
+}
+
+// LatestSchemaVersion returns the schema version this build writes
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate brings the database schema up to LatestSchemaVersion.
+// Databases created before versioning existed are treated as version 0;
+// migration 1 is idempotent so they upgrade in place.
+func (d *Database) migrate() error {
+	if _, err := d.db.Exec(d.dialect.translateDDL(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT,
+		applied_at TEXT NOT NULL
+	)`)); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, plugin supports up to %d",
+			ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := d.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		logger.Infof("Applied database migration %d: %s", m.version, m.description)
+	}
+
+	logger.Infof("Database migrations completed (schema version %d)", latest)
+	return nil
+}
+
+// applyMigration runs a single migration and records it in one transaction
+func (d *Database) applyMigration(m migration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	// Serialize concurrent migrators sharing one server, then re-check
+	// in case another process applied this version while we waited
+	if d.dialect.migrationLock != "" {
+		if _, err := tx.Exec(d.dialect.migrationLock); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+	var applied int
+	if err := tx.QueryRow(d.dialect.rebind(
+		`SELECT COUNT(*) FROM schema_version WHERE version = ?`), m.version,
+	).Scan(&applied); err != nil {
+		return fmt.Errorf("failed to check schema version: %w", err)
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	for i, stmt := range m.statements {
+		if _, err := tx.Exec(d.dialect.translateDDL(stmt)); err != nil {
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+
+	if _, err := tx.Exec(d.dialect.rebind(
+		`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`),
+		m.version, m.description, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the highest applied schema version (0 if none)
+func (d *Database) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := d.db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,38 @@
+package storage
+
+import "strings"
+
+// Partition scopes history queries to runs of one project and Gauge
+// environment, and optionally one tag filter. Empty fields match every run.
+type Partition struct {
+	Project     string
+	Environment string
+	TagFilter   string
+}
+
+// filter returns " AND ..." conditions on a table with project, environment and
+// tag_filter columns (aliased as alias) and their arguments. Runs recorded
+// before projects were stored belong to every project, so upgrading does not
+// reset existing trends.
+func (p Partition) filter(alias string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if p.Project != "" {
+		conditions = append(conditions, "COALESCE("+alias+".project, '') IN (?, '')")
+		args = append(args, p.Project)
+	}
+	if p.Environment != "" {
+		conditions = append(conditions, alias+".environment = ?")
+		args = append(args, p.Environment)
+	}
+	if p.TagFilter != "" {
+		conditions = append(conditions, alias+".tag_filter = ?")
+		args = append(args, p.TagFilter)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// StepMetric is the duration of one step execution
+type StepMetric struct {
+	StepText     string `json:"stepText"`
+	Duration     int64  `json:"duration"` // milliseconds
+	ScenarioName string `json:"scenarioName"`
+	SpecName     string `json:"specName"`
+}
+
+// SaveStepMetrics stores all step timings of an execution in one transaction
+func (d *Database) SaveStepMetrics(executionID string, metrics []StepMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	stmt, err := tx.Prepare(d.dialect.rebind(`
+		INSERT INTO performance_metrics (
+			execution_id, step_text, duration, scenario_name, spec_name
+		) VALUES (?, ?, ?, ?, ?)
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare step metric insert: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, m := range metrics {
+		if _, err := stmt.Exec(executionID, m.StepText, m.Duration, m.ScenarioName, m.SpecName); err != nil {
+			return fmt.Errorf("failed to save step metric: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetStepDurations loads every step duration (ms) recorded in a partition in
+// the last N days, keyed by step text, in a single query
+func (d *Database) GetStepDurations(partition Partition, days int) (map[string][]int64, error) {
+	filter, args := partition.filter("e")
+	query := `
+		SELECT pm.step_text, pm.duration
+		FROM performance_metrics pm
+		JOIN executions e ON pm.execution_id = e.id
+		WHERE e.timestamp >= ?` + filter + `
+	`
+
+	rows, err := d.query(query, append([]interface{}{cutoff(days)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	durations := make(map[string][]int64)
+	for rows.Next() {
+		var stepText string
+		var duration int64
+		if err := rows.Scan(&stepText, &duration); err != nil {
+			continue
+		}
+		durations[stepText] = append(durations[stepText], duration)
+	}
+
+	return durations, rows.Err()
+}
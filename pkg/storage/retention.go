@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// pruneBatchSize bounds the number of IDs bound into one IN (...) clause
+const pruneBatchSize = 500
+
+// RetentionPolicy decides which executions are kept in full. Zero values
+// disable the corresponding limit.
+type RetentionPolicy struct {
+	MaxAgeDays int // executions older than this are compacted
+	MaxRuns    int // newest runs kept per project, environment and tag filter
+}
+
+// Enabled reports whether the policy removes anything at all
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAgeDays > 0 || p.MaxRuns > 0
+}
+
+// PruneResult summarises what a prune removed, or would remove on a dry run
+type PruneResult struct {
+	DryRun      bool
+	Executions  int
+	Scenarios   int
+	StepMetrics int
+	Days        []string // days whose runs were rolled up, oldest first
+}
+
+// DailyAggregate is the rolled-up summary of one day's pruned runs in a partition
+type DailyAggregate struct {
+	Day              string `json:"day"` // YYYY-MM-DD, UTC
+	Project          string `json:"project,omitempty"`
+	Environment      string `json:"environment,omitempty"`
+	TagFilter        string `json:"tagFilter,omitempty"`
+	Runs             int    `json:"runs"`
+	TotalScenarios   int    `json:"totalScenarios"`
+	PassedScenarios  int    `json:"passedScenarios"`
+	FailedScenarios  int    `json:"failedScenarios"`
+	SkippedScenarios int    `json:"skippedScenarios"`
+	TotalDuration    int64  `json:"totalDuration"` // milliseconds, summed over runs
+}
+
+// SuccessRate returns the day's scenario success rate in percent
+func (a *DailyAggregate) SuccessRate() float64 {
+	if a.TotalScenarios == 0 {
+		return 0
+	}
+	return float64(a.PassedScenarios) / float64(a.TotalScenarios) * 100
+}
+
+// Prune removes executions outside the retention policy together with their
+// scenario and step records, after rolling them up into daily aggregates so
+// long-term trends survive. With dryRun nothing is changed.
+func (d *Database) Prune(policy RetentionPolicy, dryRun bool) (*PruneResult, error) {
+	result := &PruneResult{DryRun: dryRun}
+	if !policy.Enabled() {
+		return result, nil
+	}
+
+	expired, err := d.expiredExecutions(policy)
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return result, nil
+	}
+
+	aggregates := rollUp(expired)
+	for _, agg := range aggregates {
+		if len(result.Days) == 0 || result.Days[len(result.Days)-1] != agg.Day {
+			result.Days = append(result.Days, agg.Day)
+		}
+	}
+	result.Executions = len(expired)
+
+	ids := make([]interface{}, len(expired))
+	for i, exec := range expired {
+		ids[i] = exec.ID
+	}
+
+	if dryRun {
+		for start := 0; start < len(ids); start += pruneBatchSize {
+			batch := ids[start:min(start+pruneBatchSize, len(ids))]
+			scenarios, err := d.countByExecution("scenario_history", batch)
+			if err != nil {
+				return nil, err
+			}
+			steps, err := d.countByExecution("performance_metrics", batch)
+			if err != nil {
+				return nil, err
+			}
+			result.Scenarios += scenarios
+			result.StepMetrics += steps
+		}
+		return result, nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	for _, agg := range aggregates {
+		if err := d.saveDailyAggregate(tx, agg); err != nil {
+			return nil, err
+		}
+	}
+
+	for start := 0; start < len(ids); start += pruneBatchSize {
+		batch := ids[start:min(start+pruneBatchSize, len(ids))]
+		// Children first, so no scenario, spec or step row outlives its execution
+		scenarios, err := d.deleteByColumn(tx, "scenario_history", "execution_id", batch)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := d.deleteByColumn(tx, "performance_metrics", "execution_id", batch)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.deleteByColumn(tx, "spec_history", "execution_id", batch); err != nil {
+			return nil, err
+		}
+		if _, err := d.deleteByColumn(tx, "executions", "id", batch); err != nil {
+			return nil, err
+		}
+		result.Scenarios += scenarios
+		result.StepMetrics += steps
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit prune: %w", err)
+	}
+
+	logger.Infof("Pruned %d executions (%d scenario and %d step records) into %d daily aggregates",
+		result.Executions, result.Scenarios, result.StepMetrics, len(aggregates))
+	return result, nil
+}
+
+// expiredExecutions lists executions outside the policy, newest first
+func (d *Database) expiredExecutions(policy RetentionPolicy) ([]ExecutionRecord, error) {
+	rows, err := d.query(`
+		SELECT
+			id, timestamp, duration,
+			COALESCE(total_scenarios, 0), COALESCE(passed_scenarios, 0),
+			COALESCE(failed_scenarios, 0), COALESCE(skipped_scenarios, 0),
+			COALESCE(project, ''), COALESCE(environment, ''), COALESCE(tag_filter, '')
+		FROM executions
+		ORDER BY timestamp DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var threshold time.Time
+	if policy.MaxAgeDays > 0 {
+		threshold = time.Now().UTC().AddDate(0, 0, -policy.MaxAgeDays)
+	}
+	kept := make(map[Partition]int) // runs kept per partition
+
+	var expired []ExecutionRecord
+	for rows.Next() {
+		var exec ExecutionRecord
+		var timestamp string
+		if err := rows.Scan(
+			&exec.ID, &timestamp, &exec.Duration,
+			&exec.TotalScenarios, &exec.PassedScenarios,
+			&exec.FailedScenarios, &exec.SkippedScenarios,
+			&exec.Project, &exec.Environment, &exec.TagFilter,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		exec.Timestamp = parseTimestamp(timestamp)
+
+		partition := Partition{Project: exec.Project, Environment: exec.Environment, TagFilter: exec.TagFilter}
+		tooOld := !threshold.IsZero() && exec.Timestamp.Before(threshold)
+		tooMany := policy.MaxRuns > 0 && kept[partition] >= policy.MaxRuns
+		if tooOld || tooMany {
+			expired = append(expired, exec)
+			continue
+		}
+		kept[partition]++
+	}
+
+	return expired, rows.Err()
+}
+
+// rollUp sums executions into one aggregate per day and partition, oldest first
+func rollUp(executions []ExecutionRecord) []*DailyAggregate {
+	byKey := make(map[string]*DailyAggregate)
+	for _, exec := range executions {
+		day := exec.Timestamp.UTC().Format("2006-01-02")
+		key := strings.Join([]string{day, exec.Project, exec.Environment, exec.TagFilter}, "\x00")
+		agg, ok := byKey[key]
+		if !ok {
+			agg = &DailyAggregate{
+				Day:         day,
+				Project:     exec.Project,
+				Environment: exec.Environment,
+				TagFilter:   exec.TagFilter,
+			}
+			byKey[key] = agg
+		}
+		agg.Runs++
+		agg.TotalScenarios += exec.TotalScenarios
+		agg.PassedScenarios += exec.PassedScenarios
+		agg.FailedScenarios += exec.FailedScenarios
+		agg.SkippedScenarios += exec.SkippedScenarios
+		agg.TotalDuration += exec.Duration
+	}
+
+	aggregates := make([]*DailyAggregate, 0, len(byKey))
+	for _, agg := range byKey {
+		aggregates = append(aggregates, agg)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		a, b := aggregates[i], aggregates[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		return a.Project+a.Environment+a.TagFilter < b.Project+b.Environment+b.TagFilter
+	})
+	return aggregates
+}
+
+// saveDailyAggregate adds agg to the stored aggregate of its day and partition
+func (d *Database) saveDailyAggregate(tx *sql.Tx, agg *DailyAggregate) error {
+	_, err := tx.Exec(d.dialect.rebind(`
+		INSERT INTO daily_aggregates (
+			day, project, environment, tag_filter, runs, total_scenarios,
+			passed_scenarios, failed_scenarios, skipped_scenarios, total_duration
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (day, project, environment, tag_filter) DO UPDATE SET
+			runs = daily_aggregates.runs + excluded.runs,
+			total_scenarios = daily_aggregates.total_scenarios + excluded.total_scenarios,
+			passed_scenarios = daily_aggregates.passed_scenarios + excluded.passed_scenarios,
+			failed_scenarios = daily_aggregates.failed_scenarios + excluded.failed_scenarios,
+			skipped_scenarios = daily_aggregates.skipped_scenarios + excluded.skipped_scenarios,
+			total_duration = daily_aggregates.total_duration + excluded.total_duration
+	`), agg.Day, agg.Project, agg.Environment, agg.TagFilter, agg.Runs, agg.TotalScenarios,
+		agg.PassedScenarios, agg.FailedScenarios, agg.SkippedScenarios, agg.TotalDuration)
+	if err != nil {
+		return fmt.Errorf("failed to save daily aggregate: %w", err)
+	}
+	return nil
+}
+
+// countByExecution counts the rows of table belonging to the given executions
+func (d *Database) countByExecution(table string, ids []interface{}) (int, error) {
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE execution_id IN (%s)`, table, placeholders(len(ids)))
+	if err := d.queryRow(query, ids...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// deleteByColumn deletes the rows of table whose column is one of values
+func (d *Database) deleteByColumn(tx *sql.Tx, table, column string, values []interface{}) (int, error) {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s IN (%s)`, table, column, placeholders(len(values)))
+	result, err := tx.Exec(d.dialect.rebind(query), values...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune %s: %w", table, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pruned %s rows: %w", table, err)
+	}
+	return int(affected), nil
+}
+
+// GetDailyAggregates returns the rolled-up days of a partition in the last N
+// days, oldest first
+func (d *Database) GetDailyAggregates(partition Partition, days int) ([]DailyAggregate, error) {
+	filter, args := partition.filter("da")
+	query := `
+		SELECT
+			da.day, da.project, da.environment, da.tag_filter, da.runs, da.total_scenarios,
+			da.passed_scenarios, da.failed_scenarios, da.skipped_scenarios, da.total_duration
+		FROM daily_aggregates da
+		WHERE da.day >= ?` + filter + `
+		ORDER BY da.day ASC
+	`
+
+	rows, err := d.query(query, append([]interface{}{cutoff(days)[:len("2006-01-02")]}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var aggregates []DailyAggregate
+	for rows.Next() {
+		var agg DailyAggregate
+		if err := rows.Scan(
+			&agg.Day, &agg.Project, &agg.Environment, &agg.TagFilter, &agg.Runs, &agg.TotalScenarios,
+			&agg.PassedScenarios, &agg.FailedScenarios, &agg.SkippedScenarios, &agg.TotalDuration,
+		); err != nil {
+			continue
+		}
+		aggregates = append(aggregates, agg)
+	}
+
+	return aggregates, rows.Err()
+}
+
+// placeholders returns n comma-separated '?' placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
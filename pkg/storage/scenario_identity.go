@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// ScenarioKey identifies a scenario in history queries. Rows are matched on
+// ID; rows recorded before scenario IDs existed fall back to name and spec.
+type ScenarioKey struct {
+	ID       string
+	Name     string
+	SpecName string
+}
+
+// filter returns the WHERE condition on scenario_history (aliased sh) and its arguments
+func (k ScenarioKey) filter() (string, []interface{}) {
+	if k.ID == "" {
+		return "sh.scenario_name = ? AND sh.spec_name = ?", []interface{}{k.Name, k.SpecName}
+	}
+	return "(sh.scenario_id = ? OR (sh.scenario_id IS NULL AND sh.scenario_name = ? AND sh.spec_name = ?))",
+		[]interface{}{k.ID, k.Name, k.SpecName}
+}
+
+// ScenarioSnapshot is the most recent recorded state of a scenario, used to
+// recognise it after a rename
+type ScenarioSnapshot struct {
+	ScenarioID   string
+	ScenarioName string
+	LineStart    int
+	RowIndex     int
+	Content      string
+}
+
+// GetScenarioSnapshots returns the latest state of every scenario recorded for
+// specFile in the last N days, one entry per scenario ID
+func (d *Database) GetScenarioSnapshots(specFile string, days int) ([]ScenarioSnapshot, error) {
+	query := `
+		SELECT
+			sh.scenario_id, sh.scenario_name, COALESCE(sh.line_start, 0),
+			COALESCE(sh.row_index, 0), COALESCE(sh.content, '')
+		FROM scenario_history sh
+		JOIN executions e ON sh.execution_id = e.id
+		WHERE sh.spec_file = ?
+		AND sh.scenario_id IS NOT NULL
+		AND e.timestamp >= ?
+		ORDER BY e.timestamp DESC
+	`
+
+	rows, err := d.query(query, specFile, cutoff(days))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	var snapshots []ScenarioSnapshot
+	for rows.Next() {
+		var snapshot ScenarioSnapshot
+		if err := rows.Scan(
+			&snapshot.ScenarioID,
+			&snapshot.ScenarioName,
+			&snapshot.LineStart,
+			&snapshot.RowIndex,
+			&snapshot.Content,
+		); err != nil {
+			continue
+		}
+		if seen[snapshot.ScenarioID] {
+			continue
+		}
+		seen[snapshot.ScenarioID] = true
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetScenarioAliases returns every recorded rename as alias ID → canonical ID
+func (d *Database) GetScenarioAliases() (map[string]string, error) {
+	rows, err := d.query(`SELECT alias_id, canonical_id FROM scenario_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var alias, canonical string
+		if err := rows.Scan(&alias, &canonical); err != nil {
+			continue
+		}
+		aliases[alias] = canonical
+	}
+
+	return aliases, rows.Err()
+}
+
+// AddScenarioAlias records that aliasID is a renamed scenario whose history is
+// kept under canonicalID
+func (d *Database) AddScenarioAlias(aliasID, canonicalID string) error {
+	_, err := d.exec(`
+		INSERT INTO scenario_aliases (alias_id, canonical_id)
+		VALUES (?, ?)
+		ON CONFLICT (alias_id) DO UPDATE SET canonical_id = excluded.canonical_id
+	`, aliasID, canonicalID)
+	if err != nil {
+		return fmt.Errorf("failed to save scenario alias: %w", err)
+	}
+	return nil
+}
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// ScenarioRun is a scenario record together with the run it belongs to
+type ScenarioRun struct {
+	ScenarioRecord
+	Timestamp   time.Time `json:"timestamp"`
+	BuildNumber string    `json:"buildNumber,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	GitCommit   string    `json:"gitCommit,omitempty"`
+}
+
+// Key identifies the scenario across runs: its stable ID, or spec and heading
+// for rows recorded before scenario IDs existed
+func (r *ScenarioRun) Key() string {
+	if r.ScenarioID != "" {
+		return r.ScenarioID
+	}
+	return r.SpecName + "\x00" + r.ScenarioName
+}
+
+// GetExecutionScenarios retrieves every scenario recorded for an execution
+func (d *Database) GetExecutionScenarios(executionID string) ([]ScenarioRecord, error) {
+	rows, err := d.query(`
+		SELECT `+scenarioColumns+`
+		FROM scenario_history sh
+		WHERE sh.execution_id = ?
+		ORDER BY sh.id ASC
+	`, executionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var scenarios []ScenarioRecord
+	for rows.Next() {
+		var scenario ScenarioRecord
+		if err := rows.Scan(scenario.scanTargets()...); err != nil {
+			continue
+		}
+		scenarios = append(scenarios, scenario)
+	}
+
+	return scenarios, rows.Err()
+}
+
+// GetScenarioRunsByKey loads the runs of one scenario in a partition in the
+// last N days, oldest first
+func (d *Database) GetScenarioRunsByKey(key ScenarioKey, partition Partition, days int) ([]ScenarioRun, error) {
+	filter, args := key.filter()
+	scope, scopeArgs := partition.filter("e")
+	query := `
+		SELECT ` + scenarioColumns + `,
+			e.timestamp, COALESCE(e.build_number, ''), COALESCE(e.branch, ''), COALESCE(e.git_commit, '')
+		FROM scenario_history sh
+		JOIN executions e ON sh.execution_id = e.id
+		WHERE ` + filter + scope + `
+		AND e.timestamp >= ?
+		ORDER BY e.timestamp ASC, sh.id ASC
+	`
+
+	args = append(args, scopeArgs...)
+	return d.scanScenarioRuns(query, append(args, cutoff(days))...)
+}
+
+// GetScenarioRuns loads every scenario run of a partition in the last N days,
+// oldest first, in a single query. A non-empty name restricts the result to
+// scenarios whose heading contains it, ignoring case.
+func (d *Database) GetScenarioRuns(name string, partition Partition, days int) ([]ScenarioRun, error) {
+	filter, args := partition.filter("e")
+	query := `
+		SELECT ` + scenarioColumns + `,
+			e.timestamp, COALESCE(e.build_number, ''), COALESCE(e.branch, ''), COALESCE(e.git_commit, '')
+		FROM scenario_history sh
+		JOIN executions e ON sh.execution_id = e.id
+		WHERE e.timestamp >= ?` + filter
+	args = append([]interface{}{cutoff(days)}, args...)
+	if name != "" {
+		query += ` AND LOWER(sh.scenario_name) LIKE ?`
+		args = append(args, "%"+strings.ToLower(name)+"%")
+	}
+	query += ` ORDER BY e.timestamp ASC, sh.id ASC`
+
+	return d.scanScenarioRuns(query, args...)
+}
+
+// GetScenarioOutcomes loads the outcome of every scenario run of a partition
+// in the last N days, oldest first. Only the scenario's identity, spec file,
+// status, duration and retries and the execution's ID, time and commit are filled in,
+// to keep large windows cheap. Executions and scenarios are read with one
+// query each and joined in memory, so each timestamp is parsed once per
+// execution rather than once per scenario.
+func (d *Database) GetScenarioOutcomes(partition Partition, days int) ([]ScenarioRun, error) {
+	filter, args := partition.filter("e")
+	args = append([]interface{}{cutoff(days)}, args...)
+	where := ` WHERE e.timestamp >= ?` + filter
+
+	rows, err := d.query(`
+		SELECT e.id, e.timestamp, COALESCE(e.git_commit, '')
+		FROM executions e`+where+`
+		ORDER BY e.timestamp ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	byExecution := make(map[string]*ScenarioRun)
+	for rows.Next() {
+		var run ScenarioRun
+		var timestamp string
+		if err := rows.Scan(&run.ExecutionID, &timestamp, &run.GitCommit); err != nil {
+			continue
+		}
+		run.Timestamp = parseTimestamp(timestamp)
+		order = append(order, run.ExecutionID)
+		byExecution[run.ExecutionID] = &run
+	}
+	if err := rows.Close(); err != nil {
+		logger.Warnf("Failed to close rows: %v", err)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(order) == 0 {
+		return nil, nil
+	}
+
+	rows, err = d.query(`
+		SELECT
+			sh.execution_id, sh.scenario_name, sh.spec_name, sh.status, COALESCE(sh.duration, 0),
+			COALESCE(sh.scenario_id, ''), COALESCE(sh.spec_file, ''), COALESCE(sh.retries, 0)
+		FROM scenario_history sh
+		WHERE sh.execution_id IN (SELECT e.id FROM executions e`+where+`)
+		ORDER BY sh.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	scenarios := make(map[string][]ScenarioRun, len(order))
+	for rows.Next() {
+		var run ScenarioRun
+		if err := rows.Scan(
+			&run.ExecutionID, &run.ScenarioName, &run.SpecName, &run.Status, &run.Duration,
+			&run.ScenarioID, &run.SpecFile, &run.Retries,
+		); err != nil {
+			continue
+		}
+		if exec, ok := byExecution[run.ExecutionID]; ok {
+			run.Timestamp, run.GitCommit = exec.Timestamp, exec.GitCommit
+			scenarios[run.ExecutionID] = append(scenarios[run.ExecutionID], run)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var runs []ScenarioRun
+	for _, id := range order {
+		runs = append(runs, scenarios[id]...)
+	}
+	return runs, nil
+}
+
+// GroupScenarioRuns splits runs by scenario key, in the order each scenario
+// first appears; the runs of each scenario keep their order
+func GroupScenarioRuns(runs []ScenarioRun) [][]ScenarioRun {
+	index := make(map[string]int)
+	var groups [][]ScenarioRun
+	for _, run := range runs {
+		i, ok := index[run.Key()]
+		if !ok {
+			i = len(groups)
+			index[run.Key()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], run)
+	}
+	return groups
+}
+
+// ScenarioRunIndex groups runs loaded in one query by scenario, so the runs
+// of many scenarios can be looked up without a query each
+type ScenarioRunIndex struct {
+	byKey  map[string][]ScenarioRun // by ScenarioRun.Key
+	byName map[string][]ScenarioRun // by spec and heading, whatever the ID
+}
+
+// IndexScenarioRuns indexes runs; the runs of each scenario keep their order
+func IndexScenarioRuns(runs []ScenarioRun) *ScenarioRunIndex {
+	index := &ScenarioRunIndex{
+		byKey:  make(map[string][]ScenarioRun),
+		byName: make(map[string][]ScenarioRun),
+	}
+	for _, run := range runs {
+		index.byKey[run.Key()] = append(index.byKey[run.Key()], run)
+		name := run.SpecName + "\x00" + run.ScenarioName
+		index.byName[name] = append(index.byName[name], run)
+	}
+	return index
+}
+
+// Runs returns the runs matching key the way GetScenarioRunsByKey selects
+// them: by ID, plus rows recorded before IDs existed under the same spec and
+// heading. Runs are ordered by time if they were indexed oldest first.
+func (i *ScenarioRunIndex) Runs(key ScenarioKey) []ScenarioRun {
+	name := key.SpecName + "\x00" + key.Name
+	if key.ID == "" {
+		return i.byName[name]
+	}
+
+	byID, legacy := i.byKey[key.ID], i.byKey[name]
+	if len(legacy) == 0 {
+		return byID
+	}
+	merged := make([]ScenarioRun, 0, len(byID)+len(legacy))
+	for len(byID) > 0 && len(legacy) > 0 {
+		if legacy[0].Timestamp.After(byID[0].Timestamp) {
+			merged, byID = append(merged, byID[0]), byID[1:]
+		} else {
+			merged, legacy = append(merged, legacy[0]), legacy[1:]
+		}
+	}
+	return append(append(merged, byID...), legacy...)
+}
+
+// scanScenarioRuns runs a query selecting scenarioColumns followed by the
+// execution's timestamp, build number, branch and commit
+func (d *Database) scanScenarioRuns(query string, args ...interface{}) ([]ScenarioRun, error) {
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var runs []ScenarioRun
+	for rows.Next() {
+		var run ScenarioRun
+		var timestamp string
+		targets := append(run.scanTargets(), &timestamp, &run.BuildNumber, &run.Branch, &run.GitCommit)
+		if err := rows.Scan(targets...); err != nil {
+			continue
+		}
+		run.Timestamp = parseTimestamp(timestamp)
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/logger"
+)
+
+// SpecRecord is the outcome of one spec in an execution
+type SpecRecord struct {
+	ExecutionID string   `json:"executionId"`
+	SpecName    string   `json:"specName"`
+	SpecFile    string   `json:"specFile,omitempty"`
+	Status      string   `json:"status"`
+	Duration    int64    `json:"duration"` // milliseconds, hooks included
+	Tags        []string `json:"tags,omitempty"`
+	Stream      int      `json:"stream,omitempty"` // Gauge stream it ran on; 0 if not recorded
+}
+
+// SpecDurations is the duration history of one spec, keyed by its file when
+// known and otherwise by its heading
+type SpecDurations struct {
+	SpecName  string   `json:"specName"`
+	SpecFile  string   `json:"specFile,omitempty"`
+	Tags      []string `json:"tags,omitempty"` // of the latest run
+	Durations []int64  `json:"durations"`      // milliseconds, oldest first
+}
+
+// key identifies the spec across runs
+func (s *SpecDurations) key() string {
+	if s.SpecFile != "" {
+		return s.SpecFile
+	}
+	return "\x00" + s.SpecName
+}
+
+// SaveSpecs stores the specs of an execution in one transaction
+func (d *Database) SaveSpecs(executionID string, specs []SpecRecord) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op after a successful commit
+	}()
+
+	stmt, err := tx.Prepare(d.dialect.rebind(`
+		INSERT INTO spec_history (
+			execution_id, spec_name, spec_file, status, duration, tags, stream
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare spec insert: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, spec := range specs {
+		tagsJSON, err := json.Marshal(spec.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to marshal spec tags: %w", err)
+		}
+		if _, err := stmt.Exec(executionID, spec.SpecName, spec.SpecFile, spec.Status,
+			spec.Duration, string(tagsJSON), spec.Stream); err != nil {
+			return fmt.Errorf("failed to save spec: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSpecDurations loads the durations of every spec that ran in a partition
+// in the last N days. Executions recorded before spec durations were stored
+// fall back to the sum of their scenario durations, which leaves out hooks.
+// Skipped specs are left out.
+func (d *Database) GetSpecDurations(partition Partition, days int) ([]SpecDurations, error) {
+	filter, args := partition.filter("e")
+	args = append([]interface{}{cutoff(days)}, args...)
+
+	type specRun struct {
+		executionID, name, file, tagsJSON string
+		duration                          int64
+	}
+	var runs []specRun
+	scan := func(query string) error {
+		rows, err := d.query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				logger.Warnf("Failed to close rows: %v", err)
+			}
+		}()
+		for rows.Next() {
+			var run specRun
+			if err := rows.Scan(&run.executionID, &run.name, &run.file, &run.tagsJSON, &run.duration); err != nil {
+				continue
+			}
+			runs = append(runs, run)
+		}
+		return rows.Err()
+	}
+
+	// Runs without spec records first: they are the older ones
+	if err := scan(`
+		SELECT sh.execution_id, MAX(sh.spec_name), MAX(COALESCE(sh.spec_file, '')), '', SUM(COALESCE(sh.duration, 0))
+		FROM scenario_history sh
+		JOIN executions e ON sh.execution_id = e.id
+		WHERE e.timestamp >= ?` + filter + `
+		  AND sh.status <> 'skipped'
+		  AND NOT EXISTS (SELECT 1 FROM spec_history sp WHERE sp.execution_id = sh.execution_id)
+		GROUP BY e.timestamp, sh.execution_id, COALESCE(NULLIF(sh.spec_file, ''), sh.spec_name)
+		ORDER BY e.timestamp ASC
+	`); err != nil {
+		return nil, err
+	}
+	if err := scan(`
+		SELECT sp.execution_id, sp.spec_name, COALESCE(sp.spec_file, ''), COALESCE(sp.tags, ''), sp.duration
+		FROM spec_history sp
+		JOIN executions e ON sp.execution_id = e.id
+		WHERE e.timestamp >= ?` + filter + `
+		  AND sp.status <> 'skipped'
+		ORDER BY e.timestamp ASC, sp.id ASC
+	`); err != nil {
+		return nil, err
+	}
+
+	// Rows recorded before spec files were known count towards the file
+	// later runs of the same heading recorded, added up per execution
+	files := make(map[string]string)
+	for _, run := range runs {
+		if run.file != "" {
+			files[run.name] = run.file
+		}
+	}
+
+	var specs []SpecDurations
+	index := make(map[string]int)
+	lastExecution := make(map[int]string)
+	for _, run := range runs {
+		if run.file == "" {
+			run.file = files[run.name]
+		}
+		spec := SpecDurations{SpecName: run.name, SpecFile: run.file}
+		i, ok := index[spec.key()]
+		if !ok {
+			i = len(specs)
+			index[spec.key()] = i
+			specs = append(specs, spec)
+		}
+		specs[i].SpecName = run.name // latest heading wins
+		if last := len(specs[i].Durations) - 1; last >= 0 && lastExecution[i] == run.executionID {
+			specs[i].Durations[last] += run.duration
+		} else {
+			specs[i].Durations = append(specs[i].Durations, run.duration)
+		}
+		lastExecution[i] = run.executionID
+		if run.tagsJSON != "" {
+			var tags []string
+			if err := json.Unmarshal([]byte(run.tagsJSON), &tags); err == nil {
+				specs[i].Tags = tags
+			}
+		}
+	}
+	return specs, nil
+}
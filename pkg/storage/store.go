@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Store is the historical data backend used by analytics and reporting
+type Store interface {
+	SaveExecution(exec *ExecutionRecord) error
+	SaveScenario(scenario *ScenarioRecord) error
+	GetRecentExecutions(partition Partition, limit int) ([]ExecutionRecord, error)
+	GetExecution(id string) (*ExecutionRecord, error)
+	GetExecutionScenarios(executionID string) ([]ScenarioRecord, error)
+	GetScenarioRuns(name string, partition Partition, days int) ([]ScenarioRun, error)
+	GetScenarioRunsByKey(key ScenarioKey, partition Partition, days int) ([]ScenarioRun, error)
+	GetScenarioOutcomes(partition Partition, days int) ([]ScenarioRun, error)
+	GetScenarioHistory(key ScenarioKey, partition Partition, days int) ([]ScenarioRecord, error)
+	CalculateFlakyScore(key ScenarioKey, partition Partition, days int) (float64, error)
+	GetScenarioSnapshots(specFile string, days int) ([]ScenarioSnapshot, error)
+	GetScenarioAliases() (map[string]string, error)
+	AddScenarioAlias(aliasID, canonicalID string) error
+	GetTrendData(partition Partition, days int) ([]TrendPoint, error)
+	GetFailurePattern(partition Partition, signature string) (*FailurePattern, error)
+	GetFailurePatternsFirstSeen(partition Partition, firstSeen time.Time) ([]FailurePattern, error)
+	RecordFailurePattern(partition Partition, s FailureSighting) error
+	GetFailureEmbeddings(model string, signatures []string) (map[string][]float64, error)
+	SaveFailureEmbeddings(model string, vectors map[string][]float64) error
+	GetLLMResponse(key string) (string, time.Time, error)
+	SaveLLMResponse(key, provider, model, response string) error
+	SaveStepMetrics(executionID string, metrics []StepMetric) error
+	GetStepDurations(partition Partition, days int) (map[string][]int64, error)
+	SaveSpecs(executionID string, specs []SpecRecord) error
+	GetSpecDurations(partition Partition, days int) ([]SpecDurations, error)
+	Prune(policy RetentionPolicy, dryRun bool) (*PruneResult, error)
+	GetDailyAggregates(partition Partition, days int) ([]DailyAggregate, error)
+	Export(w io.Writer) (*ArchiveManifest, error)
+	Import(r io.ReaderAt, size int64) (*ImportResult, error)
+	SchemaVersion() (int, error)
+	Backend() string
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
+
+// Open selects a storage backend from a DSN.
+//
+//   - ""                          SQLite at <reportsDir>/.gauge-history/test-history.db
+//   - "sqlite://<path>" or a path SQLite at the given file
+//   - "postgres://..."            PostgreSQL (also "postgresql://")
+func Open(reportsDir, dsn string) (Store, error) {
+	switch {
+	case dsn == "":
+		return NewDatabase(reportsDir)
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return NewPostgresDatabase(dsn)
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return NewSQLiteDatabase(strings.TrimPrefix(dsn, "sqlite://"))
+	case strings.Contains(dsn, "://"):
+		return nil, fmt.Errorf("unsupported history database DSN scheme: %s", redactDSN(dsn))
+	default:
+		return NewSQLiteDatabase(dsn)
+	}
+}
+
+// redactDSN hides credentials in a DSN for logging
+func redactDSN(dsn string) string {
+	schemeEnd := strings.Index(dsn, "://")
+	at := strings.LastIndex(dsn, "@")
+	if schemeEnd < 0 || at < schemeEnd {
+		return dsn
+	}
+	return dsn[:schemeEnd+3] + "***" + dsn[at:]
+}
@@ -0,0 +1,89 @@
+package timeline
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lirany1/gauge-html-report-ai/pkg/models"
+)
+
+// Recorder collects the start and end time of each spec and the stream it
+// ran on from Gauge's execution notifications. Streams of a parallel run
+// notify concurrently; within a stream, specs run one after another.
+type Recorder struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	open  map[int]*models.ExecutionSpan // spec running on each stream
+	spans []*models.ExecutionSpan
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		now:  time.Now,
+		open: make(map[int]*models.ExecutionSpan),
+	}
+}
+
+// SpecStarting records that a spec started on a stream
+func (r *Recorder) SpecStarting(stream int, fileName, specName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream = normalizeStream(stream)
+	r.open[stream] = &models.ExecutionSpan{
+		Stream:   stream,
+		SpecName: specName,
+		FileName: fileName,
+		Start:    r.now(),
+	}
+}
+
+// SpecEnding records that a spec finished on a stream. A spec whose start
+// was not seen gets a zero-length span.
+func (r *Recorder) SpecEnding(stream int, fileName, specName string, failed, skipped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream = normalizeStream(stream)
+	now := r.now()
+	span := r.open[stream]
+	if span == nil || span.FileName != fileName {
+		span = &models.ExecutionSpan{Stream: stream, SpecName: specName, FileName: fileName, Start: now}
+	}
+	delete(r.open, stream)
+
+	span.End = now
+	switch {
+	case failed:
+		span.Status = "failed"
+	case skipped:
+		span.Status = "skipped"
+	default:
+		span.Status = "passed"
+	}
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns the finished specs ordered by start time
+func (r *Recorder) Spans() []*models.ExecutionSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]*models.ExecutionSpan, len(r.spans))
+	copy(spans, r.spans)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans
+}
+
+// normalizeStream maps the stream of a serial run, which Gauge may report as
+// 0, to 1
+func normalizeStream(stream int) int {
+	if stream < 1 {
+		return 1
+	}
+	return stream
+}
@@ -0,0 +1,84 @@
+package timeline
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	clock := start
+	recorder := NewRecorder()
+	recorder.now = func() time.Time { return clock }
+
+	// Two streams overlap: checkout runs on 1 while login and search run on 2
+	recorder.SpecStarting(1, "specs/checkout.spec", "Checkout")
+	clock = clock.Add(time.Second)
+	recorder.SpecStarting(2, "specs/login.spec", "Login")
+	clock = clock.Add(2 * time.Second)
+	recorder.SpecEnding(2, "specs/login.spec", "Login", true, false)
+	recorder.SpecStarting(2, "specs/search.spec", "Search")
+	clock = clock.Add(4 * time.Second)
+	recorder.SpecEnding(1, "specs/checkout.spec", "Checkout", false, false)
+	recorder.SpecEnding(2, "specs/search.spec", "Search", false, true)
+
+	// A spec whose start was missed, on a serial stream
+	recorder.SpecEnding(0, "specs/orphan.spec", "Orphan", false, false)
+
+	spans := recorder.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans, got %d", len(spans))
+	}
+
+	want := []struct {
+		spec     string
+		stream   int
+		offset   time.Duration
+		duration time.Duration
+		status   string
+	}{
+		{"Checkout", 1, 0, 7 * time.Second, "passed"},
+		{"Login", 2, time.Second, 2 * time.Second, "failed"},
+		{"Search", 2, 3 * time.Second, 4 * time.Second, "skipped"},
+		{"Orphan", 1, 7 * time.Second, 0, "passed"},
+	}
+	for i, w := range want {
+		span := spans[i]
+		if span.SpecName != w.spec || span.Stream != w.stream || span.Start.Sub(start) != w.offset ||
+			span.Duration() != w.duration || span.Status != w.status {
+			t.Errorf("Span %d: expected %s on stream %d at +%v for %v (%s), got %s on stream %d at +%v for %v (%s)",
+				i, w.spec, w.stream, w.offset, w.duration, w.status,
+				span.SpecName, span.Stream, span.Start.Sub(start), span.Duration(), span.Status)
+		}
+	}
+}
+
+func TestRecorder_ConcurrentStreams(t *testing.T) {
+	recorder := NewRecorder()
+
+	var wg sync.WaitGroup
+	for stream := 1; stream <= 8; stream++ {
+		wg.Add(1)
+		go func(stream int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				file := fmt.Sprintf("specs/%d-%d.spec", stream, i)
+				recorder.SpecStarting(stream, file, file)
+				recorder.SpecEnding(stream, file, file, false, false)
+			}
+		}(stream)
+	}
+	wg.Wait()
+
+	spans := recorder.Spans()
+	if len(spans) != 400 {
+		t.Fatalf("Expected 400 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if span.Duration() < 0 {
+			t.Errorf("Span %s ends before it starts", span.FileName)
+		}
+	}
+}